@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
+	"github.com/marwanbukhori/player-cryptobot/internal/config"
+	"github.com/marwanbukhori/player-cryptobot/internal/history"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/* Where candles come from */
+const (
+	sourceAuto    = "auto"    // The -data file if given, else the cache topped up from Binance
+	sourceCSV     = "csv"     // The -data file
+	sourceCache   = "cache"   // Only the cache, fully offline
+	sourceBinance = "binance" // Binance, bypassing the cache
+)
+
+/* defaultCandles is the window downloaded when neither -from nor -candles is set */
+const defaultCandles = 1000
+
+/* input holds the flags of what a backtest runs on: the data and the account */
+type input struct {
+	symbol   *string
+	interval *string
+	from     *string
+	to       *string
+	candles  *int
+	file     *string
+	source   *string
+	cacheDir *string
+	balance  *float64
+}
+
+func inputFlags(fs *flag.FlagSet) *input {
+	return &input{
+		symbol:   fs.String("symbol", "", "symbol to backtest, a comma separated list backtests them as a portfolio (default: BTCUSDT)"),
+		interval: fs.String("interval", "1m", "candle interval"),
+		from:     fs.String("from", "", "first day or time to backtest, UTC: 2024-01-31 or RFC3339"),
+		to:       fs.String("to", "", "day or time the backtest stops before, UTC (default: now, or the end of the data offline)"),
+		candles:  fs.Int("candles", 0, fmt.Sprintf("candles before -to when -from is not set (default: %d downloaded, everything in a file or the cache)", defaultCandles)),
+		file:     fs.String("data", "", "CSV file of candles to backtest, see history.ReadCSV for the layouts"),
+		source:   fs.String("source", sourceAuto, "where candles come from: auto, csv, cache (offline) or binance"),
+		cacheDir: fs.String("cache-dir", "data/klines", "directory of the local kline cache"),
+		balance:  fs.Float64("balance", 0, "initial balance in USDT (default: INITIAL_INVESTMENT)"),
+	}
+}
+
+/*
+*  config loads the settings without the Binance keys, which candle
+*  backtests never need, and applies -balance over them
+ */
+func (in *input) config() *config.Config {
+	cfg, err := config.LoadSettings()
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+	if *in.balance > 0 {
+		cfg.InitialInvestment = *in.balance
+	}
+	return cfg
+}
+
+/* symbols returns the -symbol list, or the defaults without it */
+func (in *input) symbols(defaults ...string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(*in.symbol, ",") {
+		if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		return defaults
+	}
+	return symbols
+}
+
+/* sourceName resolves auto to the source it stands for */
+func (in *input) sourceName() string {
+	if *in.source == sourceAuto && *in.file != "" {
+		return sourceCSV
+	}
+	return *in.source
+}
+
+/*
+	load
+
+*  reads the candles of every symbol from the -source, between -from
+*  and -to. Without -from it takes the last -candles candles: when
+*  downloading, 1000 up to now by default.
+*/
+func (in *input) load(symbols ...string) (map[string][]models.Kline, error) {
+	from, to, err := in.period()
+	if err != nil {
+		return nil, err
+	}
+	return in.loadBetween(from, to, symbols...)
+}
+
+/* period parses -from and -to, zero times where they are not set */
+func (in *input) period() (from, to time.Time, err error) {
+	if from, err = parseDate(*in.from); err != nil {
+		return from, to, fmt.Errorf("invalid -from: %v", err)
+	}
+	if to, err = parseDate(*in.to); err != nil {
+		return from, to, fmt.Errorf("invalid -to: %v", err)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("-from must be before -to")
+	}
+	return from, to, nil
+}
+
+/* loadBetween is load over a period other than -from / -to */
+func (in *input) loadBetween(from, to time.Time, symbols ...string) (map[string][]models.Kline, error) {
+	size, err := timeframe.ParseInterval(*in.interval)
+	if err != nil {
+		return nil, err
+	}
+
+	window := from.IsZero()
+	source, candles := in.sourceName(), *in.candles
+	online := source == sourceAuto || source == sourceBinance
+	if online {
+		if to.IsZero() {
+			to = time.Now().UTC().Truncate(size)
+		}
+		if from.IsZero() {
+			if candles <= 0 {
+				candles = defaultCandles
+			}
+			from = to.Add(-time.Duration(candles) * size)
+		}
+	}
+
+	var get func(symbol string) ([]models.Kline, error)
+	switch source {
+	case sourceCSV:
+		if *in.file == "" {
+			return nil, fmt.Errorf("-source csv needs a -data file")
+		}
+		if len(symbols) != 1 {
+			return nil, fmt.Errorf("a -data file holds one symbol, use the cache for %s", strings.Join(symbols, ", "))
+		}
+		get = func(symbol string) ([]models.Kline, error) {
+			klines, err := history.LoadCSV(*in.file, size)
+			if err != nil {
+				return nil, err
+			}
+			return history.Between(klines, from, to), nil
+		}
+	case sourceCache, sourceAuto:
+		cache := history.Cache{Dir: *in.cacheDir}
+		if online {
+			cache.Download = &history.Downloader{}
+		}
+		get = func(symbol string) ([]models.Kline, error) {
+			return cache.Candles(symbol, *in.interval, from, to)
+		}
+	case sourceBinance:
+		get = func(symbol string) ([]models.Kline, error) {
+			return history.Downloader{}.Download(symbol, *in.interval, from, to)
+		}
+	default:
+		return nil, fmt.Errorf("unknown -source %q (available: auto, csv, cache, binance)", source)
+	}
+
+	data := make(map[string][]models.Kline, len(symbols))
+	for _, symbol := range symbols {
+		klines, err := get(symbol)
+		if err != nil {
+			return nil, err
+		}
+		if !online && window && candles > 0 && len(klines) > candles {
+			klines = klines[len(klines)-candles:]
+		}
+		if len(klines) == 0 {
+			return nil, fmt.Errorf("no %s candles to backtest", symbol)
+		}
+		data[symbol] = klines
+	}
+	return data, nil
+}
+
+/* run describes a backtest on candles from load for its report */
+func (in *input) run(specs map[string]string, btCfg backtest.Config, data map[string][]models.Kline) backtest.RunInfo {
+	source := in.sourceName()
+	if source == sourceCSV {
+		source = *in.file
+	}
+	return backtest.RunInfo{
+		Strategies: specs,
+		Config:     btCfg,
+		Interval:   *in.interval,
+		Source:     source,
+		DataHash:   backtest.HashCandles(data),
+	}
+}
+
+/* parseDate parses a UTC day or an RFC3339 time, "" is the zero time */
+func parseDate(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", text)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
+	"github.com/marwanbukhori/player-cryptobot/internal/database"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	drift
+
+*  replays a period the bot traded live through the backtester with
+*  the strategies of the .env, and compares the trades it made with
+*  the ones in the trades table, to tell whether live execution
+*  matches what backtests promise
+*
+*  go run ./cmd/backtest drift -from 2024-06-01 -to 2024-06-08 -csv drift.csv
+*/
+func drift(args []string) {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	in := inputFlags(fs)
+	fills := fillFlags(fs)
+	tolerance := fs.Duration("tolerance", 0, "how far apart a live and a simulated trade may be and still match (default: 2 candles)")
+	warmup := fs.Int("warmup", 100, "candles replayed before -from to warm up the strategies, their trades are left out")
+	list := fs.Int("list", 10, "missed and extra trades to print of each")
+	csvPath := fs.String("csv", "", "write the aligned trades to this CSV file")
+	fs.Parse(args)
+
+	cfg := in.config()
+	from, to, err := in.period()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if from.IsZero() {
+		log.Fatal("Drift needs the -from of the live period")
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	size, err := timeframe.ParseInterval(*in.interval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *tolerance <= 0 {
+		*tolerance = 2 * size
+	}
+
+	// What the bot did
+	db, err := database.Initialize(cfg.DatabasePath)
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	symbols := in.symbols(cfg.TradingPairs...)
+	live, err := db.GetTradesBetween(symbols, from, to)
+	if err != nil {
+		log.Fatal("Failed to load live trades:", err)
+	}
+
+	// What the backtest does over the same period, with the same strategies
+	strategy.SetLogOutput(io.Discard)
+	strategies, err := strategy.NewForPairs(symbols, cfg.StrategyFor)
+	if err != nil {
+		log.Fatal("Failed to initialize strategies:", err)
+	}
+	data, err := in.loadBetween(from.Add(-time.Duration(*warmup)*size), to, symbols...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	results, err := backtest.RunPortfolio(data, symbols, strategies, backtestConfig(cfg, "", fills()))
+	if err != nil {
+		log.Fatal("Backtest failed:", err)
+	}
+
+	d := backtest.CompareTrades(live, results.Trades, backtest.DriftConfig{Tolerance: *tolerance, Start: from})
+	fmt.Printf("Live vs backtest from %s to %s\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	fmt.Printf("Trades: %d matched, %d missed live, %d extra live | match rate %.1f%%\n",
+		len(d.Matched), len(d.Missed), len(d.Extra), d.MatchRate)
+	fmt.Printf("Slippage: %.2f bps on average, %.2f USDT | average delay %s\n", d.AvgSlippage, d.SlippageCost, d.AvgDelay)
+	fmt.Printf("PnL: %.2f USDT live vs %.2f USDT simulated, drift %.2f USDT\n", d.LivePnL, d.SimulatedPnL, d.PnLDrift)
+	fmt.Printf("  missed sells: %.2f USDT | extra sells: %.2f USDT\n", d.MissedPnL, d.ExtraPnL)
+	for _, group := range []struct {
+		name   string
+		trades []models.Trade
+	}{{"missed", d.Missed}, {"extra", d.Extra}} {
+		for i, t := range group.trades {
+			if i >= *list {
+				fmt.Printf("  %-6s %d more\n", group.name, len(group.trades)-i)
+				break
+			}
+			fmt.Printf("  %-6s %s %-10s %-4s %.8f at %.2f\n", group.name, t.Timestamp.Format(time.RFC3339), t.Symbol, t.Side, t.Quantity, t.Price)
+		}
+	}
+
+	if *csvPath != "" {
+		if err := writeFile(*csvPath, func(w io.Writer) error { return backtest.WriteDriftCSV(w, d) }); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote %s\n", *csvPath)
+	}
+}
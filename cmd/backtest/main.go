@@ -1,84 +1,323 @@
 package main
 
 import (
-	"encoding/csv"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
 	"github.com/marwanbukhori/player-cryptobot/internal/config"
-	"github.com/marwanbukhori/player-cryptobot/internal/database"
 	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/orderbook"
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
 	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
 )
 
 func main() {
-	// Load config
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatal("Failed to load config:", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "optimize":
+			optimize(os.Args[2:])
+			return
+		case "walkforward":
+			walkForward(os.Args[2:])
+			return
+		case "drift":
+			drift(os.Args[2:])
+			return
+		}
 	}
 
-	// Initialize database
-	db, err := database.Initialize(cfg.DatabasePath)
-	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	depthFile := flag.String("depth", "", "replay a depth recording (<SYMBOL>.depth.jsonl from DEPTH_RECORD_DIR) instead of candles")
+	portfolio := flag.Bool("portfolio", false, "backtest every TRADING_PAIRS pair together with one shared balance, like the bot trades them")
+	spec := flag.String("strategy", "", "strategy spec for every symbol (default: the configured one, see STRATEGIES)")
+	var params paramFlags
+	flag.Var(&params, "param", "strategy parameter over the spec's, repeatable: name=value")
+	in := inputFlags(flag.CommandLine)
+	fills := fillFlags(flag.CommandLine)
+	monteCarlo := monteCarloFlags(flag.CommandLine)
+	report := reportFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Load config, backtests need no API keys
+	cfg := in.config()
+	specFor := func(pair string) string {
+		text := *spec
+		if text == "" {
+			text = cfg.StrategyFor(pair)
+		}
+		text, err := params.apply(text)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return text
+	}
+
+	var results backtest.Result
+	if *depthFile != "" {
+		// Order book strategies replay what the bot recorded
+		records, err := orderbook.Load(*depthFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(records) == 0 {
+			log.Fatal("Depth recording is empty: ", *depthFile)
+		}
+		symbol := records[0].Symbol
+		strat, err := strategy.NewFromSpec(specFor(symbol))
+		if err != nil {
+			log.Fatal("Failed to initialize strategy:", err)
+		}
+		fmt.Printf("Replaying %d %s observations from %s to %s\n", len(records), symbol,
+			records[0].Time.Format(time.RFC3339), records[len(records)-1].Time.Format(time.RFC3339))
+		btCfg := backtestConfig(cfg, symbol, fills())
+		if results, err = backtest.RunRecorded(records, strat, btCfg); err != nil {
+			log.Fatal("Backtest failed:", err)
+		}
+		printResults(results)
+		monteCarlo(results)
+		hash, err := hashFile(*depthFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report(results, backtest.RunInfo{
+			Strategies: map[string]string{symbol: specFor(symbol)},
+			Config:     btCfg,
+			Source:     *depthFile,
+			DataHash:   hash,
+		})
+		return
+	}
+
+	symbols := in.symbols("BTCUSDT")
+	if *portfolio {
+		symbols = in.symbols(cfg.TradingPairs...)
+	}
+	if len(symbols) > 1 {
+		// Every pair with its own strategy, sharing the balance
+		strategies, err := strategy.NewForPairs(symbols, specFor)
+		if err != nil {
+			log.Fatal("Failed to initialize strategies:", err)
+		}
+		data, err := in.load(symbols...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		btCfg := backtestConfig(cfg, "", fills())
+		if results, err = backtest.RunPortfolio(data, symbols, strategies, btCfg); err != nil {
+			log.Fatal("Backtest failed:", err)
+		}
+		printResults(results)
+		monteCarlo(results)
+		specs := make(map[string]string, len(symbols))
+		for _, pair := range symbols {
+			specs[pair] = specFor(pair)
+		}
+		report(results, in.run(specs, btCfg, data))
+		return
 	}
 
-	// Initialize exchange
-	exchange, err := exchange.NewExchange(cfg, db)
+	// Build the strategy from the same registry the bot uses
+	symbol := symbols[0]
+	strat, err := strategy.NewFromSpec(specFor(symbol))
 	if err != nil {
-		log.Fatal("Failed to initialize exchange:", err)
+		log.Fatal("Failed to initialize strategy:", err)
 	}
-	strategy := strategy.NewMeanReversionStrategy()
 
-	// Get historical data
-	data, err := exchange.GetHistoricalData("BTCUSDT", "1m", 1000) // Last 1000 minutes
+	btCfg := fills()
+	run, data, err := newRunner(cfg, in, symbol, strat, btCfg)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if results, err = run(strat); err != nil {
+		log.Fatal("Backtest failed:", err)
+	}
+	printResults(results)
+	monteCarlo(results)
+	report(results, in.run(map[string]string{symbol: specFor(symbol)}, backtestConfig(cfg, symbol, btCfg), data))
+}
 
-	// Run backtest
-	results := backtest.Run(data, strategy, 10.0) // Start with 10 USDT
+/* paramFlags collects repeated -param name=value flags */
+type paramFlags map[string]string
 
-	// Print results
-	fmt.Printf("Total Trades: %d\n", results.TotalTrades)
-	fmt.Printf("Win Rate: %.2f%%\n", results.WinRate)
-	fmt.Printf("Profit/Loss: %.2f USDT\n", results.ProfitLoss)
+func (p *paramFlags) String() string {
+	return strategy.Spec{Params: *p}.String()
+}
+
+func (p *paramFlags) Set(text string) error {
+	name, value, ok := strings.Cut(text, "=")
+	if name, value = strings.TrimSpace(name), strings.TrimSpace(value); !ok || name == "" || value == "" {
+		return fmt.Errorf("invalid parameter %q, expected name=value", text)
+	}
+	if *p == nil {
+		*p = make(paramFlags)
+	}
+	(*p)[name] = value
+	return nil
 }
 
-func loadHistoricalData(filepath string) ([]backtest.MarketData, error) {
-	file, err := os.Open(filepath)
+/* apply sets the parameters in a strategy spec */
+func (p paramFlags) apply(text string) (string, error) {
+	if len(p) == 0 {
+		return text, nil
+	}
+	spec, err := strategy.ParseSpec(text)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	for name, value := range p {
+		spec.Params[name] = value
 	}
-	defer file.Close()
+	return spec.String(), nil
+}
+
+/*
+*  fillFlags adds the flags of how the simulated exchange fills to a
+*  flag set, the returned function builds the defaults from them once
+*  it is parsed
+ */
+func fillFlags(fs *flag.FlagSet) func() backtest.Config {
+	makerBps := fs.Float64("maker-bps", 10, "fee of limit orders in bps")
+	takerBps := fs.Float64("taker-bps", 10, "fee of market and stop-loss orders in bps")
+	spreadBps := fs.Float64("spread-bps", 1, "half spread paid on every fill in bps")
+	slippage := fs.Float64("slippage", 0.1, "slippage in % per 1% of the bar's volume an order takes")
+	latency := fs.Int("latency", 0, "bars between a signal and its fill, 0 fills at the signal's price")
+	intrabar := fs.String("intrabar", "pessimistic", "exit of a candle reaching both stop and target: pessimistic, open-distance or optimistic")
+
+	return func() backtest.Config {
+		fills := backtest.DefaultConfig()
+		fills.Costs = exchange.Costs{
+			MakerBps:    *makerBps,
+			TakerBps:    *takerBps,
+			Spread:      exchange.HalfSpread(*spreadBps),
+			Slippage:    exchange.VolumeSlippage(*slippage),
+			LatencyBars: *latency,
+		}
+		rule, err := exchange.ParseIntrabarRule(*intrabar)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fills.Intrabar = rule
+		return fills
+	}
+}
+
+/*
+	newRunner
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+*  loads the candles strat trades once and returns a function that
+*  backtests a strategy on them, and the candles. Multi-symbol
+*  strategies (pairs) replay every leg together, others trade symbol.
+*  The candles are only read, so the function can run strategies in
+*  parallel.
+*/
+func newRunner(cfg *config.Config, in *input, symbol string, strat strategy.Strategy, fills backtest.Config) (func(strategy.Strategy) (backtest.Result, error), map[string][]models.Kline, error) {
+	if multi, ok := strat.(strategy.MultiSymbol); ok {
+		data, err := in.load(multi.Symbols()...)
+		if err != nil {
+			return nil, nil, err
+		}
+		btCfg := backtestConfig(cfg, "", fills)
+		return func(s strategy.Strategy) (backtest.Result, error) {
+			multi, ok := s.(strategy.MultiSymbol)
+			if !ok {
+				return backtest.Result{}, fmt.Errorf("strategy is not multi-symbol")
+			}
+			return backtest.RunMulti(data, multi, btCfg)
+		}, data, nil
+	}
+
+	data, err := in.load(symbol)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	btCfg := backtestConfig(cfg, symbol, fills)
+	return func(s strategy.Strategy) (backtest.Result, error) {
+		return backtest.Run(data[symbol], s, btCfg)
+	}, data, nil
+}
 
-	var data []backtest.MarketData
-	for i, record := range records {
-		if i == 0 { // Skip header
-			continue
+/*
+*  backtestConfig trades the simulated account with the bot's settings,
+*  the defaults fill in what isn't configured
+ */
+func backtestConfig(cfg *config.Config, symbol string, defaults backtest.Config) backtest.Config {
+	btCfg := defaults
+	btCfg.Symbol = symbol
+	if cfg.InitialInvestment > 0 {
+		btCfg.InitialBalance = cfg.InitialInvestment
+	}
+	if cfg.MinOrderSize > 0 {
+		btCfg.MinOrderSize = cfg.MinOrderSize
+	}
+	if cfg.MaxDrawdown > 0 {
+		btCfg.MaxDrawdown = cfg.MaxDrawdown
+	}
+	if cfg.RiskPerTrade > 0 {
+		btCfg.RiskPerTrade = cfg.RiskPerTrade
+	}
+	if cfg.AggressiveFactor > 0 {
+		btCfg.AggressiveFactor = cfg.AggressiveFactor
+	}
+	btCfg.EnableCompounding = cfg.EnableCompounding
+	btCfg.MaxExposure, btCfg.MaxSymbolExposure = cfg.MaxExposure, cfg.MaxSymbolExposure
+	return btCfg
+}
+
+func printResults(results backtest.Result) {
+	// Print results
+	fmt.Printf("Total Trades: %d\n", results.TotalTrades)
+	fmt.Printf("Win Rate: %.2f%%\n", results.WinRate)
+	fmt.Printf("Profit/Loss: %.2f USDT (gross %.2f USDT)\n", results.ProfitLoss, results.GrossProfitLoss)
+	fmt.Printf("Costs: %.2f USDT (fees %.2f, spread %.2f, slippage %.2f, latency %.2f)\n", results.Costs.Total(),
+		results.Costs.Fees, results.Costs.Spread, results.Costs.Slippage, results.Costs.Latency)
+
+	// Performance over the run
+	m := results.Metrics
+	fmt.Printf("Period: %s to %s\n", m.Start.Format(time.RFC3339), m.End.Format(time.RFC3339))
+	fmt.Printf("Return: %.2f%% (CAGR %.2f%%) vs buy & hold %.2f%%\n", m.TotalReturn, m.CAGR, m.BuyAndHold)
+	fmt.Printf("Sharpe: %.2f | Sortino: %.2f | Calmar: %.2f\n", m.Sharpe, m.Sortino, m.Calmar)
+	fmt.Printf("Max Drawdown: %.2f%% over %s\n", m.MaxDrawdown, m.MaxDrawdownDuration)
+	fmt.Printf("Closed Trades: %d | Profit Factor: %.2f | Expectancy: %.2f USDT\n", m.ClosedTrades, m.ProfitFactor, m.Expectancy)
+	fmt.Printf("Avg Win: %.2f USDT | Avg Loss: %.2f USDT | Exposure: %.1f%%\n", m.AvgWin, m.AvgLoss, m.Exposure)
+	for _, side := range []string{"BUY", "SELL"} {
+		if n := m.TradesBySide[side]; n > 0 {
+			fmt.Printf("  %-5s %d fills\n", side, n)
 		}
+	}
 
-		timestamp, _ := time.Parse("2006-01-02 15:04:05", record[0])
-		price, _ := strconv.ParseFloat(record[1], 64)
-		volume, _ := strconv.ParseFloat(record[2], 64)
+	// Per-symbol breakdown of a portfolio
+	symbols := make([]string, 0, len(results.Symbols))
+	for symbol := range results.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		r := results.Symbols[symbol]
+		fmt.Printf("  %-10s %.2f USDT | %d fills, %d closed, win rate %.2f%% | exposure %.1f%% | buy & hold %.2f%%\n",
+			symbol, r.ProfitLoss, r.Trades, r.ClosedTrades, r.WinRate, r.Exposure, r.BuyAndHold)
+	}
 
-		data = append(data, backtest.MarketData{
-			Time:   timestamp,
-			Price:  price,
-			Volume: volume,
-		})
+	// Profit/loss by market regime
+	for _, r := range append([]regime.Regime{regime.Unknown}, regime.All...) {
+		if stats, ok := results.Regimes[r]; ok {
+			fmt.Printf("  %-16s %5d bars, %3d entries, %.2f USDT\n", r, stats.Bars, stats.Entries, stats.ProfitLoss)
+		}
 	}
 
-	return data, nil
+	// Per-child breakdown for composite strategies
+	for _, c := range results.Contributions {
+		fmt.Printf("  %s (weight %.2f): %d buys, %d sells, %d agreed, %d vetoed\n",
+			c.Name, c.Weight, c.Buys, c.Sells, c.Agreed, c.Vetoed)
+	}
+
+	// Signals held off by guards
+	for name, n := range results.Suppressed {
+		fmt.Printf("  suppressed by %s guard: %d\n", name, n)
+	}
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
+)
+
+/*
+*  monteCarloFlags adds the Monte Carlo flags to a flag set. The
+*  returned function resamples a backtest's closed trades with every
+*  method and prints the percentile tables, or does nothing without
+*  -montecarlo.
+ */
+func monteCarloFlags(fs *flag.FlagSet) func(backtest.Result) {
+	defaults := backtest.DefaultMonteCarloConfig()
+	runs := fs.Int("montecarlo", 0, "Monte Carlo runs resampling the closed trades, 0 skips the analysis")
+	seed := fs.Int64("mc-seed", defaults.Seed, "seed of the Monte Carlo runs")
+	skip := fs.Float64("mc-skip", defaults.SkipProbability, "chance a trade is missed when resampling with skip")
+	ruin := fs.Float64("ruin", defaults.Ruin, "% of the initial balance lost at any point that counts as ruin")
+
+	return func(results backtest.Result) {
+		if *runs <= 0 {
+			return
+		}
+		if len(results.Closed) == 0 {
+			fmt.Println("Monte Carlo: no closed trades to resample")
+			return
+		}
+		balance := results.Equity[0].Equity
+		for _, method := range backtest.Resamplings {
+			mc, err := backtest.MonteCarlo(results.Closed, balance, backtest.MonteCarloConfig{
+				Runs:            *runs,
+				Seed:            *seed,
+				Method:          method,
+				SkipProbability: *skip,
+				Ruin:            *ruin,
+			})
+			if err != nil {
+				fmt.Printf("Monte Carlo %s: %v\n", method, err)
+				continue
+			}
+			printMonteCarlo(mc, *ruin)
+		}
+	}
+}
+
+func printMonteCarlo(mc backtest.MonteCarloResult, ruin float64) {
+	fmt.Printf("Monte Carlo %s: %d runs of %d trades | risk of ruin (-%.0f%%): %.2f%% | P(loss): %.2f%%\n",
+		mc.Method, mc.Runs, mc.Trades, ruin, mc.RiskOfRuin, mc.LossProbability)
+	header := []string{fmt.Sprintf("  %-16s", "percentile")}
+	for _, p := range backtest.MonteCarloPercentiles {
+		header = append(header, fmt.Sprintf("%10s", fmt.Sprintf("p%g", p)))
+	}
+	fmt.Println(strings.Join(append(header, fmt.Sprintf("%10s", "mean")), ""))
+	rows := []struct {
+		name string
+		d    backtest.Distribution
+	}{
+		{"final equity", mc.FinalEquity},
+		{"max drawdown %", mc.MaxDrawdown},
+	}
+	for _, row := range rows {
+		line := fmt.Sprintf("  %-16s", row.name)
+		for _, v := range append(row.d.Percentiles, row.d.Mean) {
+			line += fmt.Sprintf("%10.2f", v)
+		}
+		fmt.Println(line)
+	}
+}
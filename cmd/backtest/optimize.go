@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
+	"github.com/marwanbukhori/player-cryptobot/internal/config"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+/* rangeFlags collects repeated -param flags */
+type rangeFlags []backtest.ParamRange
+
+func (r *rangeFlags) String() string {
+	names := make([]string, len(*r))
+	for i, p := range *r {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (r *rangeFlags) Set(text string) error {
+	p, err := backtest.ParseParamRange(text)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, p)
+	return nil
+}
+
+/* sweep holds the flags optimize and walkforward share */
+type sweep struct {
+	spec      *string
+	ranges    rangeFlags
+	objective *string
+	workers   *int
+	input     *input
+	fills     func() backtest.Config
+}
+
+func sweepFlags(fs *flag.FlagSet) *sweep {
+	s := &sweep{
+		spec:      fs.String("strategy", "", "strategy spec to sweep, its own parameters stay fixed (default: the symbol's configured strategy)"),
+		objective: fs.String("objective", "sharpe", "rank by: "+strings.Join(backtest.ObjectiveNames(), ", ")),
+		workers:   fs.Int("workers", runtime.NumCPU(), "backtests run in parallel"),
+		input:     inputFlags(fs),
+		fills:     fillFlags(fs),
+	}
+	fs.Var(&s.ranges, "param", "parameter range, repeatable: name=from:to:step or name=a,b,c")
+	return s
+}
+
+/*
+*  load checks the parsed flags and loads the config, the symbol, the
+*  strategy spec to sweep and the objective. Strategy logging is
+*  silenced, thousands of backtests would drown the output.
+ */
+func (s *sweep) load() (*config.Config, string, backtest.Objective) {
+	if len(s.ranges) == 0 {
+		log.Fatal("No parameter to sweep, add -param name=from:to:step")
+	}
+	objective, err := backtest.ParseObjective(*s.objective)
+	if err != nil {
+		log.Fatal(err)
+	}
+	symbols := s.input.symbols("BTCUSDT")
+	if len(symbols) > 1 {
+		log.Fatal("Sweeps backtest one -symbol")
+	}
+	cfg := s.input.config()
+	if *s.spec == "" {
+		*s.spec = cfg.StrategyFor(symbols[0])
+	}
+	strategy.SetLogOutput(io.Discard)
+	return cfg, symbols[0], objective
+}
+
+/*
+	optimize
+
+*  sweeps strategy parameters: every combination of the -param ranges
+*  is backtested in parallel on the same candles, ranked by -objective
+*  and optionally exported to -csv / -json
+*
+*  go run ./cmd/backtest optimize -strategy mean_reversion \
+*    -param rsi_period=10:20:2 -param oversold=20:35:5 -objective sharpe
+*/
+func optimize(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	sweep := sweepFlags(fs)
+	top := fs.Int("top", 10, "ranked trials to print")
+	csvPath := fs.String("csv", "", "write every trial to this CSV file")
+	jsonPath := fs.String("json", "", "write every trial to this JSON file")
+	fs.Parse(args)
+
+	cfg, symbol, objective := sweep.load()
+	base, err := strategy.NewFromSpec(*sweep.spec)
+	if err != nil {
+		log.Fatal("Failed to initialize strategy:", err)
+	}
+	run, _, err := newRunner(cfg, sweep.input, symbol, base, sweep.fills())
+	if err != nil {
+		log.Fatal(err)
+	}
+	trials, err := backtest.Optimize(*sweep.spec, sweep.ranges, objective, *sweep.workers, run)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%d trials of %s ranked by %s\n", len(trials), *sweep.spec, *sweep.objective)
+	for i, t := range trials {
+		if i >= *top {
+			break
+		}
+		if t.Err != nil {
+			fmt.Printf("%3d. %s: %v\n", i+1, t.Spec, t.Err)
+			continue
+		}
+		m := t.Result.Metrics
+		fmt.Printf("%3d. %s = %.4f | net %.2f USDT | Sharpe %.2f | max DD %.2f%% | %d trades | %s\n",
+			i+1, *sweep.objective, t.Score, t.Result.ProfitLoss, m.Sharpe, m.MaxDrawdown, t.Result.TotalTrades, t.Spec)
+	}
+
+	exports := []struct {
+		path  string
+		write func(io.Writer, []backtest.Trial) error
+	}{
+		{*csvPath, backtest.WriteTrialsCSV},
+		{*jsonPath, backtest.WriteTrialsJSON},
+	}
+	for _, export := range exports {
+		if export.path == "" {
+			continue
+		}
+		if err := writeFile(export.path, func(w io.Writer) error { return export.write(w, trials) }); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote %s\n", export.path)
+	}
+}
+
+/*
+	walkForward
+
+*  optimizes the -param ranges on rolling in-sample windows and tests
+*  the winners on the out-of-sample window after each, to tell tuned
+*  parameters from overfit ones before they go to cmd/bot
+*
+*  go run ./cmd/backtest walkforward -strategy mean_reversion \
+*    -param rsi_period=5:20:5 -in 600 -out 200 -warmup 100
+*/
+func walkForward(args []string) {
+	fs := flag.NewFlagSet("walkforward", flag.ExitOnError)
+	sweep := sweepFlags(fs)
+	inSample := fs.Int("in", 600, "in-sample candles the parameters are optimized on")
+	outOfSample := fs.Int("out", 200, "out-of-sample candles the winners are tested on, the windows roll by as much")
+	anchored := fs.Bool("anchored", false, "grow the in-sample window from the first candle instead of rolling it")
+	warmup := fs.Int("warmup", 100, "candles replayed before an out-of-sample window to warm up the strategy")
+	fs.Parse(args)
+
+	cfg, symbol, objective := sweep.load()
+	data, err := sweep.input.load(symbol)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := backtest.WalkForward(data[symbol], *sweep.spec, sweep.ranges, backtestConfig(cfg, symbol, sweep.fills()),
+		backtest.WalkForwardConfig{
+			InSample:    *inSample,
+			OutOfSample: *outOfSample,
+			Anchored:    *anchored,
+			Warmup:      *warmup,
+			Objective:   objective,
+			Workers:     *sweep.workers,
+		})
+	if err != nil {
+		log.Fatal("Walk-forward failed:", err)
+	}
+
+	for i, w := range result.Windows {
+		fmt.Printf("%2d. out of sample %s to %s: %s %.4f in / %.4f out, return %.2f%%, efficiency %.2f | %s\n",
+			i+1, w.OutStart.Format(time.RFC3339), w.OutEnd.Format(time.RFC3339), *sweep.objective,
+			w.InSampleScore, w.OutOfSampleScore, w.OutOfSample.Metrics.TotalReturn, w.Efficiency, w.Spec)
+	}
+	m := result.Metrics
+	fmt.Printf("Out of sample: return %.2f%% vs buy & hold %.2f%% | Sharpe %.2f | max DD %.2f%% | %d closed trades | efficiency %.2f\n",
+		m.TotalReturn, m.BuyAndHold, m.Sharpe, m.MaxDrawdown, m.ClosedTrades, result.Efficiency)
+	for _, s := range result.Stability {
+		fmt.Printf("  %-16s %d changes, %d distinct values", s.Name, s.Changes, s.Distinct)
+		if s.Numeric {
+			fmt.Printf(", mean %.4g, CV %.2f", s.Mean, s.CV)
+		}
+		fmt.Printf(": %s\n", strings.Join(s.Values, " "))
+	}
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/backtest"
+)
+
+/*
+*  reportFlags adds the report flags to a flag set. The returned
+*  function writes the reports asked for, the HTML one and its JSON
+*  twin.
+ */
+func reportFlags(fs *flag.FlagSet) func(backtest.Result, backtest.RunInfo) {
+	htmlPath := fs.String("report", "", "write an HTML report of the run to this file")
+	jsonPath := fs.String("report-json", "", "write the report as JSON to this file")
+
+	return func(results backtest.Result, run backtest.RunInfo) {
+		if *htmlPath == "" && *jsonPath == "" {
+			return
+		}
+		run.Version = buildVersion()
+		report := backtest.NewReport(results, run)
+		exports := []struct {
+			path  string
+			write func(io.Writer, backtest.Report) error
+		}{
+			{*htmlPath, backtest.WriteReportHTML},
+			{*jsonPath, backtest.WriteReportJSON},
+		}
+		for _, export := range exports {
+			if export.path == "" {
+				continue
+			}
+			if err := writeFile(export.path, func(w io.Writer) error { return export.write(w, report) }); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Wrote %s\n", export.path)
+		}
+	}
+}
+
+/* buildVersion returns the git revision the binary was built from, "" if unknown */
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if revision == "" {
+		if info.Main.Version == "(devel)" {
+			return ""
+		}
+		return info.Main.Version
+	}
+	return revision + modified
+}
+
+/* hashFile returns the SHA-256 of a file's content */
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,142 +1,431 @@
 package backtest
 
 import (
+	"fmt"
+	"io"
 	"time"
 
+	"github.com/marwanbukhori/player-cryptobot/internal/engine"
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/logger"
 	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/orderbook"
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
+	"github.com/marwanbukhori/player-cryptobot/internal/risk"
 	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
 )
 
-type MarketData struct {
-	Time   time.Time
-	Price  float64
-	Volume float64
+type Result struct {
+	TotalTrades     int
+	WinRate         float64
+	ProfitLoss      float64                        // Net of every cost
+	GrossProfitLoss float64                        // What ProfitLoss would be if fills were free
+	Costs           exchange.CostTotals            // Fees, spread, slippage and latency paid
+	Equity          []EquityPoint                  // Equity after every bar, starting with the initial balance
+	Trades          []models.Trade                 // Fills in the order they happened
+	Symbols         map[string]SymbolResult        // Per symbol of a portfolio, nil for one symbol
+	Closed          []float64                      // PnL of every closed trade in order, net of costs
+	Metrics         Metrics                        // Returns, risk and trade statistics
+	Contributions   []strategy.Contribution        // Per-child signals when the strategy is composite
+	Regimes         map[regime.Regime]RegimeResult // ProfitLoss broken down by market regime, nil for portfolios
+	Suppressed      map[string]int                 // Signals suppressed by each guard
+
+	paid []exchange.CostTotals // Costs paid by each Equity point
 }
 
-type BacktestResult struct {
-	TotalTrades   int
-	WinningTrades int
-	LosingTrades  int
-	TotalProfit   float64
-	MaxDrawdown   float64
-	WinRate       float64
-	Trades        []models.Order
+/*
+*  RegimeResult is the part of a backtest spent in one regime
+*  - Bars: candles classified as the regime
+*  - Entries: buys filled while in the regime
+*  - ProfitLoss: mark-to-market change of equity over those bars
+ */
+type RegimeResult struct {
+	Bars       int
+	Entries    int
+	ProfitLoss float64
 }
 
-type Backtester struct {
-	strategy strategy.Strategy
-	data     []MarketData
-	balance  float64
+/*
+	SymbolResult
+
+*  one symbol's part of a portfolio backtest. ProfitLoss is what its
+*  fills made net of costs, its open position valued at the last
+*  price, so the symbols add up to the portfolio's ProfitLoss.
+*  Exposure is the % of bars it held a position.
+*/
+type SymbolResult struct {
+	Trades       int
+	ClosedTrades int
+	WinRate      float64
+	ProfitLoss   float64
+	Exposure     float64
+	BuyAndHold   float64
 }
 
-func NewBacktester(strategy strategy.Strategy, initialBalance float64) *Backtester {
-	return &Backtester{
-		strategy: strategy,
-		balance:  initialBalance,
+/*
+	Config
+
+*  how the simulated account trades, the backtest counterpart of the
+*  bot's .env settings
+*/
+type Config struct {
+	Symbol            string  // Traded pair, e.g. BTCUSDT
+	InitialBalance    float64 // USDT to start with
+	MinOrderSize      float64 // USDT, smaller buys are skipped
+	MaxDrawdown       float64
+	RiskPerTrade      float64 // Share of the balance risked down to the stop
+	AggressiveFactor  float64
+	EnableCompounding bool
+	Costs             exchange.Costs        // Fees, spread, slippage and latency of every fill
+	Intrabar          exchange.IntrabarRule // Exit filled first by a candle reaching the stop and the target
+	MaxExposure       float64               // Share of equity all positions may hold, 0 = no limit
+	MaxSymbolExposure float64               // Share of equity one symbol's position may hold, 0 = no limit
+}
+
+/*
+*  DefaultConfig trades BTCUSDT with 1000 USDT, risking 2% per trade.
+*  Fills pay Binance's 0.1% spot fee, a 1 bps half spread and 0.1%
+*  slippage per 1% of the bar's volume, at the price the decision saw.
+ */
+func DefaultConfig() Config {
+	return Config{
+		Symbol:           "BTCUSDT",
+		InitialBalance:   1000,
+		MinOrderSize:     10,
+		MaxDrawdown:      0.2,
+		RiskPerTrade:     0.02,
+		AggressiveFactor: 1,
+		Costs: exchange.Costs{
+			MakerBps: 10,
+			TakerBps: 10,
+			Spread:   exchange.HalfSpread(1),
+			Slippage: exchange.VolumeSlippage(0.1),
+		},
 	}
 }
 
-func (b *Backtester) Run() BacktestResult {
-	var result BacktestResult
-	var position *models.Order
-	maxBalance := b.balance
-	minDrawdown := 0.0
-
-	for i, data := range b.data {
-		signal := b.strategy.Analyze(&models.MarketData{
-			Symbol: "BTCUSDT",
-			Price:  data.Price,
-			Time:   data.Time,
-		})
-
-		if signal != nil {
-			if position == nil && signal.Action == "BUY" {
-				// Open position
-				position = &models.Order{
-					Symbol:    "BTCUSDT",
-					Side:      "BUY",
-					Price:     data.Price,
-					Quantity:  b.balance / data.Price,
-					Timestamp: data.Time,
-				}
-				result.TotalTrades++
-			} else if position != nil && signal.Action == "SELL" {
-				// Close position
-				profit := (data.Price - position.Price) * position.Quantity
-				b.balance += profit
-
-				if profit > 0 {
-					result.WinningTrades++
-				} else {
-					result.LosingTrades++
-				}
+/*
+	Run
 
-				result.TotalProfit += profit
-				result.Trades = append(result.Trades, *position)
+*  replays candles through the trading engine the bot runs, on a
+*  SimExchange whose clock is the close of the last candle. Higher
+*  timeframes the strategy subscribes to are resampled from the same
+*  candles, a higher timeframe candle is only visible after its last
+*  base candle closed. Stops and take-profits fill within the candle
+*  that reached them, see SimExchange.AddCandle.
+*
+*  Every bar's equity change is credited to the regime the bar started
+*  in, so the per-regime results add up to ProfitLoss. The regime comes
+*  from the strategy when it classifies one, else from a detector with
+*  the default thresholds.
+*/
+func Run(data []models.Kline, strat strategy.Strategy, cfg Config) (Result, error) {
+	if len(data) == 0 {
+		return Result{}, fmt.Errorf("no candles to replay")
+	}
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": cfg.InitialBalance}, cfg.Costs)
+	sim.Intrabar = cfg.Intrabar
+	return simulate(cfg, []string{cfg.Symbol}, map[string]strategy.Strategy{cfg.Symbol: strat}, sim, len(data), func(i int) {
+		sim.AddCandle(cfg.Symbol, data[i])
+	}, nil)
+}
 
-				// Update drawdown
-				if b.balance > maxBalance {
-					maxBalance = b.balance
-				}
-				currentDrawdown := (maxBalance - b.balance) / maxBalance
-				if currentDrawdown > minDrawdown {
-					minDrawdown = currentDrawdown
-				}
+/*
+	RunPortfolio
 
-				position = nil
-			}
+*  backtests several symbols at once the way the bot trades its
+*  TRADING_PAIRS: one engine steps every pair in order with its own
+*  strategy, on one SimExchange whose USDT balance they share. Each
+*  pair holds its own position, sized by the risk manager and capped by
+*  cfg.MaxExposure / cfg.MaxSymbolExposure. cfg.Symbol is ignored.
+*
+*  Candles are matched by open time, times missing from any symbol are
+*  skipped. The result is the portfolio's, Symbols breaks it down and
+*  BuyAndHold holds the symbols in equal parts.
+*/
+func RunPortfolio(data map[string][]models.Kline, pairs []string, strategies map[string]strategy.Strategy, cfg Config) (Result, error) {
+	if len(pairs) == 0 {
+		return Result{}, fmt.Errorf("no symbols to backtest")
+	}
+	candles, times, err := alignCandles(data, pairs)
+	if err != nil {
+		return Result{}, err
+	}
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": cfg.InitialBalance}, cfg.Costs)
+	sim.Intrabar = cfg.Intrabar
+	return simulate(cfg, pairs, strategies, sim, len(times), func(i int) {
+		for _, pair := range pairs {
+			sim.AddCandle(pair, candles[pair][times[i]])
 		}
+	}, nil)
+}
 
-		if i == len(b.data)-1 {
-			result.MaxDrawdown = minDrawdown
-			result.WinRate = float64(result.WinningTrades) / float64(result.TotalTrades)
+/*
+*  alignCandles indexes the symbols' candles by open time and returns
+*  the open times all of them have a candle for, in order
+ */
+func alignCandles(data map[string][]models.Kline, symbols []string) (map[string]map[int64]models.Kline, []int64, error) {
+	candles := make(map[string]map[int64]models.Kline, len(symbols))
+	for _, symbol := range symbols {
+		if len(data[symbol]) == 0 {
+			return nil, nil, fmt.Errorf("no candles to replay for %s", symbol)
+		}
+		candles[symbol] = make(map[int64]models.Kline, len(data[symbol]))
+		for _, candle := range data[symbol] {
+			candles[symbol][candle.OpenTime] = candle
 		}
 	}
 
-	return result
+	var times []int64
+	for _, candle := range data[symbols[0]] {
+		shared := true
+		for _, symbol := range symbols[1:] {
+			if _, ok := candles[symbol][candle.OpenTime]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			times = append(times, candle.OpenTime)
+		}
+	}
+	if len(times) == 0 {
+		return nil, nil, fmt.Errorf("symbols %v have no candle times in common", symbols)
+	}
+	return candles, times, nil
 }
 
-func (b *Backtester) LoadData(data []MarketData) {
-	b.data = data
-}
+/*
+	RunRecorded
 
-type Result struct {
-	TotalTrades int
-	WinRate     float64
-	ProfitLoss  float64
+*  replays a depth recording made by the bot (DEPTH_RECORD_DIR), so
+*  order book strategies see the same book and trade flow they saw
+*  live. The symbol is the recorded one, orders fill at the recorded
+*  price plus costs. Records have no volume, so they don't slip.
+*/
+func RunRecorded(records []orderbook.Record, strat strategy.Strategy, cfg Config) (Result, error) {
+	if len(records) == 0 {
+		return Result{}, fmt.Errorf("no depth records to replay")
+	}
+	cfg.Symbol = records[0].Symbol
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": cfg.InitialBalance}, cfg.Costs)
+	current := 0
+	return simulate(cfg, []string{cfg.Symbol}, map[string]strategy.Strategy{cfg.Symbol: strat}, sim, len(records), func(i int) {
+		current = i
+		sim.SetPrice(cfg.Symbol, records[i].Price, records[i].Time)
+	}, func(e *engine.Engine) {
+		e.Book = func(pair string, now time.Time) (*models.OrderBook, *models.TradeFlow) {
+			data := records[current].MarketData()
+			return data.Book, data.Flow
+		}
+	})
 }
 
-func Run(data []models.Kline, strategy *strategy.MeanReversionStrategy, initialBalance float64) Result {
+/*
+*  simulate runs n steps of the engine over the pairs, advance(i) moves
+*  the market to the i-th observation first. setup attaches data
+*  sources. Regimes are only broken down for a single pair.
+ */
+func simulate(cfg Config, pairs []string, strategies map[string]strategy.Strategy, sim *exchange.SimExchange, n int, advance func(i int), setup func(*engine.Engine)) (Result, error) {
 	var result Result
-	balance := initialBalance
-	position := 0.0
-
-	for _, candle := range data {
-		signal := strategy.Analyze(&models.MarketData{
-			Symbol: "BTCUSDT",
-			Price:  candle.Close,
-			Time:   time.Unix(candle.CloseTime/1000, 0),
-		})
-
-		if signal != nil {
-			result.TotalTrades++
-			if signal.Action == "BUY" && position == 0 {
-				position = balance / candle.Close
-				balance = 0
-			} else if signal.Action == "SELL" && position > 0 {
-				balance = position * candle.Close
-				if balance > initialBalance {
-					result.WinRate++
+	riskManager := risk.NewRiskManager(cfg.InitialBalance, cfg.MaxDrawdown, cfg.RiskPerTrade,
+		cfg.AggressiveFactor, cfg.EnableCompounding)
+	e, err := engine.New(sim, sim, pairs, strategies, riskManager, cfg.MinOrderSize, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		return result, err
+	}
+	e.MaxExposure, e.MaxSymbolExposure = cfg.MaxExposure, cfg.MaxSymbolExposure
+	if setup != nil {
+		setup(e)
+	}
+
+	single := len(pairs) == 1
+	if single {
+		result.Regimes = make(map[regime.Regime]RegimeResult)
+	}
+	barRegime := regime.Unknown
+	equity := cfg.InitialBalance
+	firstPrices := make(map[string]float64, len(pairs))
+	exposedBars := make(map[string]int, len(pairs))
+
+	for i := 0; i < n; i++ {
+		filled := len(sim.Trades())
+		advance(i)
+		if i == 0 {
+			/* The run starts when the first bar opened */
+			start := sim.Now()
+			for j, pair := range pairs {
+				firstPrices[pair], _ = sim.GetPrice(pair)
+				if candle, ok := sim.LastCandle(pair); ok {
+					firstPrices[pair] = candle.Open
+					if j == 0 {
+						start = time.UnixMilli(candle.OpenTime)
+					}
+				}
+			}
+			result.Equity = append(result.Equity, EquityPoint{Time: start, Equity: cfg.InitialBalance})
+			result.paid = append(result.paid, exchange.CostTotals{})
+		}
+		e.Step()
+
+		exposed := false
+		for _, pair := range pairs {
+			if position, _ := sim.GetOpenPosition(pair); position != nil {
+				exposed = true
+				exposedBars[pair]++
+			}
+		}
+		newEquity := sim.Equity()
+
+		if single {
+			current := regime.Unknown
+			if snapshot, ok := e.Regimes().Get(pairs[0]); ok {
+				current = snapshot.Regime
+			}
+			for _, trade := range sim.Trades()[filled:] {
+				if trade.Side == "BUY" {
+					stats := result.Regimes[current]
+					stats.Entries++
+					result.Regimes[current] = stats
 				}
-				position = 0
 			}
+
+			/* Credit this bar's equity change to the regime it started in */
+			stats := result.Regimes[barRegime]
+			stats.Bars++
+			stats.ProfitLoss += newEquity - equity
+			result.Regimes[barRegime] = stats
+			equity, barRegime = newEquity, current
+		}
+
+		result.Equity = append(result.Equity, EquityPoint{Time: sim.Now(), Equity: newEquity, Exposed: exposed})
+		result.paid = append(result.paid, sim.Costs())
+	}
+
+	result.Suppressed = make(map[string]int)
+	for _, pair := range pairs {
+		if reporter, ok := strategies[pair].(strategy.ContributionReporter); ok {
+			result.Contributions = append(result.Contributions, reporter.Contributions()...)
 		}
+		for name, count := range strategy.Suppressed(strategies[pair]) {
+			result.Suppressed[name] += count
+		}
+	}
+
+	result.Trades = append([]models.Trade(nil), sim.Trades()...)
+	result.Closed = closedTrades(result.Trades)
+	result.Metrics = ComputeMetrics(result.Equity, result.Closed)
+	result.Metrics.TradesBySide = make(map[string]int)
+	for _, trade := range result.Trades {
+		result.Metrics.TradesBySide[trade.Side]++
 	}
 
-	result.ProfitLoss = balance + (position * data[len(data)-1].Close) - initialBalance
-	if result.TotalTrades > 0 {
-		result.WinRate = (result.WinRate / float64(result.TotalTrades)) * 100
+	/* The benchmark holds the symbols in equal parts */
+	lastPrices := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		lastPrices[pair], _ = sim.GetPrice(pair)
+		if firstPrices[pair] > 0 {
+			result.Metrics.BuyAndHold += (lastPrices[pair]/firstPrices[pair] - 1) * 100 / float64(len(pairs))
+		}
+	}
+	if !single {
+		result.Symbols = symbolResults(pairs, result.Trades, firstPrices, lastPrices, exposedBars, n)
 	}
 
-	return result
+	result.TotalTrades = len(result.Trades)
+	result.WinRate = result.Metrics.WinRate
+	result.ProfitLoss = sim.Equity() - cfg.InitialBalance
+	result.Costs = sim.Costs()
+	result.GrossProfitLoss = result.ProfitLoss + result.Costs.Total()
+	return result, nil
 }
+
+/*
+*  symbolResults breaks a portfolio's fills down by symbol. A symbol's
+*  ProfitLoss is the USDT its fills brought in net of fees, plus what it
+*  still holds at the last price.
+ */
+func symbolResults(pairs []string, trades []models.Trade, firstPrices, lastPrices map[string]float64, exposedBars map[string]int, bars int) map[string]SymbolResult {
+	results := make(map[string]SymbolResult, len(pairs))
+	for _, pair := range pairs {
+		var own []models.Trade
+		var held float64
+		r := SymbolResult{Exposure: float64(exposedBars[pair]) / float64(bars) * 100}
+		for _, trade := range trades {
+			if trade.Symbol != pair || trade.Status == "CANCELED" {
+				continue
+			}
+			own = append(own, trade)
+			if trade.Side == "BUY" {
+				/* Buys pay their fee in the base asset */
+				r.ProfitLoss -= trade.Value
+				if trade.Price > 0 {
+					held += trade.Quantity - trade.Fee/trade.Price
+				}
+			} else {
+				r.ProfitLoss += trade.Value - trade.Fee
+				held -= trade.Quantity
+			}
+		}
+		r.ProfitLoss += held * lastPrices[pair]
+		r.Trades = len(own)
+		closed := closedTrades(own)
+		r.ClosedTrades = len(closed)
+		if len(closed) > 0 {
+			wins := 0
+			for _, pnl := range closed {
+				if pnl > 0 {
+					wins++
+				}
+			}
+			r.WinRate = float64(wins) / float64(len(closed)) * 100
+		}
+		if firstPrices[pair] > 0 {
+			r.BuyAndHold = (lastPrices[pair]/firstPrices[pair] - 1) * 100
+		}
+		results[pair] = r
+	}
+	return results
+}
+
+/*
+	RunMulti
+
+*  replays several symbols through a multi-symbol strategy, e.g. pairs,
+*  the way the bot trades it: one engine on one SimExchange, the
+*  strategy runs on its first symbol and trades the others as its legs.
+*  Fills, stops and costs are those of RunPortfolio, and so are the
+*  per-symbol results. The engine trades spot, so strategies that sell
+*  short (pairs in hedge mode) are rejected.
+*
+*  Candles are matched by open time, times missing from any symbol
+*  are skipped.
+*/
+func RunMulti(data map[string][]models.Kline, strat strategy.MultiSymbol, cfg Config) (Result, error) {
+	symbols := strat.Symbols()
+	if len(symbols) == 0 {
+		return Result{}, fmt.Errorf("no symbols to backtest")
+	}
+	candles, times, err := alignCandles(data, symbols)
+	if err != nil {
+		return Result{}, err
+	}
+
+	/* The legs run no strategy of their own */
+	strategies := map[string]strategy.Strategy{symbols[0]: strat}
+	for _, symbol := range symbols[1:] {
+		strategies[symbol] = leg{}
+	}
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": cfg.InitialBalance}, cfg.Costs)
+	sim.Intrabar = cfg.Intrabar
+	return simulate(cfg, symbols, strategies, sim, len(times), func(i int) {
+		for _, symbol := range symbols {
+			sim.AddCandle(symbol, candles[symbol][times[i]])
+		}
+	}, nil)
+}
+
+/* leg stands in for the strategy of a symbol a multi-symbol strategy trades */
+type leg struct{}
+
+func (leg) Analyze(*models.MarketData) *models.Signal { return nil }
@@ -0,0 +1,152 @@
+package backtest
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+func TestRunPortfolio(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	/* Two sine waves out of phase, ETH misses a candle */
+	data := make(map[string][]models.Kline)
+	for i := 0; i < 600; i++ {
+		for symbol, phase := range map[string]float64{"BTCUSDT": 0, "ETHUSDT": 2} {
+			if symbol == "ETHUSDT" && i == 300 {
+				continue
+			}
+			price := 100 + 5*math.Sin(float64(i)/15+phase)
+			data[symbol] = append(data[symbol], models.Kline{
+				OpenTime: int64(i) * 60000, CloseTime: int64(i)*60000 + 59999,
+				Open: price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 1000,
+			})
+		}
+	}
+	strategies := make(map[string]strategy.Strategy)
+	for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+		s, err := strategy.NewFromSpec("mean_reversion{history: 30, take_profit_pct: 2}")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		strategies[symbol] = s
+	}
+	cfg := DefaultConfig()
+	cfg.MaxExposure = 0.6
+
+	result, err := RunPortfolio(data, []string{"BTCUSDT", "ETHUSDT"}, strategies, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Equity) != 600 {
+		t.Errorf("Expected 599 shared candles and the start, got %d points", len(result.Equity))
+	}
+	if len(result.Symbols) != 2 || result.Regimes != nil {
+		t.Fatalf("Expected per-symbol results and no regimes, got %+v", result.Symbols)
+	}
+
+	var sum float64
+	for symbol, r := range result.Symbols {
+		if r.Trades == 0 {
+			t.Errorf("Expected %s to trade", symbol)
+		}
+		sum += r.ProfitLoss
+	}
+	if math.Abs(sum-result.ProfitLoss) > 1e-6 {
+		t.Errorf("Expected the symbols to add up to %.4f, got %.4f", result.ProfitLoss, sum)
+	}
+}
+
+func TestRunMulti(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	/* BTC tracks twice ETH, then drops 5% against it and jumps 8% above */
+	data := make(map[string][]models.Kline)
+	for i := 0; i < 80; i++ {
+		eth := 100 + 10*math.Sin(float64(i)/5)
+		btc := 2 * eth * (1 + 0.002*math.Sin(float64(i)*1.7))
+		switch i {
+		case 60:
+			btc, eth = 2*100*0.95, 100
+		case 61:
+			btc, eth = 2*100*1.08, 100
+		}
+		for symbol, price := range map[string]float64{"BTCUSDT": btc, "ETHUSDT": eth} {
+			data[symbol] = append(data[symbol], models.Kline{
+				OpenTime: int64(i) * 60000, CloseTime: int64(i)*60000 + 59999,
+				Open: price, High: price, Low: price, Close: price, Volume: 1000,
+			})
+		}
+	}
+	newPairs := func(mode string) strategy.MultiSymbol {
+		s, err := strategy.NewFromSpec("pairs{a: BTCUSDT, b: ETHUSDT, window: 50, entry_z: 2, exit_z: 0.5, stop_z: 0, mode: " + mode + "}")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return s.(strategy.MultiSymbol)
+	}
+
+	result, err := RunMulti(data, newPairs("rotation"), DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* Bought BTC, then rotated into ETH through the engine */
+	trades := result.Trades
+	if len(trades) < 3 {
+		t.Fatalf("Expected at least 3 trades, got %+v", trades)
+	}
+	for i, want := range []struct{ symbol, side string }{{"BTCUSDT", "BUY"}, {"BTCUSDT", "SELL"}, {"ETHUSDT", "BUY"}} {
+		if trades[i].Symbol != want.symbol || trades[i].Side != want.side {
+			t.Errorf("Expected trade %d to be %s %s, got %s %s", i, want.side, want.symbol, trades[i].Side, trades[i].Symbol)
+		}
+	}
+	if trades[1].Quantity < trades[0].Quantity*0.99 || trades[0].Status != "CLOSED" {
+		t.Errorf("Expected the rotation to sell the whole BTC position, got %+v", trades[1])
+	}
+	if len(result.Symbols) != 2 || result.Costs.Fees == 0 {
+		t.Errorf("Expected per-symbol results and fees, got %+v", result)
+	}
+
+	if _, err := RunMulti(data, newPairs("hedge"), DefaultConfig()); err == nil {
+		t.Errorf("Expected hedge mode to be rejected")
+	}
+}
+
+func TestRunRulesReentersAfterTakeProfit(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	/* Dips to 94 buy, the 2% target fills on the way back up */
+	var data []models.Kline
+	for i := 0; i < 20; i++ {
+		price := []float64{100, 94, 97, 99, 100}[i%5]
+		data = append(data, models.Kline{
+			OpenTime: int64(i) * 60000, CloseTime: int64(i)*60000 + 59999,
+			Open: price, High: price, Low: price, Close: price, Volume: 1000,
+		})
+	}
+	s, err := strategy.NewFromSpec(`rules{entry: "close < 95", take_profit: "close * 1.02"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.Costs = exchange.Costs{}
+
+	result, err := Run(data, s, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buys := 0
+	for _, trade := range result.Trades {
+		if trade.Side == "BUY" {
+			buys++
+		}
+	}
+	if buys != 4 || len(result.Closed) != 4 {
+		t.Errorf("Expected a round trip on every dip, got %d buys and %d closed trades", buys, len(result.Closed))
+	}
+}
@@ -0,0 +1,227 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	DriftConfig
+
+*  - Tolerance: how far apart in time a live and a simulated trade may
+*    be and still be the same trade
+*  - Start: simulated trades before it only warmed up the strategy and
+*    are left out, with the sells closing their positions. Live sells
+*    of positions bought before it are left out the same way. Zero
+*    keeps them all.
+*/
+type DriftConfig struct {
+	Tolerance time.Duration
+	Start     time.Time
+}
+
+/*
+	TradeMatch
+
+*  a live trade and the simulated trade it made
+*  - Delay: live time minus simulated time
+*  - Slippage: how much worse the live price was in bps of the
+*    simulated price, negative when live did better
+*  - SlippageCost: the same in USDT over the live quantity
+*/
+type TradeMatch struct {
+	Live         models.Trade
+	Simulated    models.Trade
+	Delay        time.Duration
+	Slippage     float64
+	SlippageCost float64
+}
+
+/*
+	Drift
+
+*  how live trading differed from a backtest of the same period
+*  - Missed: simulated trades live never made
+*  - Extra: live trades the backtest never made
+*  - LivePnL, SimulatedPnL: PnL of the closed trades, net of fees
+*  - PnLDrift: LivePnL minus SimulatedPnL
+*  - MissedPnL, ExtraPnL: PnL of the missed and the extra sells, how
+*    much of the drift they explain
+*  - AvgSlippage (bps), SlippageCost (USDT), AvgDelay: over the matches
+*  - MatchRate: % of simulated trades live made, 0 without any
+*/
+type Drift struct {
+	Matched      []TradeMatch
+	Missed       []models.Trade
+	Extra        []models.Trade
+	LivePnL      float64
+	SimulatedPnL float64
+	PnLDrift     float64
+	MissedPnL    float64
+	ExtraPnL     float64
+	AvgSlippage  float64
+	SlippageCost float64
+	AvgDelay     time.Duration
+	MatchRate    float64
+}
+
+/*
+	CompareTrades
+
+*  aligns the trades the bot made live (the trades table) with the
+*  trades a backtest of the same period made (Result.Trades). A live
+*  trade matches the closest unmatched simulated trade of its symbol
+*  and side within the tolerance; what is left over on either side was
+*  missed or extra. Canceled orders are not trades and are ignored.
+*/
+func CompareTrades(live, simulated []models.Trade, cfg DriftConfig) Drift {
+	var d Drift
+	livePnLs, simulatedPnLs := closingPnLs(live), closingPnLs(simulated)
+
+	type candidate struct {
+		index int
+		trade models.Trade
+	}
+	var pending []candidate
+	warmup := make(map[string]bool)
+	for i, trade := range simulated {
+		if trade.Status == "CANCELED" {
+			continue
+		}
+		if trade.Timestamp.Before(cfg.Start) || warmup[trade.PositionID] {
+			if trade.PositionID != "" {
+				warmup[trade.PositionID] = true
+			}
+			continue
+		}
+		pending = append(pending, candidate{i, trade})
+		d.SimulatedPnL += simulatedPnLs[i]
+	}
+	simulatedCount := len(pending)
+
+	/* A live sell counts only when its position was bought in the period too */
+	bought := make(map[string]bool)
+	for _, trade := range live {
+		if trade.Side == "BUY" && trade.Status != "CANCELED" && !trade.Timestamp.Before(cfg.Start) {
+			bought[trade.PositionID] = true
+		}
+	}
+	order := make([]int, 0, len(live))
+	for i, trade := range live {
+		if trade.Status == "CANCELED" || trade.Timestamp.Before(cfg.Start) {
+			continue
+		}
+		if trade.Side == "SELL" && trade.PositionID != "" && !bought[trade.PositionID] {
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return live[order[a]].Timestamp.Before(live[order[b]].Timestamp) })
+
+	var delay time.Duration
+	for _, i := range order {
+		trade := live[i]
+		d.LivePnL += livePnLs[i]
+
+		best := -1
+		for j, c := range pending {
+			if c.trade.Symbol != trade.Symbol || c.trade.Side != trade.Side {
+				continue
+			}
+			gap := absDuration(trade.Timestamp.Sub(c.trade.Timestamp))
+			if gap <= cfg.Tolerance && (best < 0 || gap < absDuration(trade.Timestamp.Sub(pending[best].trade.Timestamp))) {
+				best = j
+			}
+		}
+		if best < 0 {
+			d.Extra = append(d.Extra, trade)
+			d.ExtraPnL += livePnLs[i]
+			continue
+		}
+
+		sim := pending[best].trade
+		pending = append(pending[:best], pending[best+1:]...)
+		match := TradeMatch{Live: trade, Simulated: sim, Delay: trade.Timestamp.Sub(sim.Timestamp)}
+		worse := trade.Price - sim.Price
+		if trade.Side == "SELL" {
+			worse = -worse
+		}
+		if sim.Price > 0 {
+			match.Slippage = worse / sim.Price * 10000
+		}
+		match.SlippageCost = worse * trade.Quantity
+		d.Matched = append(d.Matched, match)
+		d.AvgSlippage += match.Slippage
+		d.SlippageCost += match.SlippageCost
+		delay += match.Delay
+	}
+
+	for _, c := range pending {
+		d.Missed = append(d.Missed, c.trade)
+		d.MissedPnL += simulatedPnLs[c.index]
+	}
+	if n := len(d.Matched); n > 0 {
+		d.AvgSlippage /= float64(n)
+		d.AvgDelay = delay / time.Duration(n)
+	}
+	if simulatedCount > 0 {
+		d.MatchRate = float64(len(d.Matched)) / float64(simulatedCount) * 100
+	}
+	d.PnLDrift = d.LivePnL - d.SimulatedPnL
+	return d
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+/*
+*  WriteDriftCSV writes the aligned trades in time order, one row per
+*  match, missed or extra trade
+ */
+func WriteDriftCSV(w io.Writer, d Drift) error {
+	type row struct {
+		at     time.Time
+		record []string
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	stamp := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	var rows []row
+	for _, m := range d.Matched {
+		rows = append(rows, row{m.Simulated.Timestamp, []string{"matched", m.Live.Symbol, m.Live.Side,
+			stamp(m.Simulated.Timestamp), format(m.Simulated.Price), format(m.Simulated.Quantity),
+			stamp(m.Live.Timestamp), format(m.Live.Price), format(m.Live.Quantity),
+			format(m.Delay.Seconds()), format(m.Slippage), format(m.SlippageCost)}})
+	}
+	for _, t := range d.Missed {
+		rows = append(rows, row{t.Timestamp, []string{"missed", t.Symbol, t.Side,
+			stamp(t.Timestamp), format(t.Price), format(t.Quantity), "", "", "", "", "", ""}})
+	}
+	for _, t := range d.Extra {
+		rows = append(rows, row{t.Timestamp, []string{"extra", t.Symbol, t.Side,
+			"", "", "", stamp(t.Timestamp), format(t.Price), format(t.Quantity), "", "", ""}})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].at.Before(rows[j].at) })
+
+	out := csv.NewWriter(w)
+	header := []string{"status", "symbol", "side", "simulated_time", "simulated_price", "simulated_quantity",
+		"live_time", "live_price", "live_quantity", "delay_seconds", "slippage_bps", "slippage_usdt"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := out.Write(r.record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
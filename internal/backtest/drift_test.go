@@ -0,0 +1,55 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestCompareTrades(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes float64) time.Time { return start.Add(time.Duration(minutes * float64(time.Minute))) }
+	trade := func(id, side string, minutes, price, pnl float64) models.Trade {
+		return models.Trade{PositionID: id, Symbol: "BTCUSDT", Side: side, Price: price, Quantity: 1, Timestamp: at(minutes), PnL: pnl}
+	}
+
+	simulated := []models.Trade{
+		trade("w", "BUY", -5, 90, 0), // Warmup, left out with its sell
+		trade("w", "SELL", 2, 95, 5),
+		trade("a", "BUY", 1, 100, 0),
+		trade("a", "SELL", 10, 110, 10),
+		trade("b", "BUY", 20, 100, 0), // Missed live
+		trade("b", "SELL", 30, 105, 5),
+	}
+	live := []models.Trade{
+		trade("v", "SELL", 2.5, 95, 3), // Bought before the period, left out like the warmup
+		trade("x", "BUY", 1.5, 100.5, 0),
+		trade("x", "SELL", 10.5, 109, 8.5),
+		trade("y", "BUY", 40, 100, 0), // The backtest never bought here
+		trade("y", "SELL", 50, 98, -2),
+	}
+
+	d := CompareTrades(live, simulated, DriftConfig{Tolerance: 2 * time.Minute, Start: start})
+	if len(d.Matched) != 2 || len(d.Missed) != 2 || len(d.Extra) != 2 {
+		t.Fatalf("Expected 2 matched, 2 missed and 2 extra trades, got %d, %d and %d", len(d.Matched), len(d.Missed), len(d.Extra))
+	}
+
+	/* Bought 50 bps higher and sold ~91 bps lower than simulated */
+	if got := d.Matched[0].Slippage; math.Abs(got-50) > 1e-9 {
+		t.Errorf("Expected 50 bps of buy slippage, got %.4f", got)
+	}
+	if got := d.Matched[1].Slippage; math.Abs(got-1/110.0*10000) > 1e-9 {
+		t.Errorf("Expected %.4f bps of sell slippage, got %.4f", 1/110.0*10000, got)
+	}
+	if d.SlippageCost != 1.5 || d.AvgDelay != 30*time.Second {
+		t.Errorf("Expected 1.5 USDT of slippage and 30s of delay, got %.4f and %s", d.SlippageCost, d.AvgDelay)
+	}
+	if d.SimulatedPnL != 15 || d.LivePnL != 6.5 || d.PnLDrift != -8.5 {
+		t.Errorf("Expected PnL 6.5 live vs 15 simulated, got %.2f vs %.2f (drift %.2f)", d.LivePnL, d.SimulatedPnL, d.PnLDrift)
+	}
+	if d.MissedPnL != 5 || d.ExtraPnL != -2 || d.MatchRate != 50 {
+		t.Errorf("Expected missed PnL 5, extra PnL -2 and a 50%% match rate, got %.2f, %.2f and %.2f", d.MissedPnL, d.ExtraPnL, d.MatchRate)
+	}
+}
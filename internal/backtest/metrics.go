@@ -0,0 +1,211 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* EquityPoint is the account's value after a bar, in USDT */
+type EquityPoint struct {
+	Time    time.Time
+	Equity  float64
+	Exposed bool // A position was open
+}
+
+/*
+	Metrics
+
+*  the performance report of a backtest. Percentages are in %, money
+*  in USDT, ratios are annualized over 365 days with no risk-free rate:
+*  - TotalReturn / CAGR: return over the run, and per year compounded.
+*    Runs shorter than minCAGRSpan have no CAGR, compounding a few
+*    hours over a year says nothing and overflows.
+*  - Sharpe / Sortino: mean bar return over its deviation, Sortino only
+*    counting the bars that lost
+*  - Calmar: CAGR over the max drawdown
+*  - MaxDrawdown: deepest fall from an equity peak, MaxDrawdownDuration
+*    the longest it took to get back to a peak (or the end of the run)
+*  - ProfitFactor: money won over money lost by closed trades
+*  - Expectancy: average PnL of a closed trade, AvgWin / AvgLoss of the
+*    winners and losers (AvgLoss is negative)
+*  - Exposure: share of bars a position was open
+*  - TradesBySide: fills per side (BUY, SELL)
+*  - BuyAndHold: return of holding the traded symbols instead
+*
+*  Ratios that are undefined (no losing bar, no drawdown, no losing
+*  trade) are 0.
+*/
+type Metrics struct {
+	Start               time.Time
+	End                 time.Time
+	TotalReturn         float64
+	CAGR                float64
+	Sharpe              float64
+	Sortino             float64
+	Calmar              float64
+	MaxDrawdown         float64
+	MaxDrawdownDuration time.Duration
+	ClosedTrades        int
+	WinRate             float64
+	ProfitFactor        float64
+	Expectancy          float64
+	AvgWin              float64
+	AvgLoss             float64
+	Exposure            float64
+	TradesBySide        map[string]int
+	BuyAndHold          float64
+}
+
+const year = 365 * 24 * time.Hour
+
+/* minCAGRSpan is the shortest run CAGR is annualized from */
+const minCAGRSpan = 30 * 24 * time.Hour
+
+/*
+	ComputeMetrics
+
+*  measures an equity curve, whose first point is the initial balance,
+*  and the PnL of its closed trades. TradesBySide and BuyAndHold are
+*  left to the caller, who knows the fills and the market.
+*/
+func ComputeMetrics(equity []EquityPoint, closed []float64) Metrics {
+	var m Metrics
+	m.ClosedTrades = len(closed)
+	var won, lost float64
+	wins := 0
+	for _, pnl := range closed {
+		if pnl > 0 {
+			won += pnl
+			wins++
+		} else {
+			lost += pnl
+		}
+	}
+	if len(closed) > 0 {
+		m.WinRate = float64(wins) / float64(len(closed)) * 100
+		m.Expectancy = (won + lost) / float64(len(closed))
+	}
+	if wins > 0 {
+		m.AvgWin = won / float64(wins)
+	}
+	if losses := len(closed) - wins; losses > 0 {
+		m.AvgLoss = lost / float64(losses)
+	}
+	if lost < 0 {
+		m.ProfitFactor = won / -lost
+	}
+
+	if len(equity) < 2 || equity[0].Equity <= 0 {
+		return m
+	}
+	first, last := equity[0], equity[len(equity)-1]
+	m.Start, m.End = first.Time, last.Time
+	m.TotalReturn = (last.Equity/first.Equity - 1) * 100
+	elapsed := last.Time.Sub(first.Time)
+	if elapsed >= minCAGRSpan && last.Equity > 0 {
+		cagr := (math.Pow(last.Equity/first.Equity, float64(year)/float64(elapsed)) - 1) * 100
+		if !math.IsInf(cagr, 0) && !math.IsNaN(cagr) {
+			m.CAGR = cagr
+		}
+	}
+
+	/* Drawdowns */
+	peak, peakTime, underwater := first.Equity, first.Time, false
+	exposed := 0
+	for _, point := range equity[1:] {
+		if point.Exposed {
+			exposed++
+		}
+		if point.Equity < peak {
+			underwater = true
+			if dd := (peak - point.Equity) / peak * 100; dd > m.MaxDrawdown {
+				m.MaxDrawdown = dd
+			}
+		} else if !underwater {
+			peak, peakTime = point.Equity, point.Time
+			continue
+		}
+		if d := point.Time.Sub(peakTime); d > m.MaxDrawdownDuration {
+			m.MaxDrawdownDuration = d
+		}
+		if point.Equity >= peak {
+			peak, peakTime, underwater = point.Equity, point.Time, false
+		}
+	}
+	m.Exposure = float64(exposed) / float64(len(equity)-1) * 100
+	if m.MaxDrawdown > 0 {
+		m.Calmar = m.CAGR / m.MaxDrawdown
+	}
+
+	/* Bar returns, annualized by how many bars make a year */
+	returns := make([]float64, 0, len(equity)-1)
+	for i := 1; i < len(equity); i++ {
+		if equity[i-1].Equity > 0 {
+			returns = append(returns, equity[i].Equity/equity[i-1].Equity-1)
+		}
+	}
+	if elapsed <= 0 || len(returns) < 2 {
+		return m
+	}
+	perYear := float64(year) / (float64(elapsed) / float64(len(returns)))
+	mean, variance, downside := 0.0, 0.0, 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	if std := math.Sqrt(variance / float64(len(returns)-1)); std > 0 {
+		m.Sharpe = mean / std * math.Sqrt(perYear)
+	}
+	if dev := math.Sqrt(downside / float64(len(returns))); dev > 0 {
+		m.Sortino = mean / dev * math.Sqrt(perYear)
+	}
+	return m
+}
+
+/*
+*  closedTrades returns the PnL of every sell that closed a buy, net of
+*  the sell's fee and its share of the buy's fee
+ */
+func closedTrades(trades []models.Trade) []float64 {
+	pnls := closingPnLs(trades)
+	var closed []float64
+	for i := range trades {
+		if pnl, ok := pnls[i]; ok {
+			closed = append(closed, pnl)
+		}
+	}
+	return closed
+}
+
+/*
+*  closingPnLs returns the net PnL of closedTrades by the index of the
+*  sell. The buys of a position (several for grid and DCA) are summed.
+ */
+func closingPnLs(trades []models.Trade) map[int]float64 {
+	buys := make(map[string]models.Trade)
+	closed := make(map[int]float64)
+	for i, trade := range trades {
+		switch {
+		case trade.Side == "BUY" && trade.Status != "CANCELED":
+			buy := buys[trade.PositionID]
+			buy.Quantity += trade.Quantity
+			buy.Fee += trade.Fee
+			buys[trade.PositionID] = buy
+		case trade.Side == "SELL" && trade.PositionID != "":
+			pnl := trade.PnL - trade.Fee
+			if buy, ok := buys[trade.PositionID]; ok && buy.Quantity > 0 {
+				pnl -= buy.Fee * math.Min(trade.Quantity/buy.Quantity, 1)
+			}
+			closed[i] = pnl
+		}
+	}
+	return closed
+}
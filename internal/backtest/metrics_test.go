@@ -0,0 +1,65 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var equity []EquityPoint
+	for i, value := range []float64{1000, 1100, 990, 1045, 1100, 1210} {
+		equity = append(equity, EquityPoint{Time: start.Add(time.Duration(i) * time.Hour), Equity: value, Exposed: i == 1 || i == 2})
+	}
+	m := ComputeMetrics(equity, []float64{30, -10, 20, -10})
+
+	checks := []struct {
+		name      string
+		got, want float64
+	}{
+		{"total return", m.TotalReturn, 21},
+		{"max drawdown", m.MaxDrawdown, 10},
+		{"max drawdown hours", m.MaxDrawdownDuration.Hours(), 3},
+		{"exposure", m.Exposure, 40},
+		{"win rate", m.WinRate, 50},
+		{"profit factor", m.ProfitFactor, 2.5},
+		{"expectancy", m.Expectancy, 7.5},
+		{"average win", m.AvgWin, 25},
+		{"average loss", m.AvgLoss, -10},
+	}
+	for _, c := range checks {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("Expected %s %.4f, got %.4f", c.name, c.want, c.got)
+		}
+	}
+	if m.Sharpe <= 0 || m.Sortino <= m.Sharpe {
+		t.Errorf("Unexpected ratios: Sharpe %.2f, Sortino %.2f", m.Sharpe, m.Sortino)
+	}
+
+	/* 5 hours are too short to annualize */
+	if m.CAGR != 0 || m.Calmar != 0 {
+		t.Errorf("Expected no CAGR and Calmar over 5 hours, got %.2f and %.2f", m.CAGR, m.Calmar)
+	}
+
+	/* The same curve over 60 days: 21% compounds to about 219% a year */
+	for i := range equity {
+		equity[i].Time = start.Add(time.Duration(i) * 12 * 24 * time.Hour)
+	}
+	m = ComputeMetrics(equity, nil)
+	if want := (math.Pow(1.21, 365.0/60) - 1) * 100; math.Abs(m.CAGR-want) > 1e-9 || math.Abs(m.Calmar-want/10) > 1e-9 {
+		t.Errorf("Expected CAGR %.4f and Calmar %.4f, got %.4f and %.4f", want, want/10, m.CAGR, m.Calmar)
+	}
+
+	/* Two partial sells each carry half of the buy's fee */
+	closed := closedTrades([]models.Trade{
+		{Side: "BUY", PositionID: "p1", Quantity: 2, Fee: 1},
+		{Side: "SELL", PositionID: "p1", Quantity: 1, PnL: 10, Fee: 0.5},
+		{Side: "SELL", PositionID: "p1", Quantity: 1, PnL: -4, Fee: 0.5},
+	})
+	if len(closed) != 2 || closed[0] != 9 || closed[1] != -5 {
+		t.Errorf("Expected closed trades [9 -5], got %v", closed)
+	}
+}
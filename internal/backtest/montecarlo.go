@@ -0,0 +1,189 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+/* Resampling is how a Monte Carlo run reorders a backtest's trades */
+type Resampling int
+
+const (
+	Shuffle   Resampling = iota // The same trades in a random order
+	Bootstrap                   // As many trades drawn at random, with replacement
+	Skip                        // The trades in order, each missed with SkipProbability
+)
+
+/* Resamplings lists every resampling method */
+var Resamplings = []Resampling{Shuffle, Bootstrap, Skip}
+
+func (r Resampling) String() string {
+	switch r {
+	case Bootstrap:
+		return "bootstrap"
+	case Skip:
+		return "skip"
+	default:
+		return "shuffle"
+	}
+}
+
+/* ParseResampling parses shuffle, bootstrap or skip */
+func ParseResampling(name string) (Resampling, error) {
+	for _, r := range Resamplings {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return Shuffle, fmt.Errorf("unknown resampling %q (available: shuffle, bootstrap, skip)", name)
+}
+
+/* MonteCarloPercentiles are the percentiles a Distribution reports */
+var MonteCarloPercentiles = []float64{1, 5, 25, 50, 75, 95, 99}
+
+/*
+	MonteCarloConfig
+
+*  - Runs: resampled trade sequences
+*  - Seed: the same seed gives the same runs
+*  - SkipProbability: chance a trade is missed with Skip
+*  - Ruin: % of the initial balance lost at any point that counts as
+*    ruin, e.g. 50
+*/
+type MonteCarloConfig struct {
+	Runs            int
+	Seed            int64
+	Method          Resampling
+	SkipProbability float64
+	Ruin            float64
+}
+
+/* DefaultMonteCarloConfig returns 1000 shuffled runs with ruin at half the balance lost */
+func DefaultMonteCarloConfig() MonteCarloConfig {
+	return MonteCarloConfig{
+		Runs:            1000,
+		Seed:            1,
+		Method:          Shuffle,
+		SkipProbability: 0.1,
+		Ruin:            50,
+	}
+}
+
+/* Distribution summarizes a value over the runs, Percentiles at MonteCarloPercentiles */
+type Distribution struct {
+	Mean        float64
+	Percentiles []float64
+}
+
+/*
+	MonteCarloResult
+
+*  - FinalEquity: equity after the last trade
+*  - MaxDrawdown: deepest % fall from an equity peak
+*  - RiskOfRuin: % of runs that lost Ruin % of the balance at any point
+*  - LossProbability: % of runs that ended below the initial balance
+*/
+type MonteCarloResult struct {
+	Method          Resampling
+	Runs            int
+	Trades          int // Closed trades resampled
+	FinalEquity     Distribution
+	MaxDrawdown     Distribution
+	RiskOfRuin      float64
+	LossProbability float64
+}
+
+/*
+	MonteCarlo
+
+*  resamples the closed trades of a backtest (Result.Closed) to show how
+*  much of its outcome was the luck of their order. Each run replays
+*  the resampled PnLs from the initial balance, as amounts: a trade
+*  makes what it made in the backtest whatever the equity by then.
+*/
+func MonteCarlo(closed []float64, balance float64, cfg MonteCarloConfig) (MonteCarloResult, error) {
+	result := MonteCarloResult{Method: cfg.Method, Runs: cfg.Runs, Trades: len(closed)}
+	if cfg.Runs <= 0 {
+		return result, fmt.Errorf("no Monte Carlo runs")
+	}
+	if len(closed) == 0 {
+		return result, fmt.Errorf("no closed trades to resample")
+	}
+	if balance <= 0 {
+		return result, fmt.Errorf("need a positive initial balance")
+	}
+	if cfg.Method == Skip && (cfg.SkipProbability < 0 || cfg.SkipProbability >= 1) {
+		return result, fmt.Errorf("skip probability must be in [0, 1)")
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	ruin := balance * (1 - cfg.Ruin/100)
+	finals := make([]float64, cfg.Runs)
+	drawdowns := make([]float64, cfg.Runs)
+	sequence := make([]float64, len(closed))
+	var ruined, losses int
+	for run := 0; run < cfg.Runs; run++ {
+		sequence = sequence[:0]
+		switch cfg.Method {
+		case Shuffle:
+			sequence = append(sequence, closed...)
+			rng.Shuffle(len(sequence), func(i, j int) { sequence[i], sequence[j] = sequence[j], sequence[i] })
+		case Bootstrap:
+			for range closed {
+				sequence = append(sequence, closed[rng.Intn(len(closed))])
+			}
+		case Skip:
+			for _, pnl := range closed {
+				if rng.Float64() >= cfg.SkipProbability {
+					sequence = append(sequence, pnl)
+				}
+			}
+		}
+
+		equity, peak, isRuined := balance, balance, false
+		for _, pnl := range sequence {
+			equity += pnl
+			if equity > peak {
+				peak = equity
+			}
+			if dd := (peak - equity) / peak * 100; dd > drawdowns[run] {
+				drawdowns[run] = dd
+			}
+			if cfg.Ruin > 0 && equity <= ruin {
+				isRuined = true
+			}
+		}
+		finals[run] = equity
+		if isRuined {
+			ruined++
+		}
+		if equity < balance {
+			losses++
+		}
+	}
+
+	result.FinalEquity = distribution(finals)
+	result.MaxDrawdown = distribution(drawdowns)
+	result.RiskOfRuin = float64(ruined) / float64(cfg.Runs) * 100
+	result.LossProbability = float64(losses) / float64(cfg.Runs) * 100
+	return result, nil
+}
+
+/* distribution sorts values and interpolates MonteCarloPercentiles from them */
+func distribution(values []float64) Distribution {
+	sort.Float64s(values)
+	var d Distribution
+	for _, v := range values {
+		d.Mean += v
+	}
+	d.Mean /= float64(len(values))
+	for _, p := range MonteCarloPercentiles {
+		rank := p / 100 * float64(len(values)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+		d.Percentiles = append(d.Percentiles, values[lower]+(values[upper]-values[lower])*(rank-float64(lower)))
+	}
+	return d
+}
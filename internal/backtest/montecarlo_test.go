@@ -0,0 +1,48 @@
+package backtest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMonteCarlo(t *testing.T) {
+	closed := []float64{300, -600, 200, -100, 400}
+	cfg := DefaultMonteCarloConfig()
+	cfg.Runs = 500
+
+	/* Shuffling changes the path, not where it ends */
+	shuffled, err := MonteCarlo(closed, 1000, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range shuffled.FinalEquity.Percentiles {
+		if math.Abs(p-1200) > 1e-9 {
+			t.Fatalf("Expected every shuffle to end at 1200, got %v", shuffled.FinalEquity.Percentiles)
+		}
+	}
+	/* -600 first is a 60% drawdown and ruin, after +300 it is 46% */
+	if shuffled.RiskOfRuin <= 0 || shuffled.RiskOfRuin >= 100 || shuffled.MaxDrawdown.Percentiles[len(MonteCarloPercentiles)-1] < 60-1e-9 {
+		t.Errorf("Unexpected risk of ruin %.2f%% and drawdowns %v", shuffled.RiskOfRuin, shuffled.MaxDrawdown.Percentiles)
+	}
+
+	again, _ := MonteCarlo(closed, 1000, cfg)
+	if !reflect.DeepEqual(shuffled, again) {
+		t.Errorf("Expected the same seed to give the same runs")
+	}
+
+	cfg.Method = Bootstrap
+	boot, err := MonteCarlo(closed, 1000, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := boot.FinalEquity.Percentiles; p[0] >= p[len(p)-1] || boot.LossProbability <= 0 {
+		t.Errorf("Expected bootstrapped final equity to spread, got %v", p)
+	}
+
+	cfg.Method, cfg.SkipProbability = Skip, 0
+	skipped, _ := MonteCarlo(closed, 1000, cfg)
+	if skipped.FinalEquity.Mean != 1200 || skipped.RiskOfRuin != 0 || math.Abs(skipped.MaxDrawdown.Mean-600.0/1300*100) > 1e-9 {
+		t.Errorf("Expected skipping nothing to replay the backtest, got %+v", skipped)
+	}
+}
@@ -0,0 +1,290 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+/* MaxTrials caps the combinations of a sweep */
+const MaxTrials = 100000
+
+/* ParamRange is the values a strategy parameter takes in a sweep */
+type ParamRange struct {
+	Name   string
+	Values []string
+}
+
+/*
+	ParseParamRange
+
+*  parses a parameter range:
+*  - rsi_period=10:20:2    from 10 to 20 in steps of 2
+*  - oversold=20,25,35     a list of values
+*  - mode=hedge            a single value
+*/
+func ParseParamRange(text string) (ParamRange, error) {
+	name, values, ok := strings.Cut(text, "=")
+	name, values = strings.TrimSpace(name), strings.TrimSpace(values)
+	if !ok || name == "" || values == "" {
+		return ParamRange{}, fmt.Errorf("invalid parameter range %q: use name=from:to:step or name=a,b,c", text)
+	}
+	r := ParamRange{Name: name}
+
+	if parts := strings.Split(values, ":"); len(parts) == 3 {
+		var bounds [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return r, fmt.Errorf("invalid parameter range %q: %v", text, err)
+			}
+			bounds[i] = v
+		}
+		from, to, step := bounds[0], bounds[1], bounds[2]
+		if step <= 0 || to < from {
+			return r, fmt.Errorf("invalid parameter range %q: need from <= to and a positive step", text)
+		}
+		for i := 0; ; i++ {
+			v := from + float64(i)*step
+			if v > to+step*1e-9 {
+				break
+			}
+			if len(r.Values) >= MaxTrials {
+				return r, fmt.Errorf("parameter range %q has more than %d values", text, MaxTrials)
+			}
+			r.Values = append(r.Values, strconv.FormatFloat(math.Round(v*1e9)/1e9, 'f', -1, 64))
+		}
+		return r, nil
+	}
+
+	for _, v := range strings.Split(values, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			r.Values = append(r.Values, v)
+		}
+	}
+	return r, nil
+}
+
+/* Objective scores a backtest, higher is better */
+type Objective func(Result) float64
+
+var objectives = map[string]Objective{
+	"net_profit":    func(r Result) float64 { return r.ProfitLoss },
+	"sharpe":        func(r Result) float64 { return r.Metrics.Sharpe },
+	"sortino":       func(r Result) float64 { return r.Metrics.Sortino },
+	"calmar":        func(r Result) float64 { return r.Metrics.Calmar },
+	"cagr":          func(r Result) float64 { return r.Metrics.CAGR },
+	"profit_factor": func(r Result) float64 { return r.Metrics.ProfitFactor },
+	"expectancy":    func(r Result) float64 { return r.Metrics.Expectancy },
+	"win_rate":      func(r Result) float64 { return r.Metrics.WinRate },
+}
+
+/* ObjectiveNames lists the objectives ParseObjective knows */
+func ObjectiveNames() []string {
+	names := make([]string, 0, len(objectives))
+	for name := range objectives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* ParseObjective looks up an objective by name, e.g. sharpe or net_profit */
+func ParseObjective(name string) (Objective, error) {
+	objective, ok := objectives[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown objective %q (available: %s)", name, strings.Join(ObjectiveNames(), ", "))
+	}
+	return objective, nil
+}
+
+/*
+	Trial
+
+*  one backtest of a sweep. Err is set when the combination isn't a
+*  valid strategy (e.g. oversold above overbought) or the backtest
+*  failed. The result's equity curve and trades are dropped to keep big
+*  sweeps in memory.
+*/
+type Trial struct {
+	Params map[string]string // The swept parameters
+	Spec   string            // The full strategy spec
+	Result Result
+	Score  float64
+	Err    error
+}
+
+/*
+	Optimize
+
+*  backtests every combination of the ranges on the base strategy spec,
+*  e.g. mean_reversion{history: 100}, whose own parameters stay fixed.
+*  run backtests one strategy, on data loaded once by the caller, and
+*  is called from workers goroutines at a time (0 = one per CPU), so it
+*  must not share state between calls.
+*
+*  Returns the trials ranked by the objective, best first, failed
+*  trials last.
+*/
+func Optimize(base string, ranges []ParamRange, objective Objective, workers int, run func(strategy.Strategy) (Result, error)) ([]Trial, error) {
+	spec, err := strategy.ParseSpec(base)
+	if err != nil {
+		return nil, err
+	}
+	combinations := 1
+	for _, r := range ranges {
+		if len(r.Values) == 0 {
+			return nil, fmt.Errorf("parameter %s has no values", r.Name)
+		}
+		if combinations *= len(r.Values); combinations > MaxTrials {
+			return nil, fmt.Errorf("more than %d combinations, narrow the ranges", MaxTrials)
+		}
+	}
+
+	trials := make([]Trial, combinations)
+	for i := range trials {
+		params := make(map[string]string, len(spec.Params)+len(ranges))
+		for k, v := range spec.Params {
+			params[k] = v
+		}
+		trial := Trial{Params: make(map[string]string, len(ranges))}
+		rest := i
+		for j := len(ranges) - 1; j >= 0; j-- {
+			value := ranges[j].Values[rest%len(ranges[j].Values)]
+			rest /= len(ranges[j].Values)
+			params[ranges[j].Name] = value
+			trial.Params[ranges[j].Name] = value
+		}
+		trial.Spec = strategy.Spec{Name: spec.Name, Params: params}.String()
+		trials[i] = trial
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				trial := &trials[i]
+				strat, err := strategy.NewFromSpec(trial.Spec)
+				if err != nil {
+					trial.Err = err
+					continue
+				}
+				if trial.Result, trial.Err = run(strat); trial.Err == nil {
+					trial.Score = objective(trial.Result)
+					trial.Result.Equity, trial.Result.Trades = nil, nil
+				}
+			}
+		}()
+	}
+	for i := range trials {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(trials, func(i, j int) bool {
+		if (trials[i].Err == nil) != (trials[j].Err == nil) {
+			return trials[i].Err == nil
+		}
+		return trials[i].Score > trials[j].Score
+	})
+	return trials, nil
+}
+
+/* trialColumns are the result columns of an exported sweep, after the parameters */
+var trialColumns = []string{"score", "net_profit", "gross_profit", "costs", "trades", "closed_trades", "win_rate",
+	"total_return", "cagr", "sharpe", "sortino", "calmar", "max_drawdown", "max_drawdown_hours",
+	"profit_factor", "expectancy", "exposure", "buy_and_hold", "error"}
+
+func trialValues(t Trial) []float64 {
+	m := t.Result.Metrics
+	return []float64{t.Score, t.Result.ProfitLoss, t.Result.GrossProfitLoss, t.Result.Costs.Total(),
+		float64(t.Result.TotalTrades), float64(m.ClosedTrades), m.WinRate, m.TotalReturn, m.CAGR,
+		m.Sharpe, m.Sortino, m.Calmar, m.MaxDrawdown, m.MaxDrawdownDuration.Hours(),
+		m.ProfitFactor, m.Expectancy, m.Exposure, m.BuyAndHold}
+}
+
+/* sweptParams returns the parameter names of the trials in a stable order */
+func sweptParams(trials []Trial) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range trials {
+		for name := range t.Params {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* WriteTrialsCSV writes ranked trials as CSV, one row per trial */
+func WriteTrialsCSV(w io.Writer, trials []Trial) error {
+	params := sweptParams(trials)
+	out := csv.NewWriter(w)
+	header := append(append([]string{"rank"}, params...), trialColumns...)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for i, t := range trials {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, name := range params {
+			row = append(row, t.Params[name])
+		}
+		for _, v := range trialValues(t) {
+			row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		errText := ""
+		if t.Err != nil {
+			errText = t.Err.Error()
+		}
+		if err := out.Write(append(row, errText)); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+/* WriteTrialsJSON writes ranked trials as a JSON array with the same columns as the CSV */
+func WriteTrialsJSON(w io.Writer, trials []Trial) error {
+	type row struct {
+		Rank    int                `json:"rank"`
+		Spec    string             `json:"spec"`
+		Params  map[string]string  `json:"params"`
+		Results map[string]float64 `json:"results,omitempty"`
+		Error   string             `json:"error,omitempty"`
+	}
+	rows := make([]row, len(trials))
+	for i, t := range trials {
+		rows[i] = row{Rank: i + 1, Spec: t.Spec, Params: t.Params}
+		if t.Err != nil {
+			rows[i].Error = t.Err.Error()
+			continue
+		}
+		rows[i].Results = make(map[string]float64, len(trialColumns)-1)
+		for j, v := range trialValues(t) {
+			rows[i].Results[trialColumns[j]] = v
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
@@ -0,0 +1,102 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+func TestParseParamRange(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"rsi_period=10:16:2", []string{"10", "12", "14", "16"}},
+		{"stop_pct=0.1:0.3:0.1", []string{"0.1", "0.2", "0.3"}},
+		{"mode=hedge, rotation", []string{"hedge", "rotation"}},
+	}
+	for _, tt := range tests {
+		r, err := ParseParamRange(tt.text)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(r.Values, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.text, tt.want, r.Values)
+		}
+	}
+	for _, text := range []string{"rsi_period", "rsi_period=20:10:2", "rsi_period=10:20:0"} {
+		if _, err := ParseParamRange(text); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	/* A slow sine wave, mean reversion has something to trade */
+	var data []models.Kline
+	for i := 0; i < 600; i++ {
+		price := 100 + 5*math.Sin(float64(i)/15)
+		data = append(data, models.Kline{
+			OpenTime: int64(i) * 60000, CloseTime: int64(i)*60000 + 59999,
+			Open: price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 1000,
+		})
+	}
+	ranges := []ParamRange{
+		{Name: "oversold", Values: []string{"20", "30", "80"}},
+		{Name: "rsi_period", Values: []string{"7", "14"}},
+	}
+	objective, err := ParseObjective("net_profit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trials, err := Optimize("mean_reversion{history: 30}", ranges, objective, 4, func(s strategy.Strategy) (Result, error) {
+		return Run(data, s, DefaultConfig())
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(trials) != 6 {
+		t.Fatalf("Expected 6 trials, got %d", len(trials))
+	}
+	for i, trial := range trials {
+		switch {
+		case i < 4 && trial.Err != nil:
+			t.Errorf("Trial %s failed: %v", trial.Spec, trial.Err)
+		case i >= 4 && trial.Err == nil:
+			t.Errorf("Expected oversold 80 above overbought to fail and rank last, got %s", trial.Spec)
+		case i > 0 && i < 4 && trial.Score > trials[i-1].Score:
+			t.Errorf("Trials not ranked by score: %.2f after %.2f", trial.Score, trials[i-1].Score)
+		}
+	}
+	if trials[0].Score != trials[0].Result.ProfitLoss || trials[0].Result.Equity != nil {
+		t.Errorf("Expected the score to be the net profit and the equity curve dropped")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTrialsCSV(&buf, trials); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 7 || rows[0][1] != "oversold" || rows[0][2] != "rsi_period" {
+		t.Errorf("Unexpected CSV: %v (%v)", rows, err)
+	}
+
+	buf.Reset()
+	if err := WriteTrialsJSON(&buf, trials); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 6 || decoded[5]["error"] == nil {
+		t.Errorf("Unexpected JSON: %s (%v)", buf.String(), err)
+	}
+}
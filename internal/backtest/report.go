@@ -0,0 +1,581 @@
+package backtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+/*
+	RunInfo
+
+*  what a backtest ran on, so its report can be reproduced:
+*  - Strategies: the strategy spec per traded symbol
+*  - Config: the simulated account and its costs
+*  - Interval: base candle interval, e.g. 1m
+*  - Source: where the data came from, e.g. a file or binance
+*  - DataHash: hash of the replayed data, see HashCandles
+*  - Version: version of the bot, e.g. its git revision
+*/
+type RunInfo struct {
+	Strategies map[string]string
+	Config     Config
+	Interval   string
+	Source     string
+	DataHash   string
+	Version    string
+}
+
+/*
+	HashCandles
+
+*  returns the SHA-256 of candles, symbols in order, so reports of the
+*  same data carry the same hash
+*/
+func HashCandles(data map[string][]models.Kline) string {
+	symbols := make([]string, 0, len(data))
+	for symbol := range data {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	h := sha256.New()
+	for _, symbol := range symbols {
+		fmt.Fprintf(h, "%s\n", symbol)
+		for _, k := range data[symbol] {
+			fmt.Fprintf(h, "%d,%d,%s,%s,%s,%s,%s\n", k.OpenTime, k.CloseTime, formatFloat(k.Open), formatFloat(k.High),
+				formatFloat(k.Low), formatFloat(k.Close), formatFloat(k.Volume))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+/* ReportRun is the RunInfo of a report, flattened for JSON */
+type ReportRun struct {
+	Strategies        map[string]string            `json:"strategies"`
+	Params            map[string]map[string]string `json:"params"`
+	Interval          string                       `json:"interval,omitempty"`
+	Source            string                       `json:"source,omitempty"`
+	DataHash          string                       `json:"data_hash"`
+	Version           string                       `json:"version,omitempty"`
+	InitialBalance    float64                      `json:"initial_balance"`
+	MinOrderSize      float64                      `json:"min_order_size"`
+	MaxDrawdown       float64                      `json:"max_drawdown"`
+	RiskPerTrade      float64                      `json:"risk_per_trade"`
+	AggressiveFactor  float64                      `json:"aggressive_factor"`
+	EnableCompounding bool                         `json:"enable_compounding"`
+	MaxExposure       float64                      `json:"max_exposure"`
+	MaxSymbolExposure float64                      `json:"max_symbol_exposure"`
+	MakerBps          float64                      `json:"maker_bps"`
+	TakerBps          float64                      `json:"taker_bps"`
+	Spread            string                       `json:"spread"`
+	Slippage          string                       `json:"slippage"`
+	LatencyBars       int                          `json:"latency_bars"`
+	Intrabar          string                       `json:"intrabar"`
+}
+
+/* ReportSummary is the bottom line of a report, money in USDT and percentages in % */
+type ReportSummary struct {
+	Start               time.Time          `json:"start"`
+	End                 time.Time          `json:"end"`
+	FinalEquity         float64            `json:"final_equity"`
+	ProfitLoss          float64            `json:"net_profit"`
+	GrossProfitLoss     float64            `json:"gross_profit"`
+	Fees                float64            `json:"fees"`
+	Spread              float64            `json:"spread"`
+	Slippage            float64            `json:"slippage"`
+	Latency             float64            `json:"latency"`
+	TotalTrades         int                `json:"trades"`
+	ClosedTrades        int                `json:"closed_trades"`
+	WinRate             float64            `json:"win_rate"`
+	TotalReturn         float64            `json:"total_return"`
+	CAGR                float64            `json:"cagr"`
+	Sharpe              float64            `json:"sharpe"`
+	Sortino             float64            `json:"sortino"`
+	Calmar              float64            `json:"calmar"`
+	MaxDrawdown         float64            `json:"max_drawdown"`
+	MaxDrawdownHours    float64            `json:"max_drawdown_hours"`
+	ProfitFactor        float64            `json:"profit_factor"`
+	Expectancy          float64            `json:"expectancy"`
+	AvgWin              float64            `json:"avg_win"`
+	AvgLoss             float64            `json:"avg_loss"`
+	Exposure            float64            `json:"exposure"`
+	BuyAndHold          float64            `json:"buy_and_hold"`
+	TradesBySide        map[string]int     `json:"trades_by_side"`
+	SuppressedByGuard   map[string]int     `json:"suppressed_by_guard,omitempty"`
+	ProfitLossByRegimes map[string]float64 `json:"profit_by_regime,omitempty"`
+}
+
+/* ReportPoint is a point of the equity curve, with its drawdown in % */
+type ReportPoint struct {
+	Time     time.Time `json:"time"`
+	Equity   float64   `json:"equity"`
+	Drawdown float64   `json:"drawdown"`
+	Exposed  bool      `json:"exposed"`
+}
+
+/* ReportTrade is a fill of the trade list */
+type ReportTrade struct {
+	Time       time.Time `json:"time"`
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"`
+	Price      float64   `json:"price"`
+	Quantity   float64   `json:"quantity"`
+	Value      float64   `json:"value"`
+	Fee        float64   `json:"fee"`
+	PnL        float64   `json:"pnl"`
+	PnLPercent float64   `json:"pnl_percent"`
+	PositionID string    `json:"position_id"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason"`
+}
+
+/* ReportMonth is the % return of a calendar month (UTC) */
+type ReportMonth struct {
+	Year   int     `json:"year"`
+	Month  int     `json:"month"`
+	Return float64 `json:"return"`
+}
+
+/* ReportSymbol is a symbol's part of a portfolio report */
+type ReportSymbol struct {
+	Symbol       string  `json:"symbol"`
+	Trades       int     `json:"trades"`
+	ClosedTrades int     `json:"closed_trades"`
+	WinRate      float64 `json:"win_rate"`
+	ProfitLoss   float64 `json:"net_profit"`
+	Exposure     float64 `json:"exposure"`
+	BuyAndHold   float64 `json:"buy_and_hold"`
+}
+
+/*
+	Report
+
+*  a backtest written down to be archived and compared: what ran, the
+*  bottom line, the equity curve with its drawdowns, monthly returns and
+*  every fill. WriteReportJSON and WriteReportHTML write the same report.
+*/
+type Report struct {
+	Generated time.Time      `json:"generated"`
+	Run       ReportRun      `json:"run"`
+	Summary   ReportSummary  `json:"summary"`
+	Symbols   []ReportSymbol `json:"symbols,omitempty"`
+	Monthly   []ReportMonth  `json:"monthly_returns"`
+	Equity    []ReportPoint  `json:"equity"`
+	Trades    []ReportTrade  `json:"trades"`
+}
+
+/* NewReport builds the report of a backtest result and what it ran on */
+func NewReport(result Result, run RunInfo) Report {
+	cfg := run.Config
+	report := Report{
+		Generated: time.Now().UTC(),
+		Run: ReportRun{
+			Strategies:        run.Strategies,
+			Params:            make(map[string]map[string]string, len(run.Strategies)),
+			Interval:          run.Interval,
+			Source:            run.Source,
+			DataHash:          run.DataHash,
+			Version:           run.Version,
+			InitialBalance:    cfg.InitialBalance,
+			MinOrderSize:      cfg.MinOrderSize,
+			MaxDrawdown:       cfg.MaxDrawdown,
+			RiskPerTrade:      cfg.RiskPerTrade,
+			AggressiveFactor:  cfg.AggressiveFactor,
+			EnableCompounding: cfg.EnableCompounding,
+			MaxExposure:       cfg.MaxExposure,
+			MaxSymbolExposure: cfg.MaxSymbolExposure,
+			MakerBps:          cfg.Costs.MakerBps,
+			TakerBps:          cfg.Costs.TakerBps,
+			Spread:            describeCost(cfg.Costs.Spread),
+			Slippage:          describeCost(cfg.Costs.Slippage),
+			LatencyBars:       cfg.Costs.LatencyBars,
+			Intrabar:          cfg.Intrabar.String(),
+		},
+	}
+	for symbol, text := range run.Strategies {
+		if spec, err := strategy.ParseSpec(text); err == nil {
+			report.Run.Params[symbol] = spec.Params
+		}
+	}
+
+	m := result.Metrics
+	final := cfg.InitialBalance
+	if len(result.Equity) > 0 {
+		final = result.Equity[len(result.Equity)-1].Equity
+	}
+	report.Summary = ReportSummary{
+		Start:             m.Start,
+		End:               m.End,
+		FinalEquity:       final,
+		ProfitLoss:        result.ProfitLoss,
+		GrossProfitLoss:   result.GrossProfitLoss,
+		Fees:              result.Costs.Fees,
+		Spread:            result.Costs.Spread,
+		Slippage:          result.Costs.Slippage,
+		Latency:           result.Costs.Latency,
+		TotalTrades:       result.TotalTrades,
+		ClosedTrades:      m.ClosedTrades,
+		WinRate:           result.WinRate,
+		TotalReturn:       m.TotalReturn,
+		CAGR:              m.CAGR,
+		Sharpe:            m.Sharpe,
+		Sortino:           m.Sortino,
+		Calmar:            m.Calmar,
+		MaxDrawdown:       m.MaxDrawdown,
+		MaxDrawdownHours:  m.MaxDrawdownDuration.Hours(),
+		ProfitFactor:      m.ProfitFactor,
+		Expectancy:        m.Expectancy,
+		AvgWin:            m.AvgWin,
+		AvgLoss:           m.AvgLoss,
+		Exposure:          m.Exposure,
+		BuyAndHold:        m.BuyAndHold,
+		TradesBySide:      m.TradesBySide,
+		SuppressedByGuard: result.Suppressed,
+	}
+	if len(result.Regimes) > 0 {
+		report.Summary.ProfitLossByRegimes = make(map[string]float64, len(result.Regimes))
+		for r, stats := range result.Regimes {
+			report.Summary.ProfitLossByRegimes[r.String()] = stats.ProfitLoss
+		}
+	}
+
+	for symbol, r := range result.Symbols {
+		report.Symbols = append(report.Symbols, ReportSymbol{
+			Symbol:       symbol,
+			Trades:       r.Trades,
+			ClosedTrades: r.ClosedTrades,
+			WinRate:      r.WinRate,
+			ProfitLoss:   r.ProfitLoss,
+			Exposure:     r.Exposure,
+			BuyAndHold:   r.BuyAndHold,
+		})
+	}
+	sort.Slice(report.Symbols, func(i, j int) bool { return report.Symbols[i].Symbol < report.Symbols[j].Symbol })
+
+	peak := 0.0
+	for _, point := range result.Equity {
+		peak = math.Max(peak, point.Equity)
+		drawdown := 0.0
+		if peak > 0 {
+			drawdown = (peak - point.Equity) / peak * 100
+		}
+		report.Equity = append(report.Equity, ReportPoint{Time: point.Time, Equity: point.Equity, Drawdown: drawdown, Exposed: point.Exposed})
+	}
+	report.Monthly = monthlyReturns(result.Equity)
+
+	report.Trades = make([]ReportTrade, 0, len(result.Trades))
+	for _, t := range result.Trades {
+		report.Trades = append(report.Trades, ReportTrade{
+			Time:       t.Timestamp,
+			Symbol:     t.Symbol,
+			Side:       t.Side,
+			Price:      t.Price,
+			Quantity:   t.Quantity,
+			Value:      t.Value,
+			Fee:        t.Fee,
+			PnL:        t.PnL,
+			PnLPercent: t.PnLPercent,
+			PositionID: t.PositionID,
+			Status:     t.Status,
+			Reason:     t.Reason,
+		})
+	}
+	return report
+}
+
+/* describeCost names a cost model for the report */
+func describeCost(model exchange.CostModel) string {
+	switch m := model.(type) {
+	case nil:
+		return "none"
+	case exchange.HalfSpread:
+		return fmt.Sprintf("half spread %g bps", float64(m))
+	case exchange.VolumeSlippage:
+		return fmt.Sprintf("%g%% per 1%% of the bar's volume", float64(m))
+	default:
+		return fmt.Sprintf("%T %v", model, model)
+	}
+}
+
+/*
+*  monthlyReturns returns the % return of every calendar month (UTC)
+*  the equity curve covers, each from the equity the month before ended
+*  with
+ */
+func monthlyReturns(equity []EquityPoint) []ReportMonth {
+	months := []ReportMonth{}
+	if len(equity) < 2 {
+		return months
+	}
+	base := equity[0].Equity
+	for i := 1; i < len(equity); i++ {
+		t := equity[i].Time.UTC()
+		last := i+1 == len(equity)
+		if !last {
+			next := equity[i+1].Time.UTC()
+			if next.Year() == t.Year() && next.Month() == t.Month() {
+				continue
+			}
+		}
+		month := ReportMonth{Year: t.Year(), Month: int(t.Month())}
+		if base > 0 {
+			month.Return = (equity[i].Equity/base - 1) * 100
+		}
+		months = append(months, month)
+		base = equity[i].Equity
+	}
+	return months
+}
+
+/* WriteReportJSON writes the report as indented JSON */
+func WriteReportJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+/*
+	WriteReportHTML
+
+*  writes the report as one HTML page that needs nothing else to open:
+*  the charts are inline SVG, the style is embedded, no script runs
+*/
+func WriteReportHTML(w io.Writer, report Report) error {
+	funcs := template.FuncMap{
+		"money":   func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		"pct":     func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) + "%" },
+		"ratio":   func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		"qty":     func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) },
+		"time":    func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+		"heat":    heatClass,
+		"lower":   strings.ToLower,
+		"monthly": monthlyTable,
+	}
+	tmpl, err := template.New("report").Funcs(funcs).Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	equity := make([]float64, len(report.Equity))
+	drawdown := make([]float64, len(report.Equity))
+	for i, point := range report.Equity {
+		equity[i], drawdown[i] = point.Equity, -point.Drawdown
+	}
+	return tmpl.Execute(w, struct {
+		Report
+		EquityChart   chart
+		DrawdownChart chart
+	}{
+		Report:        report,
+		EquityChart:   newChart(equity),
+		DrawdownChart: newChart(drawdown),
+	})
+}
+
+const chartWidth, chartHeight = 1000.0, 240.0
+
+/* chart is a line chart drawn as an SVG polyline */
+type chart struct {
+	Points   string
+	Min, Max float64
+	Width    float64
+	Height   float64
+}
+
+func newChart(values []float64) chart {
+	c := chart{Width: chartWidth, Height: chartHeight}
+	if len(values) == 0 {
+		return c
+	}
+	c.Min, c.Max = values[0], values[0]
+	for _, v := range values {
+		c.Min, c.Max = math.Min(c.Min, v), math.Max(c.Max, v)
+	}
+	span := c.Max - c.Min
+	if span == 0 {
+		span = 1
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) / float64(len(values)-1) * chartWidth
+		}
+		y := chartHeight - (v-c.Min)/span*chartHeight
+		points[i] = strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+	}
+	c.Points = strings.Join(points, " ")
+	return c
+}
+
+/* heatClass picks the heatmap cell colour of a monthly return */
+func heatClass(v float64) string {
+	level := int(math.Min(math.Abs(v)/2.5, 3)) + 1
+	if v < 0 {
+		return "neg" + strconv.Itoa(level)
+	}
+	if v == 0 {
+		return "flat"
+	}
+	return "pos" + strconv.Itoa(level)
+}
+
+/* heatRow is a year of the monthly returns heatmap */
+type heatRow struct {
+	Year   int
+	Months [12]heatCell
+	Total  float64
+}
+
+type heatCell struct {
+	Return  float64
+	Covered bool // The equity curve reaches into the month
+}
+
+/* monthlyTable lays monthly returns out by year, the total compounds the months */
+func monthlyTable(months []ReportMonth) []heatRow {
+	var rows []heatRow
+	for _, m := range months {
+		if len(rows) == 0 || rows[len(rows)-1].Year != m.Year {
+			rows = append(rows, heatRow{Year: m.Year, Total: 1})
+		}
+		row := &rows[len(rows)-1]
+		row.Months[m.Month-1] = heatCell{Return: m.Return, Covered: true}
+		row.Total *= 1 + m.Return/100
+	}
+	for i := range rows {
+		rows[i].Total = (rows[i].Total - 1) * 100
+	}
+	return rows
+}
+
+const reportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backtest report {{time .Summary.Start}} to {{time .Summary.End}}</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; background: #fafafa; }
+  .container { max-width: 1100px; margin: 0 auto; padding: 20px; }
+  h2 { margin-top: 32px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+  table { border-collapse: collapse; width: 100%; font-size: 13px; }
+  th, td { padding: 4px 8px; border-bottom: 1px solid #eee; text-align: right; }
+  th:first-child, td:first-child { text-align: left; }
+  .grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(160px, 1fr)); gap: 12px; }
+  .card { background: #fff; border: 1px solid #e5e5e5; border-radius: 6px; padding: 10px 14px; }
+  .card .label { font-size: 12px; color: #777; }
+  .card .value { font-size: 20px; margin-top: 4px; }
+  svg { width: 100%; height: auto; background: #fff; border: 1px solid #e5e5e5; }
+  .axis { font-size: 12px; color: #777; display: flex; justify-content: space-between; }
+  .buy { color: #1a7f37; } .sell { color: #c62828; }
+  .heat td { text-align: center; }
+  .pos1 { background: #e6f4ea; } .pos2 { background: #b7e1c1; } .pos3 { background: #7cc68f; } .pos4 { background: #3fa45b; color: #fff; }
+  .neg1 { background: #fdecea; } .neg2 { background: #f8c1bb; } .neg3 { background: #ef8a80; } .neg4 { background: #d9463b; color: #fff; }
+  .flat { background: #f3f3f3; }
+  code { font-size: 12px; word-break: break-all; }
+</style>
+</head>
+<body>
+<div class="container">
+<h1>Backtest report</h1>
+<p>{{time .Summary.Start}} to {{time .Summary.End}} UTC{{with .Run.Interval}}, {{.}} candles{{end}}. Generated {{time .Generated}} UTC.</p>
+
+<div class="grid">
+  <div class="card"><div class="label">Net profit</div><div class="value">{{money .Summary.ProfitLoss}} USDT</div></div>
+  <div class="card"><div class="label">Return</div><div class="value">{{pct .Summary.TotalReturn}}</div></div>
+  <div class="card"><div class="label">Buy &amp; hold</div><div class="value">{{pct .Summary.BuyAndHold}}</div></div>
+  <div class="card"><div class="label">Sharpe</div><div class="value">{{ratio .Summary.Sharpe}}</div></div>
+  <div class="card"><div class="label">Max drawdown</div><div class="value">{{pct .Summary.MaxDrawdown}}</div></div>
+  <div class="card"><div class="label">Closed trades</div><div class="value">{{.Summary.ClosedTrades}}</div></div>
+</div>
+
+<h2>Equity</h2>
+<div class="axis"><span>{{money .EquityChart.Max}} USDT</span></div>
+<svg viewBox="0 0 {{.EquityChart.Width}} {{.EquityChart.Height}}" preserveAspectRatio="none"><polyline fill="none" stroke="#1565c0" stroke-width="1.5" points="{{.EquityChart.Points}}"/></svg>
+<div class="axis"><span>{{money .EquityChart.Min}} USDT</span></div>
+
+<h2>Drawdown</h2>
+<div class="axis"><span>0%</span></div>
+<svg viewBox="0 0 {{.DrawdownChart.Width}} {{.DrawdownChart.Height}}" preserveAspectRatio="none"><polyline fill="none" stroke="#c62828" stroke-width="1.5" points="{{.DrawdownChart.Points}}"/></svg>
+<div class="axis"><span>{{pct .DrawdownChart.Min}}</span></div>
+
+<h2>Monthly returns</h2>
+<table class="heat">
+  <tr><th>Year</th><th>Jan</th><th>Feb</th><th>Mar</th><th>Apr</th><th>May</th><th>Jun</th><th>Jul</th><th>Aug</th><th>Sep</th><th>Oct</th><th>Nov</th><th>Dec</th><th>Year</th></tr>
+  {{range monthly .Monthly}}
+  <tr><td>{{.Year}}</td>{{range .Months}}{{if .Covered}}<td class="{{heat .Return}}">{{pct .Return}}</td>{{else}}<td></td>{{end}}{{end}}<td class="{{heat .Total}}">{{pct .Total}}</td></tr>
+  {{end}}
+</table>
+
+<h2>Metrics</h2>
+<table>
+  <tr><td>Final equity</td><td>{{money .Summary.FinalEquity}} USDT</td></tr>
+  <tr><td>Net / gross profit</td><td>{{money .Summary.ProfitLoss}} / {{money .Summary.GrossProfitLoss}} USDT</td></tr>
+  <tr><td>Fees / spread / slippage / latency</td><td>{{money .Summary.Fees}} / {{money .Summary.Spread}} / {{money .Summary.Slippage}} / {{money .Summary.Latency}} USDT</td></tr>
+  <tr><td>Total return / CAGR</td><td>{{pct .Summary.TotalReturn}} / {{pct .Summary.CAGR}}</td></tr>
+  <tr><td>Sharpe / Sortino / Calmar</td><td>{{ratio .Summary.Sharpe}} / {{ratio .Summary.Sortino}} / {{ratio .Summary.Calmar}}</td></tr>
+  <tr><td>Max drawdown</td><td>{{pct .Summary.MaxDrawdown}} over {{ratio .Summary.MaxDrawdownHours}} h</td></tr>
+  <tr><td>Fills / closed trades</td><td>{{.Summary.TotalTrades}} / {{.Summary.ClosedTrades}}</td></tr>
+  <tr><td>Win rate / profit factor</td><td>{{pct .Summary.WinRate}} / {{ratio .Summary.ProfitFactor}}</td></tr>
+  <tr><td>Expectancy / avg win / avg loss</td><td>{{money .Summary.Expectancy}} / {{money .Summary.AvgWin}} / {{money .Summary.AvgLoss}} USDT</td></tr>
+  <tr><td>Exposure</td><td>{{pct .Summary.Exposure}}</td></tr>
+  <tr><td>Buy &amp; hold</td><td>{{pct .Summary.BuyAndHold}}</td></tr>
+  {{range $side, $n := .Summary.TradesBySide}}<tr><td>{{$side}} fills</td><td>{{$n}}</td></tr>{{end}}
+  {{range $regime, $pnl := .Summary.ProfitLossByRegimes}}<tr><td>Profit in {{$regime}}</td><td>{{money $pnl}} USDT</td></tr>{{end}}
+  {{range $guard, $n := .Summary.SuppressedByGuard}}<tr><td>Suppressed by {{$guard}} guard</td><td>{{$n}}</td></tr>{{end}}
+</table>
+
+{{if .Symbols}}
+<h2>Symbols</h2>
+<table>
+  <tr><th>Symbol</th><th>Net profit</th><th>Fills</th><th>Closed</th><th>Win rate</th><th>Exposure</th><th>Buy &amp; hold</th></tr>
+  {{range .Symbols}}
+  <tr><td>{{.Symbol}}</td><td>{{money .ProfitLoss}}</td><td>{{.Trades}}</td><td>{{.ClosedTrades}}</td><td>{{pct .WinRate}}</td><td>{{pct .Exposure}}</td><td>{{pct .BuyAndHold}}</td></tr>
+  {{end}}
+</table>
+{{end}}
+
+<h2>Run</h2>
+<table>
+  {{range $symbol, $spec := .Run.Strategies}}<tr><td>Strategy {{$symbol}}</td><td><code>{{$spec}}</code></td></tr>{{end}}
+  <tr><td>Data hash (SHA-256)</td><td><code>{{.Run.DataHash}}</code></td></tr>
+  {{with .Run.Source}}<tr><td>Data source</td><td>{{.}}</td></tr>{{end}}
+  {{with .Run.Version}}<tr><td>Version</td><td><code>{{.}}</code></td></tr>{{end}}
+  <tr><td>Initial balance / min order</td><td>{{money .Run.InitialBalance}} / {{money .Run.MinOrderSize}} USDT</td></tr>
+  <tr><td>Risk per trade / max drawdown</td><td>{{.Run.RiskPerTrade}} / {{.Run.MaxDrawdown}}</td></tr>
+  <tr><td>Max exposure / per symbol</td><td>{{.Run.MaxExposure}} / {{.Run.MaxSymbolExposure}}</td></tr>
+  <tr><td>Maker / taker fee</td><td>{{.Run.MakerBps}} / {{.Run.TakerBps}} bps</td></tr>
+  <tr><td>Spread / slippage</td><td>{{.Run.Spread}} / {{.Run.Slippage}}</td></tr>
+  <tr><td>Latency / intrabar rule</td><td>{{.Run.LatencyBars}} bars / {{.Run.Intrabar}}</td></tr>
+</table>
+
+<h2>Trades</h2>
+<table>
+  <tr><th>Time</th><th>Symbol</th><th>Side</th><th>Price</th><th>Quantity</th><th>Value</th><th>Fee</th><th>PnL</th><th>Status</th><th>Reason</th></tr>
+  {{range .Trades}}
+  <tr><td>{{time .Time}}</td><td>{{.Symbol}}</td><td class="{{lower .Side}}">{{.Side}}</td><td>{{qty .Price}}</td><td>{{qty .Quantity}}</td><td>{{money .Value}}</td><td>{{money .Fee}}</td><td>{{if eq .Side "SELL"}}{{money .PnL}}{{end}}</td><td>{{.Status}}</td><td>{{.Reason}}</td></tr>
+  {{else}}
+  <tr><td colspan="10">No trades</td></tr>
+  {{end}}
+</table>
+</div>
+</body>
+</html>
+`
@@ -0,0 +1,87 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+func TestReport(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	/* Hourly candles from mid January to April */
+	start := int64(1705276800000) // 2024-01-15
+	var data []models.Kline
+	for i := 0; i < 24*80; i++ {
+		price := 100 + 5*math.Sin(float64(i)/15)
+		data = append(data, models.Kline{
+			OpenTime: start + int64(i)*3600000, CloseTime: start + int64(i)*3600000 + 3599999,
+			Open: price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 1000,
+		})
+	}
+	spec := "mean_reversion{history: 30, rsi_period: 7}"
+	strat, err := strategy.NewFromSpec(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := DefaultConfig()
+	result, err := Run(data, strat, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hash := HashCandles(map[string][]models.Kline{"BTCUSDT": data})
+	data[10].Close++
+	if hash == HashCandles(map[string][]models.Kline{"BTCUSDT": data}) {
+		t.Errorf("Expected the hash to change with the data")
+	}
+	report := NewReport(result, RunInfo{Strategies: map[string]string{"BTCUSDT": spec}, Config: cfg, Interval: "1h", DataHash: hash})
+
+	if len(report.Monthly) != 4 || report.Monthly[0].Month != 1 || report.Monthly[3].Month != 4 {
+		t.Fatalf("Expected January to April, got %+v", report.Monthly)
+	}
+	compounded := 1.0
+	for _, m := range report.Monthly {
+		compounded *= 1 + m.Return/100
+	}
+	if math.Abs((compounded-1)*100-result.Metrics.TotalReturn) > 1e-6 {
+		t.Errorf("Expected the months to compound to %.4f%%, got %.4f%%", result.Metrics.TotalReturn, (compounded-1)*100)
+	}
+	if len(report.Trades) != result.TotalTrades || len(report.Equity) != len(result.Equity) {
+		t.Errorf("Expected every fill and equity point in the report")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReportJSON(&buf, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded struct {
+		Run struct {
+			DataHash string                       `json:"data_hash"`
+			Params   map[string]map[string]string `json:"params"`
+		} `json:"run"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Run.DataHash != hash || decoded.Run.Params["BTCUSDT"]["rsi_period"] != "7" {
+		t.Errorf("Unexpected JSON run: %+v (%v)", decoded.Run, err)
+	}
+
+	buf.Reset()
+	if err := WriteReportHTML(&buf, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{"<polyline", hash, "rsi_period: 7", "Monthly returns"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the HTML report to contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "ZgotmplZ") {
+		t.Errorf("Expected a self-contained HTML report without scripts or escaped values")
+	}
+}
@@ -0,0 +1,301 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+/*
+	WalkForwardConfig
+
+*  how history is split, in candles:
+*  - InSample: candles the parameters are optimized on
+*  - OutOfSample: candles the best parameters are then tested on. The
+*    windows roll forward by as much, so the out-of-sample windows
+*    follow each other
+*  - Anchored: every in-sample window starts at the first candle and
+*    grows, instead of rolling
+*  - Warmup: candles replayed before an out-of-sample window to warm up
+*    the strategy's indicators, they don't count
+*/
+type WalkForwardConfig struct {
+	InSample    int
+	OutOfSample int
+	Anchored    bool
+	Warmup      int
+	Objective   Objective
+	Workers     int // Backtests run in parallel, 0 = one per CPU
+}
+
+/*
+	Window
+
+*  one walk-forward step: the parameters that scored best in sample and
+*  how they did out of sample. Efficiency is the out-of-sample return
+*  per candle over the in-sample one, around 1 or above when the
+*  parameters hold up, 0 when the in-sample return wasn't positive.
+*/
+type Window struct {
+	InStart, InEnd   time.Time
+	OutStart, OutEnd time.Time
+	Params           map[string]string
+	Spec             string
+	InSampleScore    float64
+	OutOfSampleScore float64
+	InSample         Result
+	OutOfSample      Result // Measured from the out-of-sample start, the warmup excluded
+	Efficiency       float64
+}
+
+/*
+	ParamStability
+
+*  how a swept parameter moved between windows. Changes counts the
+*  windows that picked another value than the one before. Mean, StdDev
+*  and CV (StdDev / |Mean|) are set for numeric parameters: a low CV
+*  means the optimum sits still, a high one that it chases noise.
+*/
+type ParamStability struct {
+	Name     string
+	Values   []string // Chosen per window
+	Distinct int
+	Changes  int
+	Numeric  bool
+	Mean     float64
+	StdDev   float64
+	CV       float64
+}
+
+/*
+	WalkForwardResult
+
+*  Equity stitches the out-of-sample windows into one curve: each
+*  window continues from the equity the previous one ended with, so it
+*  is what trading the re-optimized parameters would have compounded
+*  to. Metrics measure that curve and the out-of-sample trades.
+*  Efficiency is the out-of-sample return per candle over the
+*  in-sample one across all windows.
+*/
+type WalkForwardResult struct {
+	Windows    []Window
+	Equity     []EquityPoint
+	Metrics    Metrics
+	Efficiency float64
+	Stability  []ParamStability
+}
+
+/*
+	WalkForward
+
+*  splits the candles into in-sample / out-of-sample windows, optimizes
+*  the ranges of the base spec on each in-sample window with Optimize
+*  and backtests the winner on the out-of-sample window after it. Only
+*  full windows are tested.
+*
+*  Out-of-sample results count from the first out-of-sample candle:
+*  positions the strategy opened during the warmup are carried in at
+*  their value then.
+*/
+func WalkForward(data []models.Kline, base string, ranges []ParamRange, cfg Config, wf WalkForwardConfig) (WalkForwardResult, error) {
+	var result WalkForwardResult
+	if wf.InSample <= 0 || wf.OutOfSample <= 0 || wf.Warmup < 0 {
+		return result, fmt.Errorf("in-sample and out-of-sample windows need candles")
+	}
+	if wf.Objective == nil {
+		return result, fmt.Errorf("no objective to optimize")
+	}
+	if wf.InSample+wf.OutOfSample > len(data) {
+		return result, fmt.Errorf("%d candles can't fill a %d + %d candle window", len(data), wf.InSample, wf.OutOfSample)
+	}
+
+	balance := cfg.InitialBalance
+	var closed []float64
+	var returnsOut, returnsIn float64
+	for inEnd := wf.InSample; inEnd+wf.OutOfSample <= len(data); inEnd += wf.OutOfSample {
+		inStart := inEnd - wf.InSample
+		if wf.Anchored {
+			inStart = 0
+		}
+		outEnd := inEnd + wf.OutOfSample
+		inData, outData := data[inStart:inEnd], data[inEnd:outEnd]
+
+		trials, err := Optimize(base, ranges, wf.Objective, wf.Workers, func(s strategy.Strategy) (Result, error) {
+			return Run(inData, s, cfg)
+		})
+		if err != nil {
+			return result, err
+		}
+		best := trials[0]
+		if best.Err != nil {
+			return result, fmt.Errorf("no valid parameters for the window from %s: %v", candleTime(inData[0].OpenTime), best.Err)
+		}
+
+		window := Window{
+			InStart:       candleTime(inData[0].OpenTime),
+			InEnd:         candleTime(inData[len(inData)-1].CloseTime + 1),
+			OutStart:      candleTime(outData[0].OpenTime),
+			OutEnd:        candleTime(outData[len(outData)-1].CloseTime + 1),
+			Params:        best.Params,
+			Spec:          best.Spec,
+			InSampleScore: best.Score,
+			InSample:      best.Result,
+		}
+
+		strat, err := strategy.NewFromSpec(best.Spec)
+		if err != nil {
+			return result, err
+		}
+		warmup := inEnd - wf.Warmup
+		if warmup < 0 {
+			warmup = 0
+		}
+		full, err := Run(data[warmup:outEnd], strat, cfg)
+		if err != nil {
+			return result, err
+		}
+		window.OutOfSample = outOfSample(full, window.OutStart, buyAndHold(outData))
+		window.OutOfSampleScore = wf.Objective(window.OutOfSample)
+
+		inReturn := window.InSample.Metrics.TotalReturn / float64(len(inData))
+		outReturn := window.OutOfSample.Metrics.TotalReturn / float64(len(outData))
+		if inReturn > 0 {
+			window.Efficiency = outReturn / inReturn
+		}
+		returnsIn += inReturn
+		returnsOut += outReturn
+
+		/* Stitch the window onto the curve, scaled to the balance so far */
+		curve := window.OutOfSample.Equity
+		scale := balance / curve[0].Equity
+		if len(result.Equity) == 0 {
+			result.Equity = append(result.Equity, EquityPoint{Time: curve[0].Time, Equity: balance})
+		}
+		for _, point := range curve[1:] {
+			point.Equity *= scale
+			result.Equity = append(result.Equity, point)
+		}
+		balance = result.Equity[len(result.Equity)-1].Equity
+		for _, pnl := range window.OutOfSample.Closed {
+			closed = append(closed, pnl*scale)
+		}
+
+		result.Windows = append(result.Windows, window)
+	}
+
+	result.Metrics = ComputeMetrics(result.Equity, closed)
+	result.Metrics.TradesBySide = make(map[string]int)
+	for _, w := range result.Windows {
+		for side, n := range w.OutOfSample.Metrics.TradesBySide {
+			result.Metrics.TradesBySide[side] += n
+		}
+	}
+	result.Metrics.BuyAndHold = buyAndHold(data[wf.InSample : wf.InSample+len(result.Windows)*wf.OutOfSample])
+	if returnsIn > 0 {
+		result.Efficiency = returnsOut / returnsIn
+	}
+	result.Stability = paramStability(result.Windows, ranges)
+	return result, nil
+}
+
+func candleTime(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
+
+/* buyAndHold returns the % return of holding from the first open to the last close */
+func buyAndHold(data []models.Kline) float64 {
+	if len(data) == 0 || data[0].Open <= 0 {
+		return 0
+	}
+	return (data[len(data)-1].Close/data[0].Open - 1) * 100
+}
+
+/*
+*  outOfSample cuts a backtest run with warmup down to the part from
+*  start on: the equity curve, its trades, metrics, profit and the
+*  costs paid.
+ */
+func outOfSample(full Result, start time.Time, benchmark float64) Result {
+	out := full
+	out.Equity, out.paid = nil, nil
+	var before exchange.CostTotals
+	for i, point := range full.Equity {
+		if !point.Time.After(start) && (i+1 == len(full.Equity) || full.Equity[i+1].Time.After(start)) {
+			point.Time = start
+			before = full.paid[i]
+		} else if !point.Time.After(start) {
+			continue
+		}
+		out.Equity = append(out.Equity, point)
+		out.paid = append(out.paid, full.paid[i])
+	}
+	out.Costs = full.Costs.Sub(before)
+	out.Trades = nil
+	for _, trade := range full.Trades {
+		if !trade.Timestamp.Before(start) {
+			out.Trades = append(out.Trades, trade)
+		}
+	}
+
+	out.Closed = closedTrades(out.Trades)
+	out.Metrics = ComputeMetrics(out.Equity, out.Closed)
+	out.Metrics.TradesBySide = make(map[string]int)
+	for _, trade := range out.Trades {
+		out.Metrics.TradesBySide[trade.Side]++
+	}
+	out.Metrics.BuyAndHold = benchmark
+	out.TotalTrades = len(out.Trades)
+	out.WinRate = out.Metrics.WinRate
+	out.ProfitLoss = out.Equity[len(out.Equity)-1].Equity - out.Equity[0].Equity
+	out.GrossProfitLoss = out.ProfitLoss + out.Costs.Total()
+	out.Regimes, out.Contributions, out.Suppressed = nil, nil, nil
+	return out
+}
+
+/* paramStability summarizes the values each swept parameter took across windows */
+func paramStability(windows []Window, ranges []ParamRange) []ParamStability {
+	var stability []ParamStability
+	for _, r := range ranges {
+		s := ParamStability{Name: r.Name, Numeric: true}
+		seen := make(map[string]bool)
+		var numbers []float64
+		for i, w := range windows {
+			value := w.Params[r.Name]
+			s.Values = append(s.Values, value)
+			if !seen[value] {
+				seen[value] = true
+				s.Distinct++
+			}
+			if i > 0 && value != windows[i-1].Params[r.Name] {
+				s.Changes++
+			}
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				numbers = append(numbers, v)
+			} else {
+				s.Numeric = false
+			}
+		}
+		if s.Numeric && len(numbers) > 0 {
+			for _, v := range numbers {
+				s.Mean += v
+			}
+			s.Mean /= float64(len(numbers))
+			for _, v := range numbers {
+				s.StdDev += (v - s.Mean) * (v - s.Mean)
+			}
+			s.StdDev = math.Sqrt(s.StdDev / float64(len(numbers)))
+			if s.Mean != 0 {
+				s.CV = s.StdDev / math.Abs(s.Mean)
+			}
+		}
+		stability = append(stability, s)
+	}
+	sort.SliceStable(stability, func(i, j int) bool { return stability[i].Name < stability[j].Name })
+	return stability
+}
@@ -0,0 +1,80 @@
+package backtest
+
+import (
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+func TestWalkForward(t *testing.T) {
+	strategy.SetLogOutput(io.Discard)
+
+	var data []models.Kline
+	for i := 0; i < 1000; i++ {
+		price := 100 + 5*math.Sin(float64(i)/15)
+		data = append(data, models.Kline{
+			OpenTime: int64(i) * 60000, CloseTime: int64(i)*60000 + 59999,
+			Open: price, High: price * 1.001, Low: price * 0.999, Close: price, Volume: 1000,
+		})
+	}
+	ranges := []ParamRange{{Name: "rsi_period", Values: []string{"7", "14"}}}
+	objective, err := ParseObjective("net_profit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := DefaultConfig()
+	result, err := WalkForward(data, "mean_reversion{history: 30}", ranges, cfg, WalkForwardConfig{
+		InSample: 400, OutOfSample: 200, Warmup: 50, Objective: objective, Workers: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* 1000 candles fit windows out of sample from 400, 600 and 800 */
+	if len(result.Windows) != 3 {
+		t.Fatalf("Expected 3 windows, got %d", len(result.Windows))
+	}
+	if got := result.Equity[0]; got.Equity != cfg.InitialBalance || !got.Time.Equal(candleTime(data[400].OpenTime)) {
+		t.Errorf("Expected the stitched curve to start with %.2f at the first out-of-sample candle, got %+v", cfg.InitialBalance, got)
+	}
+	for i := 1; i < len(result.Equity); i++ {
+		if !result.Equity[i].Time.After(result.Equity[i-1].Time) {
+			t.Fatalf("Stitched curve goes back in time at point %d", i)
+		}
+	}
+	if len(result.Stability) != 1 || len(result.Stability[0].Values) != 3 || !result.Stability[0].Numeric {
+		t.Errorf("Unexpected parameter stability: %+v", result.Stability)
+	}
+
+	/* Each window continues from the equity the previous one ended with */
+	end := cfg.InitialBalance
+	for _, w := range result.Windows {
+		end *= 1 + w.OutOfSample.Metrics.TotalReturn/100
+	}
+	if last := result.Equity[len(result.Equity)-1].Equity; math.Abs(last-end) > 1e-6 {
+		t.Errorf("Expected the stitched curve to end at %.4f, got %.4f", end, last)
+	}
+}
+
+func TestOutOfSampleCosts(t *testing.T) {
+	at := func(minute int) time.Time { return candleTime(int64(minute) * 60000) }
+	full := Result{
+		Equity: []EquityPoint{{Time: at(0), Equity: 1000}, {Time: at(1), Equity: 990}, {Time: at(2), Equity: 1010}},
+		Costs:  exchange.CostTotals{Fees: 3, Slippage: 1},
+		paid:   []exchange.CostTotals{{}, {Fees: 1, Slippage: 1}, {Fees: 3, Slippage: 1}},
+	}
+
+	/* The warmup paid 1 in fees and 1 in slippage, out of sample only 2 in fees */
+	out := outOfSample(full, at(1), 0)
+	if out.Costs != (exchange.CostTotals{Fees: 2}) {
+		t.Errorf("Expected only the out-of-sample fees of 2, got %+v", out.Costs)
+	}
+	if out.ProfitLoss != 20 || out.GrossProfitLoss != 22 {
+		t.Errorf("Expected a profit of 20, 22 gross, got %.2f and %.2f", out.ProfitLoss, out.GrossProfitLoss)
+	}
+}
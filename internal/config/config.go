@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -26,27 +27,65 @@ type Config struct {
 	TelegramToken      string
 	TelegramChatID     string
 	MinOrderSize       float64
+	DefaultStrategy    string
+	Strategies         map[string]string // Strategy spec per trading pair
+	StateSaveMinutes   float64           // How often strategy state is saved
+	FlowWindowSeconds  float64           // Trade flow window of the depth stream
+	DepthRecordDir     string            // Where order book observations are recorded, "" = off
+	MaxExposure        float64           // Share of equity all open positions may hold, 0 = no limit
+	MaxSymbolExposure  float64           // Share of equity one pair's position may hold, 0 = no limit
 }
 
 /* Config from .env file */
 func LoadConfig() (*Config, error) {
+	cfg, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	/* Validate required fields */
+	if cfg.BINANCE_API_KEY == "" || cfg.BINANCE_API_SECRET == "" {
+		return nil, fmt.Errorf("Binance API key and secret are required")
+	}
+	return cfg, nil
+}
+
+/*
+*  LoadSettings reads the config like LoadConfig without requiring the
+*  Binance keys, for tools that never reach the exchange such as
+*  offline backtests
+ */
+func LoadSettings() (*Config, error) {
 	cfg := &Config{
 		BINANCE_API_KEY:    getEnvVar("BINANCE_API_KEY", ""),
 		BINANCE_API_SECRET: getEnvVar("BINANCE_API_SECRET", ""),
 		InitialInvestment:  getEnvFloatVar("INITIAL_INVESTMENT", 0), // default value of 0
 		MaxDrawdown:        getEnvFloatVar("MAX_DRAWDOWN", 0),       // default value of 0
 		RiskPerTrade:       getEnvFloatVar("RISK_PER_TRADE", 0),     // default value of 0
-		TradingPairs:       []string{"TRADING_PAIRS", "BTCUSDT"},    // default value of BTCUSDT
+		TradingPairs:       getEnvListVar("TRADING_PAIRS", []string{"BTCUSDT"}),
 		DatabasePath:       getEnvVar("DB_PATH", "data/trading_bot.db"),
 		TelegramToken:      getEnvVar("TELEGRAM_TOKEN", ""),
 		TelegramChatID:     getEnvVar("TELEGRAM_CHAT_ID", ""),
+		DefaultStrategy:    getEnvVar("DEFAULT_STRATEGY", "mean_reversion"),
+		StateSaveMinutes:   getEnvFloatVar("STATE_SAVE_MINUTES", 5),
+		FlowWindowSeconds:  getEnvFloatVar("FLOW_WINDOW_SECONDS", 60),
+		DepthRecordDir:     getEnvVar("DEPTH_RECORD_DIR", ""),
+		MaxExposure:        getEnvFloatVar("MAX_EXPOSURE", 0),
+		MaxSymbolExposure:  getEnvFloatVar("MAX_SYMBOL_EXPOSURE", 0),
 	}
 
-	/* Validate required fields */
-	if cfg.BINANCE_API_KEY == "" || cfg.BINANCE_API_SECRET == "" {
-		return nil, fmt.Errorf("Binance API key and secret are required")
+	/* Pairs are upper case like Binance's symbols and the STRATEGIES keys */
+	for i, pair := range cfg.TradingPairs {
+		cfg.TradingPairs[i] = strings.ToUpper(pair)
 	}
 
+	/* Strategy per pair, e.g. STRATEGIES="BTCUSDT: mean_reversion{rsi_period: 14}; ETHUSDT: mean_reversion" */
+	strategies, err := parseStrategies(getEnvVar("STRATEGIES", ""))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Strategies = strategies
+
 	minOrderSize, _ := strconv.ParseFloat(os.Getenv("MIN_ORDER_SIZE"), 64)
 
 	if minOrderSize == 0 {
@@ -58,6 +97,45 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+/*
+*  StrategyFor returns the strategy spec configured for a pair in any
+*  case, falling back to the default strategy
+ */
+func (c *Config) StrategyFor(pair string) string {
+	if spec, ok := c.Strategies[strings.ToUpper(pair)]; ok {
+		return spec
+	}
+	return c.DefaultStrategy
+}
+
+/*
+*  Parse "PAIR: spec; PAIR: spec" into a map.
+*  The spec itself is validated later by the strategy registry.
+ */
+func parseStrategies(value string) (map[string]string, error) {
+	strategies := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		colon := strings.IndexByte(entry, ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid STRATEGIES entry %q, expected PAIR: strategy{...}", entry)
+		}
+		pair := strings.ToUpper(strings.TrimSpace(entry[:colon]))
+		spec := strings.TrimSpace(entry[colon+1:])
+		if pair == "" || spec == "" {
+			return nil, fmt.Errorf("invalid STRATEGIES entry %q, expected PAIR: strategy{...}", entry)
+		}
+		if _, dup := strategies[pair]; dup {
+			return nil, fmt.Errorf("STRATEGIES lists %s twice", pair)
+		}
+		strategies[pair] = spec
+	}
+	return strategies, nil
+}
+
 func getEnvVar(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -73,3 +151,20 @@ func getEnvFloatVar(key string, defaultValue float64) float64 {
 	}
 	return defaultValue
 }
+
+func getEnvListVar(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return defaultValue
+	}
+	return list
+}
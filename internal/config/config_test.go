@@ -0,0 +1,25 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPairsMatchStrategiesInAnyCase(t *testing.T) {
+	t.Setenv("TRADING_PAIRS", "btcusdt, EthUsdt")
+	t.Setenv("STRATEGIES", "BTCUSDT: ema_cross; ethusdt: breakout")
+	t.Setenv("DEFAULT_STRATEGY", "mean_reversion")
+
+	cfg, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"BTCUSDT", "ETHUSDT"}; !reflect.DeepEqual(cfg.TradingPairs, want) {
+		t.Errorf("Expected pairs %v, got %v", want, cfg.TradingPairs)
+	}
+	for pair, want := range map[string]string{"BTCUSDT": "ema_cross", "ETHUSDT": "breakout", "btcusdt": "ema_cross", "SOLUSDT": "mean_reversion"} {
+		if spec := cfg.StrategyFor(pair); spec != want {
+			t.Errorf("Expected %s to trade %s, got %s", pair, want, spec)
+		}
+	}
+}
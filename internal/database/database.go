@@ -109,6 +109,23 @@ func Initialize(dsn string) (*Database, error) {
 		}
 	}
 
+	/* Trade columns added after the table was first created */
+	for _, column := range []string{"Reason", "StopLoss", "TakeProfit", "OwnExits"} {
+		if !db.gorm.Migrator().HasColumn(&models.Trade{}, column) {
+			if err := db.gorm.Migrator().AddColumn(&models.Trade{}, column); err != nil {
+				return nil, fmt.Errorf("failed to add trades column %s: %v", column, err)
+			}
+		}
+	}
+
+	/* Strategy state tables, safe to run on every start */
+	if err := db.gorm.AutoMigrate(&models.GridLevel{}); err != nil {
+		return nil, fmt.Errorf("failed to create grid_levels table: %v", err)
+	}
+	if err := db.gorm.AutoMigrate(&models.StrategyState{}); err != nil {
+		return nil, fmt.Errorf("failed to create strategy_states table: %v", err)
+	}
+
 	return db, nil
 }
 
@@ -214,6 +231,10 @@ func (db *Database) createViews() error {
 * - CalculateOpenPnl
 * - GetTrades
 * - UpdateTradeStatus
+* - LoadGrid
+* - SaveGrid
+* - LoadStrategyState
+* - SaveStrategyState
 **/
 
 /*
@@ -329,11 +350,93 @@ func (db *Database) GetTrades(symbol string) ([]*models.Trade, error) {
 	return trades, err
 }
 
+/*
+	GetTradesBetween
+
+* returns the trades of the given symbols (all if none) made from start
+* until before end, oldest first
+*/
+func (db *Database) GetTradesBetween(symbols []string, start, end time.Time) ([]models.Trade, error) {
+	var trades []models.Trade
+	query := db.gorm.Where("timestamp >= ? AND timestamp < ?", start, end)
+	if len(symbols) > 0 {
+		query = query.Where("symbol IN ?", symbols)
+	}
+	err := query.Order("timestamp asc").Find(&trades).Error
+	return trades, err
+}
+
 /*
 	UpdateTradeStatus
 
-* updates the status of a trade
+* updates the status of every trade of a position
 */
 func (db *Database) UpdateTradeStatus(positionID string, status string) error {
-	return db.gorm.Model(&models.Trade{}).Where("id = ?", positionID).Update("status", status).Error
+	return db.gorm.Model(&models.Trade{}).Where("position_id = ?", positionID).Update("status", status).Error
+}
+
+/*
+	LoadGrid
+
+* returns the stored grid levels for a symbol, lowest level first
+*/
+func (db *Database) LoadGrid(symbol string) ([]models.GridLevel, error) {
+	var levels []models.GridLevel
+	err := db.gorm.Where("symbol = ?", symbol).Order("level ASC").Find(&levels).Error
+	return levels, err
+}
+
+/*
+	SaveGrid
+
+* replaces the stored grid levels for a symbol
+*/
+func (db *Database) SaveGrid(symbol string, levels []models.GridLevel) error {
+	return db.gorm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("symbol = ?", symbol).Delete(&models.GridLevel{}).Error; err != nil {
+			return err
+		}
+		if len(levels) == 0 {
+			return nil
+		}
+		rows := make([]models.GridLevel, len(levels))
+		for i, level := range levels {
+			level.ID = 0
+			level.Symbol = symbol
+			rows[i] = level
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+/*
+	LoadStrategyState
+
+* returns the saved strategy state for a symbol, nil when nothing is
+* saved or the state was written by a different strategy spec
+*/
+func (db *Database) LoadStrategyState(symbol string, spec string) ([]byte, error) {
+	var state models.StrategyState
+	result := db.gorm.Where("symbol = ?", symbol).Limit(1).Find(&state)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || state.Spec != spec {
+		return nil, nil
+	}
+	return state.State, nil
+}
+
+/*
+	SaveStrategyState
+
+* replaces the saved strategy state for a symbol
+*/
+func (db *Database) SaveStrategyState(symbol string, spec string, state []byte) error {
+	return db.gorm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("symbol = ?", symbol).Delete(&models.StrategyState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.StrategyState{Symbol: symbol, Spec: spec, State: state}).Error
+	})
 }
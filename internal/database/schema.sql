@@ -11,6 +11,9 @@ CREATE TABLE IF NOT EXISTS trades (
     pn_l REAL DEFAULT 0,
     pn_l_percent REAL DEFAULT 0,
     status TEXT DEFAULT 'OPEN',
+    reason TEXT DEFAULT '',
+    stop_loss REAL DEFAULT 0,
+    take_profit REAL DEFAULT 0,
     created_at DATETIME,
     updated_at DATETIME
 );
@@ -0,0 +1,749 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/logger"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
+	"github.com/marwanbukhori/player-cryptobot/internal/risk"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	Engine
+
+*  The bot's trading decisions: every Step prices each pair, checks
+*  the exits of its open position, runs its strategy and trades the
+*  signals, sized by the risk manager.
+*
+*  It only talks to an Exchange and a Clock. The bot drives it with
+*  Binance and the wall clock every few seconds, backtests with a
+*  SimExchange after every simulated candle, so both run the same
+*  emergency sells, tiered exits, sizing and stop-loss orders.
+*/
+type Engine struct {
+	exchange     exchange.Exchange
+	clock        Clock
+	log          *logger.Logger
+	pairs        []string
+	strategies   map[string]strategy.Strategy
+	legOwners    map[string]string
+	riskManager  *risk.RiskManager
+	minOrderSize float64
+
+	feed          *timeframe.Feed
+	subscriptions map[string][]string
+	watchesBook   map[string]bool
+	accumulates   map[string]bool
+
+	regimes         *regime.Board
+	regimeReporters map[string]strategy.RegimeReporter
+	regimeDetectors map[string]*regime.Detector
+
+	/* Optional hooks, nil to leave out */
+	Notifier Notifier                                                                // Told about trades and errors
+	Book     func(pair string, now time.Time) (*models.OrderBook, *models.TradeFlow) // Order book of pairs whose strategy watches it
+	Observe  func(bar *models.MarketData)                                            // Every bar before it is analyzed, e.g. to record it
+	OnTrade  func()                                                                  // After every filled order, e.g. to save strategy state
+
+	/* Optional limits on the equity held in positions, 0 for none */
+	MaxExposure       float64 // Share all open positions together may hold, e.g. 0.8
+	MaxSymbolExposure float64 // Share one pair's position may hold
+}
+
+/* Clock tells the engine what time it is */
+type Clock interface {
+	Now() time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+/* WallClock is the real time, for live trading */
+var WallClock Clock = wallClock{}
+
+/* Notifier is told about trades and errors, e.g. the Telegram notifier */
+type Notifier interface {
+	NotifyTrade(symbol, side string, price, quantity float64) error
+	NotifyError(err error) error
+}
+
+/*
+*  candleSource is implemented by exchanges that know the candle behind
+*  the price, e.g. SimExchange. Its bars then carry open, high, low and
+*  volume, live bars only have the price.
+ */
+type candleSource interface {
+	LastCandle(symbol string) (models.Kline, bool)
+}
+
+/*
+	New
+
+*  builds an engine trading pairs with one strategy each.
+*  Multi-symbol strategies (pairs) trade their other legs themselves:
+*  - every leg must be one of the pairs so its exits are watched
+*  - a leg belongs to one strategy, and runs no strategy of its own
+*  - spot can't sell short
+*/
+func New(ex exchange.Exchange, clock Clock, pairs []string, strategies map[string]strategy.Strategy,
+	riskManager *risk.RiskManager, minOrderSize float64, log *logger.Logger) (*Engine, error) {
+	legOwners := make(map[string]string)
+	for _, pair := range pairs {
+		s, ok := strategies[pair]
+		if !ok {
+			return nil, fmt.Errorf("no strategy for %s", pair)
+		}
+		if strategy.Shorts(s) {
+			return nil, fmt.Errorf("strategy for %s sells short, which spot trading can't do (use pairs mode: rotation)", pair)
+		}
+		multi, ok := s.(strategy.MultiSymbol)
+		if !ok {
+			continue
+		}
+		ownLeg := false
+		for _, symbol := range multi.Symbols() {
+			if symbol == pair {
+				ownLeg = true
+				continue
+			}
+			if _, ok := strategies[symbol]; !ok {
+				return nil, fmt.Errorf("strategy for %s trades %s, which is not in TRADING_PAIRS", pair, symbol)
+			}
+			if owner, taken := legOwners[symbol]; taken {
+				return nil, fmt.Errorf("%s is traded by the strategies of both %s and %s", symbol, owner, pair)
+			}
+			legOwners[symbol] = pair
+			log.Info("%s is traded by the %s strategy", symbol, pair)
+		}
+		if !ownLeg {
+			return nil, fmt.Errorf("strategy for %s doesn't trade %s, put the pair in its symbols", pair, pair)
+		}
+	}
+	for leg, owner := range legOwners {
+		if _, ok := strategies[leg].(strategy.MultiSymbol); ok {
+			return nil, fmt.Errorf("%s is a leg of the %s strategy and can't run a multi-symbol strategy itself", leg, owner)
+		}
+	}
+
+	e := &Engine{
+		exchange:        ex,
+		clock:           clock,
+		log:             log,
+		pairs:           pairs,
+		strategies:      strategies,
+		legOwners:       legOwners,
+		riskManager:     riskManager,
+		minOrderSize:    minOrderSize,
+		feed:            timeframe.NewFeed(ex.GetHistoricalData, timeframe.DefaultLimit),
+		subscriptions:   make(map[string][]string),
+		watchesBook:     make(map[string]bool),
+		accumulates:     make(map[string]bool),
+		regimes:         regime.NewBoard(),
+		regimeReporters: make(map[string]strategy.RegimeReporter),
+		regimeDetectors: make(map[string]*regime.Detector),
+	}
+
+	for _, pair := range pairs {
+		s := strategies[pair]
+
+		/* Candle series for strategies that look at other timeframes */
+		if intervals := strategy.Timeframes(s); len(intervals) > 0 {
+			e.subscriptions[pair] = intervals
+			log.Info("%s subscribes to %v candles", pair, intervals)
+		}
+		e.watchesBook[pair] = strategy.BookLevels(s) > 0
+
+		/* Strategies that classify the regime (regime_switch) report their own,
+		*  other pairs get a detector with the default thresholds
+		 */
+		if reporter := strategy.FindRegimeReporter(s); reporter != nil {
+			e.regimeReporters[pair] = reporter
+		} else {
+			e.regimeDetectors[pair] = regime.NewDetector(regime.DefaultConfig())
+		}
+
+		/* Legs are exited by the strategy that trades them */
+		if owner, isLeg := legOwners[pair]; isLeg {
+			s = strategies[owner]
+		}
+		e.accumulates[pair] = strategy.Accumulates(s)
+	}
+	return e, nil
+}
+
+/* Regimes returns the market regime per pair, updated every Step */
+func (e *Engine) Regimes() *regime.Board {
+	return e.regimes
+}
+
+func (e *Engine) notifyError(err error) {
+	if e.Notifier != nil {
+		e.Notifier.NotifyError(err)
+	}
+}
+
+/*
+	Step
+
+* What does this do? For every trading pair:
+* - Get the price of the trading pair
+* - Get the open position
+* - Calculate the potential profit
+* - If the potential profit is less than -5%, set the signal to SELL
+* - If the signal is SELL, sell the position
+* - If the signal is BUY, buy the position
+*/
+func (e *Engine) Step() {
+	for _, pair := range e.pairs {
+		e.step(pair)
+	}
+}
+
+func (e *Engine) step(pair string) {
+	price, err := e.exchange.GetPrice(pair)
+	if err != nil {
+		e.log.Error("Error getting price for %s: %v", pair, err)
+		e.notifyError(err)
+		return
+	}
+
+	/* What is a signal?
+	* It is a signal that the trading bot will follow
+	* which based on the strategy
+	 */
+	var signal *models.Signal
+
+	/* Get the last buy trade there is no error,
+	calculate the potential profit
+	*/
+	lastBuy, position, err := e.openPosition(pair)
+	if err == nil && lastBuy != nil {
+
+		/* TODO: Profit Calculation might need to be in a different function
+		to handle more complex calculations
+		*/
+		potentialProfit := ((price - lastBuy.Price) / lastBuy.Price) * 100
+		e.log.Info("📊 %s Current Price: %.2f | Entry: %.2f | PnL: %.2f%%",
+			pair, price, lastBuy.Price, potentialProfit)
+
+		/*
+		* Exit checks
+		* - Emergency sell if the potential profit is less than -5%,
+		*   except for positions accumulated by grid or DCA
+		* - Stop-loss and take-profit levels the strategy set for the position
+		 */
+		switch {
+		case potentialProfit < -5.0 && !e.accumulates[pair]:
+			e.log.Error("⚠️🔴 Emergency sell at 5%% loss")
+			signal = &models.Signal{
+				Symbol: pair,
+				Action: "SELL",
+				Reason: "emergency sell at 5% loss",
+			}
+		case lastBuy.StopLoss > 0 && price <= lastBuy.StopLoss:
+			e.log.Error("⚠️🔴 %s stop-loss hit at %.2f (stop %.2f)", pair, price, lastBuy.StopLoss)
+			signal = &models.Signal{
+				Symbol: pair,
+				Action: "SELL",
+				Reason: fmt.Sprintf("stop-loss %.2f hit", lastBuy.StopLoss),
+			}
+		case lastBuy.TakeProfit > 0 && price >= lastBuy.TakeProfit:
+			e.log.Info("🎯 %s take-profit reached at %.2f (target %.2f)", pair, price, lastBuy.TakeProfit)
+			signal = &models.Signal{
+				Symbol: pair,
+				Action: "SELL",
+				Reason: fmt.Sprintf("take-profit %.2f reached", lastBuy.TakeProfit),
+			}
+		}
+	}
+
+	/*
+	* Analyze market data
+	* Higher timeframe strategies get their closed candles,
+	* without them they simply won't find an entry
+	 */
+	now := e.clock.Now()
+	var frames map[string][]models.Kline
+	if intervals := e.subscriptions[pair]; len(intervals) > 0 {
+		if frames, err = e.feed.Frames(pair, intervals, now); err != nil {
+			e.log.Error("Error getting candles for %s: %v", pair, err)
+		}
+	}
+	bar := &models.MarketData{
+		Symbol:   pair,
+		Price:    price,
+		Time:     now,
+		Frames:   frames,
+		Position: position,
+	}
+	if source, ok := e.exchange.(candleSource); ok {
+		if candle, ok := source.LastCandle(pair); ok {
+			bar.Open, bar.High, bar.Low, bar.Volume = candle.Open, candle.High, candle.Low, candle.Volume
+		}
+	}
+	if e.watchesBook[pair] && e.Book != nil {
+		bar.Book, bar.Flow = e.Book(pair, now)
+		if bar.Book == nil {
+			e.log.Debug("No order book for %s yet", pair)
+		}
+	}
+	if e.Observe != nil {
+		e.Observe(bar)
+	}
+
+	/*
+	* Multi-symbol strategies (pairs) see every leg's price at once,
+	* their signals for the other legs are traded right away.
+	* The other legs don't run a strategy of their own.
+	 */
+	var strategySignals []*models.Signal
+	bars := map[string]*models.MarketData{pair: bar}
+	if multi, ok := e.strategies[pair].(strategy.MultiSymbol); ok {
+		if bars, err = e.legBars(multi, bar); err != nil {
+			e.log.Error("Error pricing legs of %s: %v", pair, err)
+			e.notifyError(err)
+		} else {
+			strategySignals = strategy.AnalyzeAll(multi, bars)
+		}
+	} else if _, isLeg := e.legOwners[pair]; !isLeg {
+		if strategySignal := strategy.Analyze(e.strategies[pair], bar); strategySignal != nil {
+			strategySignals = append(strategySignals, strategySignal)
+		}
+	}
+
+	if reporter, ok := e.regimeReporters[pair]; ok {
+		e.regimes.Set(pair, reporter.Regime(pair))
+	} else {
+		high, low := bar.HighLow()
+		e.regimeDetectors[pair].Update(high, low, price)
+		e.regimes.Set(pair, e.regimeDetectors[pair].Current())
+	}
+
+	/* Exit checks take priority over the strategy's signals for the pair */
+	if signal != nil {
+		e.trade(pair, price, lastBuy, signal, true)
+	}
+	for _, strategySignal := range strategySignals {
+		legBar, ok := bars[strategySignal.Symbol]
+		switch {
+		case !ok:
+			e.log.Error("Strategy for %s signalled %s, which it doesn't trade", pair, strategySignal.Symbol)
+		case strategySignal.Symbol == pair:
+			if signal == nil {
+				e.trade(pair, price, lastBuy, strategySignal, false)
+			}
+		default:
+			legBuy, _, err := e.openPosition(strategySignal.Symbol)
+			if err != nil {
+				legBuy = nil
+			}
+			e.trade(strategySignal.Symbol, legBar.Price, legBuy, strategySignal, false)
+		}
+	}
+}
+
+/*
+*  openPosition returns the pair's open buy the bot acts on and the
+*  position it belongs to, nil without one. The buy is priced at the
+*  position's average cost, which only differs from its own price when
+*  several buys were added to the position (grid, DCA).
+ */
+func (e *Engine) openPosition(pair string) (*models.Trade, *models.Position, error) {
+	lastBuy, err := e.exchange.GetOpenPosition(pair)
+	if err != nil || lastBuy == nil {
+		return nil, nil, err
+	}
+	trades, err := e.exchange.GetTrades(pair)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	position := &models.Position{ID: lastBuy.PositionID}
+	var bought, cost float64
+	for _, trade := range trades {
+		if trade.PositionID != lastBuy.PositionID || trade.Status == "CANCELED" {
+			continue
+		}
+		if trade.Side == "BUY" {
+			bought += trade.Quantity
+			cost += trade.Price * trade.Quantity
+		} else {
+			position.Quantity -= trade.Quantity
+		}
+	}
+	position.Quantity += bought
+	entry := *lastBuy
+	if bought > 0 {
+		position.AverageCost = cost / bought
+		entry.Price = position.AverageCost
+	}
+	return &entry, position, nil
+}
+
+/* legBars prices every leg of a multi-symbol strategy, the pair's own bar included */
+func (e *Engine) legBars(multi strategy.MultiSymbol, bar *models.MarketData) (map[string]*models.MarketData, error) {
+	bars := map[string]*models.MarketData{bar.Symbol: bar}
+	for _, symbol := range multi.Symbols() {
+		if symbol == bar.Symbol {
+			continue
+		}
+		price, err := e.exchange.GetPrice(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s price: %v", symbol, err)
+		}
+		bars[symbol] = &models.MarketData{Symbol: symbol, Price: price, Time: bar.Time}
+	}
+	return bars, nil
+}
+
+/*
+* Trade a signal
+* - BUY: size the order from the signal and the risk manager
+* - SELL: close the open position of the pair. Exit signals (stop-loss,
+*   take-profit, emergency) sell at any price, a strategy's only when
+*   the position is not at a loss, unless it sized the sell itself or
+*   manages its own exits (strategy.ExitManager).
+ */
+func (e *Engine) trade(pair string, price float64, lastBuy *models.Trade, signal *models.Signal, exit bool) {
+	e.log.Info("🔍 %s Analysis - Price: %.2f USDT, Signal: %s (%s)",
+		pair, price, signal.Action, signal.Reason)
+
+	/* Get current account balance */
+	balances, err := e.exchange.GetBalance()
+	if err != nil {
+		e.log.Error("Error getting balance: %v", err)
+		return
+	}
+
+	/* Balance of the pair's base asset, e.g. ETH for ETHUSDT */
+	baseBalance := balances[strings.TrimSuffix(pair, "USDT")]
+
+	/*
+	* BUY signal handling
+	 */
+	if signal.Action == "BUY" {
+		usdtBalance := balances["USDT"]
+		if usdtBalance < e.minOrderSize {
+			e.log.Debug("💰 Insufficient USDT balance (%.2f) for trading", usdtBalance)
+			return
+		}
+
+		e.log.Info("🟢 BUY Signal - %s at %.2f USDT (Balance: %.2f USDT)",
+			pair, price, usdtBalance)
+
+		/* Calculate position size from the signal's stop-loss and confidence,
+		*  strategies that size their own orders (e.g. grid) set the quantity
+		 */
+		quantity, stopLoss, err := e.riskManager.CalculateSignalPositionSize(price, signal)
+		if err != nil {
+			e.log.Error("Error calculating position size: %v", err)
+			return
+		}
+		if signal.Quantity > 0 {
+			quantity = signal.Quantity
+		}
+
+		/* Ensure we don't exceed available USDT and respect minimum order size */
+		maxQuantity := (usdtBalance * 0.95) / price
+		if quantity > maxQuantity {
+			quantity = maxQuantity
+		}
+
+		/* Keep the positions within the exposure limits */
+		if room := e.exposureRoom(pair, price, balances); quantity*price > room {
+			quantity = math.Max(room, 0) / price
+		}
+
+		/* Ensure minimum order size */
+		minOrderValue := quantity * price
+		if minOrderValue < e.minOrderSize {
+			e.log.Debug("💡 Order value (%.2f) below minimum (%.2f), skipping", minOrderValue, e.minOrderSize)
+			return
+		}
+
+		/* Generate position ID for tracking, grid and DCA buys add to the open position */
+		positionID := generateUUID()
+		if lastBuy != nil && e.accumulates[pair] {
+			positionID = lastBuy.PositionID
+		}
+
+		/* Accumulated buys without a stop of their own rest none, DCA buys the dips */
+		noStopLoss := e.accumulates[pair] && signal.StopLoss <= 0
+
+		order := &models.Order{
+			Symbol:        signal.Symbol,
+			Side:          "BUY",
+			Type:          "MARKET",
+			Quantity:      quantity,
+			Price:         price,
+			Timestamp:     e.clock.Now(),
+			StopLossPrice: stopLoss,
+			NoStopLoss:    noStopLoss,
+		}
+
+		/* Place the buy order */
+		if err := e.exchange.PlaceOrder(order); err != nil {
+			e.log.Error("❌ Failed to place BUY order: %v", err)
+			e.notifyError(err)
+			return
+		}
+
+		/* Save trade to database */
+		trade := &models.Trade{
+			Symbol:     order.Symbol,
+			Side:       order.Side,
+			Price:      price,
+			Quantity:   order.Quantity,
+			Value:      price * order.Quantity,
+			Fee:        order.Fee,
+			Timestamp:  order.Timestamp,
+			PositionID: positionID,
+			Status:     "OPEN",
+			Reason:     signal.Reason,
+			StopLoss:   signal.StopLoss,
+			TakeProfit: signal.TakeProfit,
+			OwnExits:   signal.ManagesExits,
+		}
+
+		if err := e.exchange.SaveTrade(trade); err != nil {
+			e.log.Error("Error saving trade: %v", err)
+			return
+		}
+
+		/* Notify about successful buy */
+		e.filled(pair, trade)
+		if e.Notifier != nil {
+			e.Notifier.NotifyTrade(order.Symbol, order.Side, price, order.Quantity)
+		}
+
+		e.log.Info("✅ BUY Order Filled - %s: %.8f at %.2f USDT (Total: %.2f USDT)",
+			pair, quantity, price, quantity*price)
+
+		/* Don't wait for the periodic save to remember the entry */
+		if e.OnTrade != nil {
+			e.OnTrade()
+		}
+	}
+
+	/*
+	* SELL signal handling
+	 */
+
+	/*
+	* If the last buy trade is not nil, calculate the potential profit
+	* and check if the potential profit is less than -8%, set the signal to SELL
+	 */
+	if lastBuy != nil {
+		potentialProfit := ((price - lastBuy.Price) / lastBuy.Price) * 100
+
+		/* Added protection to sell the position if the potential profit is less than -8% */
+		if potentialProfit < -8.0 && !e.accumulates[pair] {
+			e.log.Error("⚠️🔴 Emergency sell at 8%% loss")
+			signal.Action = "SELL"
+			exit = true
+		}
+
+		/*
+		* Positions opened without a strategy take-profit keep the fixed
+		* 2% target and tiered exits. Strategies that size their own
+		* orders (grid, DCA) or track their position manage their own
+		* exits, decided by the strategy that opened it: in a composite
+		* that is one child, not the whole tree. Only its own SELLs go
+		* through at a loss.
+		 */
+		ownExits := lastBuy.OwnExits
+		fixedTargets := lastBuy.TakeProfit == 0 && signal.Quantity == 0 && !ownExits && !e.accumulates[pair]
+		sizedSell := signal.Action == "SELL" && signal.Quantity > 0
+		profitTarget := fixedTargets && potentialProfit >= 2.0
+
+		/*
+		* Sell when:
+		* 1. We get an exit, a sized SELL, a SELL of a strategy managing
+		*    its exits, a SELL signal without a loss or meet the fixed
+		*    profit target
+		* 2. We have crypto balance to sell
+		 */
+		sell := signal.Action == "SELL" && (exit || sizedSell || (ownExits && signal.ManagesExits) || potentialProfit >= 0)
+		if (sell && baseBalance > 0.0001) || profitTarget {
+			e.log.Info("🔴 SELL Signal - %s at %.2f USDT (Entry: %.2f, PnL: %.2f%%)",
+				pair, price, lastBuy.Price, potentialProfit)
+
+			sellQuantity := baseBalance
+
+			/*
+			* Tiered exit system
+			* TODO: To verify is this relevant?
+
+			*  - Sell the strategy's own quantity when it sets one (e.g. grid)
+			*  - Sell 50% at 5% profit
+			*  - Sell 30% at 3% profit
+			 */
+			if sizedSell {
+				sellQuantity = math.Min(signal.Quantity, baseBalance)
+			} else if fixedTargets && potentialProfit >= 5.0 {
+				sellQuantity = baseBalance * 0.5 // Sell 50% at 5% profit
+				e.log.Info("📈 Taking 50%% profit at %.2f%%", potentialProfit)
+			} else if fixedTargets && potentialProfit >= 3.0 {
+				sellQuantity = baseBalance * 0.3 // Sell 30% at 3% profit
+				e.log.Info("📈 Taking 30%% profit at %.2f%%", potentialProfit)
+			}
+
+			/* A rest too small to ever be sold on its own goes with this sell */
+			if (baseBalance-sellQuantity)*price < e.minOrderSize {
+				sellQuantity = baseBalance
+			}
+
+			order := &models.Order{
+				Symbol:    signal.Symbol,
+				Side:      "SELL",
+				Type:      "MARKET",
+				Quantity:  sellQuantity,
+				Price:     price,
+				Timestamp: e.clock.Now(),
+			}
+
+			/* Place the sell order */
+			if err := e.exchange.PlaceOrder(order); err != nil {
+				e.log.Error("❌ Failed to place SELL order: %v", err)
+				e.notifyError(err)
+				return
+			}
+
+			/*
+			* The sell canceled the position's stop-loss order. A partial
+			* sell keeps the position open and re-places the stop for what
+			* is left, below the current price, unless the position rests
+			* none (DCA); a full sell closes it.
+			 */
+			remaining := baseBalance - order.Quantity
+			switch {
+			case remaining*price < e.minOrderSize:
+				if err := e.exchange.UpdateTradeStatus(lastBuy.PositionID, "CLOSED"); err != nil {
+					e.log.Error("Error closing position: %v", err)
+				}
+			case lastBuy.StopLoss > 0 || !e.accumulates[pair]:
+				stopLoss := lastBuy.StopLoss
+				if stopLoss <= 0 {
+					stopLoss = lastBuy.Price * 0.995
+				}
+				stopLoss = math.Min(stopLoss, price*0.995)
+				stopOrder := &models.Order{
+					Symbol:        signal.Symbol,
+					Quantity:      remaining,
+					StopLossPrice: stopLoss,
+					Timestamp:     e.clock.Now(),
+				}
+				if err := e.exchange.PlaceStopLoss(stopOrder); err != nil {
+					e.log.Error("Error placing stop loss for the remaining %.8f %s: %v", remaining, pair, err)
+					e.notifyError(err)
+				}
+			}
+
+			/* Save trade to database with proper position linking */
+			sellTrade := &models.Trade{
+				Symbol:     order.Symbol,
+				Side:       order.Side,
+				Price:      price,
+				Quantity:   order.Quantity,
+				Value:      price * order.Quantity,
+				Fee:        order.Fee,
+				Timestamp:  order.Timestamp,
+				PositionID: lastBuy.PositionID,
+				Status:     "CLOSED",
+				PnL:        (price - lastBuy.Price) * order.Quantity,
+				PnLPercent: potentialProfit,
+				Reason:     signal.Reason,
+			}
+
+			if err := e.exchange.SaveTrade(sellTrade); err != nil {
+				e.log.Error("Error saving trade: %v", err)
+				return
+			}
+
+			/* Notify about successful sell */
+			e.filled(pair, sellTrade)
+			if e.Notifier != nil {
+				e.Notifier.NotifyTrade(order.Symbol, order.Side, price, order.Quantity)
+			}
+
+			e.log.Info("✅ SELL Order Filled - %s: %.8f at %.2f USDT (PnL: %.2f%%)",
+				pair, order.Quantity, price, potentialProfit)
+			if e.OnTrade != nil {
+				e.OnTrade()
+			}
+		}
+	}
+}
+
+/* filled hands a saved trade to the strategy that trades the pair */
+func (e *Engine) filled(pair string, trade *models.Trade) {
+	s := e.strategies[pair]
+	if owner, isLeg := e.legOwners[pair]; isLeg {
+		s = e.strategies[owner]
+	}
+	strategy.NotifyFilled(s, *trade)
+}
+
+/*
+*  exposureRoom returns how many USDT the pair's position may still
+*  grow by under MaxExposure and MaxSymbolExposure, +Inf without them.
+*  Equity is the USDT balance plus the positions of every pair at their
+*  current price.
+ */
+func (e *Engine) exposureRoom(pair string, price float64, balances map[string]float64) float64 {
+	room := math.Inf(1)
+	if e.MaxExposure <= 0 && e.MaxSymbolExposure <= 0 {
+		return room
+	}
+
+	var exposure, pairExposure float64
+	for _, p := range e.pairs {
+		pairPrice := price
+		if p != pair {
+			var err error
+			if pairPrice, err = e.exchange.GetPrice(p); err != nil {
+				e.log.Error("Error getting price for %s: %v", p, err)
+				continue
+			}
+		}
+		value := balances[strings.TrimSuffix(p, "USDT")] * pairPrice
+		exposure += value
+		if p == pair {
+			pairExposure = value
+		}
+	}
+	equity := balances["USDT"] + exposure
+
+	if e.MaxExposure > 0 {
+		room = math.Min(room, e.MaxExposure*equity-exposure)
+	}
+	if e.MaxSymbolExposure > 0 {
+		room = math.Min(room, e.MaxSymbolExposure*equity-pairExposure)
+	}
+	if room < e.minOrderSize {
+		e.log.Debug("💡 %s exposure limit reached (%.2f of %.2f USDT equity in positions)", pair, exposure, equity)
+	}
+	return room
+}
+
+/*
+*  Generate a UUID
+ */
+func generateUUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic("failed to generate UUID: " + err.Error())
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
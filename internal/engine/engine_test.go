@@ -0,0 +1,332 @@
+package engine
+
+import (
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/logger"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/risk"
+	"github.com/marwanbukhori/player-cryptobot/internal/strategy"
+)
+
+/* scripted gives a signal on the bars it was told to */
+type scripted struct {
+	bar     int
+	signals map[int]models.Signal
+}
+
+func (s *scripted) Analyze(data *models.MarketData) *models.Signal {
+	s.bar++
+	signal, ok := s.signals[s.bar]
+	if !ok {
+		return nil
+	}
+	signal.Symbol, signal.Price = data.Symbol, data.Price
+	return &signal
+}
+
+func TestEngineOnSimExchange(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{TakerBps: 10})
+	strat := &scripted{signals: map[int]models.Signal{
+		2: {Action: "BUY", StopLoss: 97, TakeProfit: 110},
+		4: {Action: "BUY"},
+		5: {Action: "SELL"},
+	}}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": strat},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	candle := func(i int, low, close float64) models.Kline {
+		open := start + int64(i)*60000
+		return models.Kline{OpenTime: open, Open: close, High: close, Low: low, Close: close, Volume: 1, CloseTime: open + 59999}
+	}
+	bars := []models.Kline{
+		candle(0, 100, 100),
+		candle(1, 100, 100), // BUY, risk sized down to the 97 stop
+		candle(2, 96.5, 98), // the resting stop-loss order fills at 97
+		candle(3, 100, 100), // BUY without levels, default 0.5% stop
+		candle(4, 100, 103), // SELL at +3%: the tiered exit takes 30%
+		candle(5, 99, 100),  // the stop re-placed for the other 70% fills at 99.5
+	}
+	for i, k := range bars {
+		sim.AddCandle("ETHUSDT", k)
+		e.Step()
+		if want := time.UnixMilli(k.CloseTime + 1); !sim.Now().Equal(want) {
+			t.Fatalf("bar %d: clock at %v, expected %v", i, sim.Now(), want)
+		}
+	}
+
+	trades := sim.Trades()
+	if len(trades) != 5 {
+		t.Fatalf("Expected 5 trades, got %d: %+v", len(trades), trades)
+	}
+	if trades[0].Side != "BUY" || trades[0].Quantity != 6.66 {
+		t.Errorf("Expected a risk sized buy of 6.66, got %s %.4f", trades[0].Side, trades[0].Quantity)
+	}
+	if stop := trades[1]; stop.Side != "SELL" || stop.Price != 97 || stop.PositionID != trades[0].PositionID || stop.PnL >= 0 {
+		t.Errorf("Expected the stop-loss order to close the first position at 97, got %+v", stop)
+	}
+	if trades[0].Status != "CLOSED" {
+		t.Errorf("Expected the stopped position to be closed")
+	}
+	held := trades[2].Quantity * 0.999
+	if sell := trades[3]; sell.Side != "SELL" || math.Abs(sell.Quantity-roundLot(held*0.3)) > 1e-9 {
+		t.Errorf("Expected the tiered exit to sell 30%% of %.4f, got %.4f", held, sell.Quantity)
+	}
+	rest := roundLot(held - trades[3].Quantity)
+	if stop := trades[4]; stop.Side != "SELL" || stop.Price != 99.5 || math.Abs(stop.Quantity-rest) > 1e-9 || stop.PositionID != trades[2].PositionID {
+		t.Errorf("Expected the remaining %.4f to be stopped out at 99.5 within the position, got %+v", rest, stop)
+	}
+	if trades[2].Status != "CLOSED" {
+		t.Errorf("Expected the position to be closed once fully sold")
+	}
+
+	balances, _ := sim.GetBalance()
+	if math.Abs(sim.Equity()-(balances["USDT"]+balances["ETH"]*100)) > 1e-9 {
+		t.Errorf("Equity %.4f doesn't match the balances %v", sim.Equity(), balances)
+	}
+}
+
+/* roundLot rounds like the exchange does for quantities of 0.1 and up */
+func roundLot(quantity float64) float64 {
+	return math.Floor(quantity*100) / 100
+}
+
+func TestEngineRejectsShortSelling(t *testing.T) {
+	pairs, err := strategy.NewFromSpec("pairs{a: BTCUSDT, b: ETHUSDT, mode: hedge}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sim := exchange.NewSimExchange(nil, exchange.Costs{})
+	_, err = New(sim, sim, []string{"BTCUSDT", "ETHUSDT"},
+		map[string]strategy.Strategy{"BTCUSDT": pairs, "ETHUSDT": &scripted{}},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err == nil {
+		t.Errorf("Expected hedge mode to be rejected on spot")
+	}
+}
+
+func TestEngineExposureLimits(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{TakerBps: 10})
+	buy := map[int]models.Signal{1: {Action: "BUY"}}
+	e, err := New(sim, sim, []string{"BTCUSDT", "ETHUSDT"},
+		map[string]strategy.Strategy{"BTCUSDT": &scripted{signals: buy}, "ETHUSDT": &scripted{signals: buy}},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e.MaxExposure, e.MaxSymbolExposure = 0.5, 0.3
+
+	k := models.Kline{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1000, CloseTime: 59999}
+	sim.AddCandle("BTCUSDT", k)
+	sim.AddCandle("ETHUSDT", k)
+	e.Step()
+
+	/* The risk manager sizes 400 USDT each: BTC is capped at 30% of
+	*  equity, ETH at what is left of 50% */
+	trades := sim.Trades()
+	if len(trades) != 2 {
+		t.Fatalf("Expected 2 buys, got %d: %+v", len(trades), trades)
+	}
+	if trades[0].Value > 300 || trades[0].Value < 290 {
+		t.Errorf("Expected the BTC buy capped at 300 USDT, got %.2f", trades[0].Value)
+	}
+	balances, _ := sim.GetBalance()
+	equity := sim.Equity()
+	if exposure := equity - balances["USDT"]; exposure > 0.5*equity+1e-9 || trades[1].Value < 190 {
+		t.Errorf("Expected positions of at most half the equity, got %.2f of %.2f", exposure, equity)
+	}
+}
+
+func TestEngineKeepsLosingPositionsAndTieredExits(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{})
+	strat := &scripted{signals: map[int]models.Signal{
+		2: {Action: "BUY", StopLoss: 99}, // A stop like mean_reversion's, no take-profit
+		3: {Action: "SELL"},
+		4: {Action: "SELL"},
+	}}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": strat},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, price := range []float64{100, 100, 99.5, 103} {
+		sim.AddCandle("ETHUSDT", models.Kline{OpenTime: int64(i) * 60000, Open: price, High: price, Low: price,
+			Close: price, Volume: 1, CloseTime: int64(i)*60000 + 59999})
+		e.Step()
+	}
+
+	/* The SELL at -0.5% is left to the stop, at +3% the tiered exit sells 30% */
+	trades := sim.Trades()
+	if len(trades) != 2 || trades[0].Side != "BUY" || trades[1].Side != "SELL" {
+		t.Fatalf("Expected a buy and one sell, got %+v", trades)
+	}
+	if sell := trades[1]; sell.Price != 103 || math.Abs(sell.Quantity-roundLot(trades[0].Quantity*0.3)) > 1e-9 {
+		t.Errorf("Expected 30%% of %.4f sold at 103, got %.4f at %.2f", trades[0].Quantity, sell.Quantity, sell.Price)
+	}
+}
+
+/* ownExits is a scripted strategy that manages its own exits */
+type ownExits struct{ scripted }
+
+func (*ownExits) ManagesExits() bool { return true }
+
+func TestEngineSellsAtLossForExitManagers(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{})
+	strat := &ownExits{scripted{signals: map[int]models.Signal{
+		2: {Action: "BUY", StopLoss: 95},
+		3: {Action: "SELL"},
+	}}}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": strat},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, price := range []float64{100, 100, 99} {
+		sim.AddCandle("ETHUSDT", models.Kline{OpenTime: int64(i) * 60000, Open: price, High: price, Low: price,
+			Close: price, Volume: 1, CloseTime: int64(i)*60000 + 59999})
+		e.Step()
+	}
+
+	/* The SELL at -1% closes the whole position */
+	trades := sim.Trades()
+	if len(trades) != 2 || trades[1].Side != "SELL" || trades[1].Quantity != trades[0].Quantity || trades[0].Status != "CLOSED" {
+		t.Fatalf("Expected the position sold in full at a loss, got %+v", trades)
+	}
+}
+
+func TestEngineExitsByTheChildThatOpened(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{})
+
+	/* Weighted 3 to 1 with votes for one bar: each child decides alone */
+	plain := &scripted{signals: map[int]models.Signal{2: {Action: "BUY", StopLoss: 95}}}
+	exits := &ownExits{scripted{signals: map[int]models.Signal{3: {Action: "SELL"}, 5: {Action: "SELL"}}}}
+	strat, err := strategy.NewEnsembleStrategy(strategy.EnsembleWeighted, 0.2, 1,
+		[]strategy.Strategy{plain, exits}, []string{"plain", "exits"}, []float64{3, 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": strat},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, price := range []float64{100, 100, 99, 100, 103} {
+		sim.AddCandle("ETHUSDT", models.Kline{OpenTime: int64(i) * 60000, Open: price, High: price, Low: price,
+			Close: price, Volume: 1, CloseTime: int64(i)*60000 + 59999})
+		e.Step()
+	}
+
+	/* The plain child's position keeps the no-loss guard and the tiered exits */
+	trades := sim.Trades()
+	if len(trades) != 2 || trades[0].OwnExits || trades[1].Side != "SELL" || trades[1].Price != 103 {
+		t.Fatalf("Expected the SELL at -1%% held and one at +3%%, got %+v", trades)
+	}
+	if sell := trades[1]; math.Abs(sell.Quantity-roundLot(trades[0].Quantity*0.3)) > 1e-9 {
+		t.Errorf("Expected 30%% of %.4f sold at 103, got %.4f", trades[0].Quantity, sell.Quantity)
+	}
+}
+
+/* accumulator is a scripted strategy that adds buys to its position, like grid */
+type accumulator struct {
+	scripted
+	filled    []models.Trade
+	positions []*models.Position
+}
+
+func (*accumulator) Accumulates() bool { return true }
+
+func (a *accumulator) Filled(trade models.Trade) { a.filled = append(a.filled, trade) }
+
+func (a *accumulator) Analyze(data *models.MarketData) *models.Signal {
+	a.positions = append(a.positions, data.Position)
+	return a.scripted.Analyze(data)
+}
+
+func TestEngineAccumulatesOnePosition(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{})
+	strat := &accumulator{scripted: scripted{signals: map[int]models.Signal{
+		2: {Action: "BUY", Quantity: 0.5, StopLoss: 80},
+		3: {Action: "BUY", Quantity: 0.5, StopLoss: 80},
+		4: {Action: "SELL", Quantity: 1},
+	}}}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": strat},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* The dip to 94 is -6%, no emergency sell for an accumulated position */
+	for i, price := range []float64{100, 100, 94, 98} {
+		sim.AddCandle("ETHUSDT", models.Kline{OpenTime: int64(i) * 60000, Open: price, High: price, Low: price,
+			Close: price, Volume: 1, CloseTime: int64(i)*60000 + 59999})
+		e.Step()
+	}
+
+	trades := sim.Trades()
+	if len(trades) != 3 || trades[1].Side != "BUY" || trades[2].Side != "SELL" {
+		t.Fatalf("Expected two buys and a sell, got %+v", trades)
+	}
+	if trades[1].PositionID != trades[0].PositionID || trades[2].PositionID != trades[0].PositionID {
+		t.Errorf("Expected every trade in one position, got %q, %q and %q",
+			trades[0].PositionID, trades[1].PositionID, trades[2].PositionID)
+	}
+	if position := strat.positions[3]; position == nil || position.Quantity != 1 || math.Abs(position.AverageCost-97) > 1e-9 {
+		t.Errorf("Expected a position of 1 at an average cost of 97, got %+v", position)
+	}
+	if math.Abs(trades[2].PnL-1) > 1e-9 || trades[0].Status != "CLOSED" {
+		t.Errorf("Expected the sell to close the position with 1 USDT over the average cost, got %+v", trades)
+	}
+	if len(strat.filled) != 3 || strat.filled[2].Side != "SELL" {
+		t.Errorf("Expected the strategy told of all 3 trades, got %+v", strat.filled)
+	}
+}
+
+func TestEngineKeepsTheDCAStackThroughDips(t *testing.T) {
+	sim := exchange.NewSimExchange(map[string]float64{"USDT": 1000}, exchange.Costs{})
+	dca, err := strategy.NewFromSpec("dca{amount: 100, interval: 1m, take_profit: 5}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := New(sim, sim, []string{"ETHUSDT"}, map[string]strategy.Strategy{"ETHUSDT": dca},
+		risk.NewRiskManager(1000, 0.2, 0.02, 1, false), 10, logger.NewLoggerTo(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* -20% at 80 would have hit a default stop and the emergency sells */
+	for i, price := range []float64{100, 90, 80, 95} {
+		sim.AddCandle("ETHUSDT", models.Kline{OpenTime: int64(i) * 60000, Open: price, High: price, Low: price,
+			Close: price, Volume: 1, CloseTime: int64(i)*60000 + 59999})
+		e.Step()
+	}
+
+	trades := sim.Trades()
+	if len(trades) != 4 || trades[3].Side != "SELL" {
+		t.Fatalf("Expected three buys and the take-profit sell, got %+v", trades)
+	}
+	var bought, cost float64
+	for _, trade := range trades[:3] {
+		if trade.Side != "BUY" || trade.PositionID != trades[3].PositionID {
+			t.Fatalf("Expected three buys in the sold position, got %+v", trades)
+		}
+		bought += trade.Quantity
+		cost += trade.Price * trade.Quantity
+	}
+	if math.Abs(trades[3].Quantity-bought) > 1e-9 {
+		t.Errorf("Expected the whole stack of %.8f sold, got %.8f", bought, trades[3].Quantity)
+	}
+	if pnl := (95 - cost/bought) * bought; math.Abs(trades[3].PnL-pnl) > 1e-6 {
+		t.Errorf("Expected a PnL of %.4f over the average cost, got %.4f", pnl, trades[3].PnL)
+	}
+}
@@ -175,6 +175,7 @@ func roundToValidQuantity(quantity float64) float64 {
 * All the exchange Query Functions
 * TODO: To verify each query
 * - PlaceOrder
+* - PlaceStopLoss
 * - GetPrice
 * - placeStopLossOrder
 * - GetHistoricalData
@@ -225,10 +226,16 @@ func (b *binanceExchange) PlaceOrder(order *models.Order) error {
 				usdtBalance, order.Price*order.Quantity)
 		}
 	} else {
-		/* Check BTC balance for selling */
-		if btcBalance := balances["BTC"]; btcBalance < order.Quantity {
-			return fmt.Errorf("insufficient BTC balance: have %.8f, need %.8f",
-				btcBalance, order.Quantity)
+		/* Check the base asset balance for selling, e.g. ETH for ETHUSDT */
+		base := baseAsset(order.Symbol)
+		if baseBalance := balances[base]; baseBalance < order.Quantity {
+			return fmt.Errorf("insufficient %s balance: have %.8f, need %.8f",
+				base, baseBalance, order.Quantity)
+		}
+
+		/* The stop-loss orders of earlier buys lock the quantity, cancel them first */
+		if _, err := b.client.NewCancelOpenOrdersService().Symbol(order.Symbol).Do(context.Background()); err != nil {
+			logrus.Warnf("Failed to cancel open %s orders before selling: %v", order.Symbol, err)
 		}
 	}
 
@@ -260,10 +267,20 @@ func (b *binanceExchange) PlaceOrder(order *models.Order) error {
 	order.Price, _ = strconv.ParseFloat(result.Price, 64)
 	order.Quantity, _ = strconv.ParseFloat(result.ExecutedQuantity, 64)
 
-	/* Immediately place stop loss order after successful buy
+	/* Market orders report price 0, use the average fill price instead */
+	if quote := parseFloat(result.CummulativeQuoteQuantity); order.Price == 0 && order.Quantity > 0 && quote > 0 {
+		order.Price = quote / order.Quantity
+	}
+	order.Fee = b.fillFee(order.Symbol, result.Fills)
+
+	/* Immediately place stop loss order after successful buy,
+	*  at the requested stop or 0.5% below the fill price
 	 */
-	if order.Side == "BUY" {
-		stopLossPrice := order.Price * 0.995
+	if order.Side == "BUY" && !order.NoStopLoss {
+		stopLossPrice := order.StopLossPrice
+		if stopLossPrice <= 0 || stopLossPrice >= order.Price {
+			stopLossPrice = order.Price * 0.995
+		}
 		if stopLossPrice <= 0 {
 			return fmt.Errorf("invalid stop loss price: %.2f", stopLossPrice)
 		}
@@ -288,6 +305,32 @@ func (b *binanceExchange) PlaceOrder(order *models.Order) error {
 	return nil
 }
 
+/*
+*  fillFee sums the commission of an order's fills in USDT. Binance
+*  charges it in the asset received or in BNB, those are valued at the
+*  fill price or BNB's current price.
+ */
+func (b *binanceExchange) fillFee(symbol string, fills []*binance.Fill) float64 {
+	var fee float64
+	for _, fill := range fills {
+		commission := parseFloat(fill.Commission)
+		switch fill.CommissionAsset {
+		case "USDT":
+			fee += commission
+		case baseAsset(symbol):
+			fee += commission * parseFloat(fill.Price)
+		default:
+			price, err := b.GetPrice(fill.CommissionAsset + "USDT")
+			if err != nil {
+				logrus.Warnf("Failed to price the %s commission of %s: %v", fill.CommissionAsset, symbol, err)
+				continue
+			}
+			fee += commission * price
+		}
+	}
+	return fee
+}
+
 /*
 	GetPrice
 
@@ -304,6 +347,32 @@ func (b *binanceExchange) GetPrice(symbol string) (float64, error) {
 	return strconv.ParseFloat(prices[0].Price, 64)
 }
 
+/*
+	PlaceStopLoss
+
+*  rests a stop-loss order for order.Quantity at order.StopLossPrice,
+*  e.g. for what is left of a position after a partial sell canceled
+*  its stop
+*/
+func (b *binanceExchange) PlaceStopLoss(order *models.Order) error {
+	quantity := roundToValidQuantity(order.Quantity)
+	if quantity <= 0 {
+		return fmt.Errorf("stop loss quantity too small: %.8f", order.Quantity)
+	}
+	if order.StopLossPrice <= 0 {
+		return fmt.Errorf("invalid stop loss price: %.2f", order.StopLossPrice)
+	}
+	return b.placeStopLossOrder(&models.Order{
+		Symbol:        order.Symbol,
+		Side:          "SELL",
+		Type:          "STOP_LOSS_LIMIT",
+		Quantity:      quantity,
+		Price:         order.StopLossPrice * 0.998,
+		StopLossPrice: order.StopLossPrice,
+		Timestamp:     time.Now(),
+	})
+}
+
 /*
 	placeStopLossOrder
 
@@ -371,12 +440,13 @@ func (b *binanceExchange) GetBalance() (map[string]float64, error) {
 		return nil, fmt.Errorf("failed to get account info: %v", err)
 	}
 
+	/* Locked counts too, it is held by our own stop-loss orders
+	*  which a sell cancels first
+	 */
 	balances := make(map[string]float64)
 	for _, b := range account.Balances {
-		if free, err := strconv.ParseFloat(b.Free, 64); err == nil {
-			if free > 0 {
-				balances[b.Asset] = free
-			}
+		if total := parseFloat(b.Free) + parseFloat(b.Locked); total > 0 {
+			balances[b.Asset] = total
 		}
 	}
 	return balances, nil
@@ -0,0 +1,142 @@
+package exchange
+
+import "math"
+
+/*
+	Costs
+
+*  what a simulated fill costs on top of the reference price:
+*  - MakerBps / TakerBps: exchange fee. Market orders and triggered
+*    stop-loss orders take liquidity and pay the taker fee, maker
+*    applies to limit orders resting on the book
+*  - Spread: price paid for crossing the spread, e.g. HalfSpread(1)
+*  - Slippage: price moved by the order itself, e.g. VolumeSlippage(0.1)
+*  - LatencyBars: bars between the decision and the fill. 0 fills at the
+*    price the decision saw, N at the open of the N-th bar after it
+*
+*  A nil Spread or Slippage costs nothing.
+*/
+type Costs struct {
+	MakerBps    float64
+	TakerBps    float64
+	Spread      CostModel
+	Slippage    CostModel
+	LatencyBars int
+}
+
+/* Fill describes a simulated fill to a CostModel */
+type Fill struct {
+	Side      string  // BUY or SELL
+	Price     float64 // Reference price before costs
+	Quantity  float64
+	BarVolume float64 // Base asset volume of the bar it fills in, 0 if unknown
+}
+
+/*
+*  CostModel returns how much worse than the reference price a fill
+*  gets, as a fraction of it (0.0005 = 5 bps)
+ */
+type CostModel interface {
+	Cost(fill Fill) float64
+}
+
+/* HalfSpread is a fixed half spread in bps, paid on every fill */
+type HalfSpread float64
+
+func (h HalfSpread) Cost(fill Fill) float64 {
+	return float64(h) / 10000
+}
+
+/*
+*  VolumeSlippage moves the price in proportion to the share of the
+*  bar's volume the order takes: VolumeSlippage(0.1) costs 0.1% for an
+*  order of 1% of the volume. Bars without volume don't slip, and no
+*  order slips more than MaxVolumeSlippage: one taking a bar's whole
+*  volume would otherwise sell for nothing.
+ */
+type VolumeSlippage float64
+
+/* MaxVolumeSlippage caps VolumeSlippage at 10% of the price */
+const MaxVolumeSlippage = 0.1
+
+func (v VolumeSlippage) Cost(fill Fill) float64 {
+	if fill.BarVolume <= 0 {
+		return 0
+	}
+	return math.Min(float64(v)*fill.Quantity/fill.BarVolume, MaxVolumeSlippage)
+}
+
+/*
+	CostTotals
+
+*  the costs paid so far in USDT. Latency is what the price moved
+*  against the order while it was on its way, negative when it
+*  moved in its favour.
+*/
+type CostTotals struct {
+	Fees     float64
+	Spread   float64
+	Slippage float64
+	Latency  float64
+}
+
+/* Total returns the sum of every cost */
+func (t CostTotals) Total() float64 {
+	return t.Fees + t.Spread + t.Slippage + t.Latency
+}
+
+/* Add returns the sum of two totals */
+func (t CostTotals) Add(other CostTotals) CostTotals {
+	return CostTotals{
+		Fees:     t.Fees + other.Fees,
+		Spread:   t.Spread + other.Spread,
+		Slippage: t.Slippage + other.Slippage,
+		Latency:  t.Latency + other.Latency,
+	}
+}
+
+/* Sub returns what was paid on top of an earlier total */
+func (t CostTotals) Sub(earlier CostTotals) CostTotals {
+	return CostTotals{
+		Fees:     t.Fees - earlier.Fees,
+		Spread:   t.Spread - earlier.Spread,
+		Slippage: t.Slippage - earlier.Slippage,
+		Latency:  t.Latency - earlier.Latency,
+	}
+}
+
+/* FeeRate returns the fee of an order type as a fraction */
+func (c Costs) FeeRate(orderType string) float64 {
+	if orderType == "LIMIT" {
+		return c.MakerBps / 10000
+	}
+	return c.TakerBps / 10000
+}
+
+/*
+	Fill
+
+*  prices a fill of quantity at the reference price: buys pay the
+*  spread and slippage above it, sells below it. Returns the fill
+*  price and what the spread, slippage and fee cost in USDT.
+*/
+func (c Costs) Fill(side, orderType string, price, quantity, barVolume float64) (float64, CostTotals) {
+	fill := Fill{Side: side, Price: price, Quantity: quantity, BarVolume: barVolume}
+	var spread, slippage float64
+	if c.Spread != nil {
+		spread = c.Spread.Cost(fill)
+	}
+	if c.Slippage != nil {
+		slippage = c.Slippage.Cost(fill)
+	}
+
+	fillPrice := price * (1 + spread + slippage)
+	if side != "BUY" {
+		fillPrice = price * (1 - spread - slippage)
+	}
+	return fillPrice, CostTotals{
+		Fees:     fillPrice * quantity * c.FeeRate(orderType),
+		Spread:   price * spread * quantity,
+		Slippage: price * slippage * quantity,
+	}
+}
@@ -1,6 +1,8 @@
 package exchange
 
 import (
+	"strings"
+
 	"github.com/marwanbukhori/player-cryptobot/internal/models"
 )
 
@@ -10,6 +12,7 @@ import (
 type Exchange interface {
 	GetPrice(symbol string) (float64, error)
 	PlaceOrder(order *models.Order) error
+	PlaceStopLoss(order *models.Order) error
 	GetBalance() (map[string]float64, error)
 	GetHistoricalData(symbol string, interval string, limit int) ([]models.Kline, error)
 	GetTradingSummary() ([]models.TradingSummary, error)
@@ -22,3 +25,8 @@ type Exchange interface {
 	GetTrades(symbol string) ([]*models.Trade, error)
 	UpdateTradeStatus(positionID string, status string) error
 }
+
+/* baseAsset returns the asset bought with USDT, e.g. ETH for ETHUSDT */
+func baseAsset(symbol string) string {
+	return strings.TrimSuffix(symbol, "USDT")
+}
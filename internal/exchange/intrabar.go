@@ -0,0 +1,78 @@
+package exchange
+
+import "fmt"
+
+/*
+	IntrabarRule
+
+*  decides which exit of a position a candle filled when its range
+*  reached both the stop and the target. A candle only has OHLC, not
+*  the path in between:
+*  - Pessimistic: the stop was hit first
+*  - OpenDistance: the level closer to the open was hit first
+*  - Optimistic: the target was hit first
+*/
+type IntrabarRule int
+
+const (
+	Pessimistic IntrabarRule = iota
+	OpenDistance
+	Optimistic
+)
+
+var intrabarRuleNames = map[IntrabarRule]string{
+	Pessimistic:  "pessimistic",
+	OpenDistance: "open-distance",
+	Optimistic:   "optimistic",
+}
+
+func (r IntrabarRule) String() string {
+	if name, ok := intrabarRuleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("IntrabarRule(%d)", int(r))
+}
+
+/* ParseIntrabarRule parses pessimistic, open-distance or optimistic */
+func ParseIntrabarRule(name string) (IntrabarRule, error) {
+	for rule, n := range intrabarRuleNames {
+		if n == name {
+			return rule, nil
+		}
+	}
+	return Pessimistic, fmt.Errorf("unknown intrabar rule %q: use pessimistic, open-distance or optimistic", name)
+}
+
+/*
+	exit
+
+*  returns the price a long position with a stop and a target (0 for
+*  none) left at in a candle, and whether it was the target. A candle
+*  opening beyond a level gapped through it and fills at the open.
+*/
+func (r IntrabarRule) exit(open, high, low, stop, target float64) (price float64, isTarget, ok bool) {
+	switch {
+	case stop > 0 && open <= stop:
+		return open, false, true
+	case target > 0 && open >= target:
+		return open, true, true
+	}
+
+	hitStop := stop > 0 && low <= stop
+	hitTarget := target > 0 && high >= target
+	if hitStop && hitTarget {
+		switch r {
+		case Optimistic:
+			hitStop = false
+		case OpenDistance:
+			hitStop = open-stop <= target-open
+		}
+	}
+	switch {
+	case hitStop:
+		return stop, false, true
+	case hitTarget:
+		return target, true, true
+	}
+	return 0, false, false
+}
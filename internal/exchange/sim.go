@@ -0,0 +1,629 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	SimExchange
+
+*  an in-memory exchange for backtests. It implements Exchange the
+*  way binanceExchange does, so the trading engine can't tell the two
+*  apart:
+*  - market orders fill at the current price plus the costs of its
+*    Costs, quantities are rounded to the same lot sizes and fees are
+*    taken from what was received
+*  - with LatencyBars set, orders fill at the open of the N-th candle
+*    after they were placed instead
+*  - every buy rests a stop-loss order at its stop (0.5% below the
+*    fill without one), a market sell of the symbol cancels them and
+*    PlaceStopLoss rests a new one
+*  - the stop and take-profit levels of a position are checked against
+*    each candle's high and low, see AddCandle
+*  - trades are kept in memory instead of the database, with the price,
+*    fee and PnL of the actual fill
+*
+*  Time only moves when a candle closes (AddCandle) or a price is
+*  observed (SetPrice), Now is the simulated clock of the backtest.
+*/
+type SimExchange struct {
+	Intrabar IntrabarRule // Which exit filled when a candle reached both, Pessimistic by default
+
+	costs    Costs
+	totals   CostTotals
+	now      time.Time
+	balances map[string]float64
+	prices   map[string]float64
+	volumes  map[string]float64
+	candles  map[string][]models.Kline
+	series   map[string]*simSeries
+	stops    map[string][]*simStop
+	pending  []*simOrder
+	unsaved  []*simOrder
+	trades   []models.Trade
+}
+
+/* simSeries resamples a symbol's base candles to one interval on demand */
+type simSeries struct {
+	resampler *timeframe.Resampler
+	fed       int
+}
+
+/*
+*  simOrder is a placed market order. Its Price is the price the order
+*  was placed at, fill the price it filled at (0 while on its way) and
+*  trade the index of the trade the engine saved for it (-1 until then).
+ */
+type simOrder struct {
+	order models.Order
+	due   int
+	fill  float64
+	fee   float64
+	trade int
+}
+
+/*
+*  simStop is a resting stop-loss order, linked to the buy it protects.
+*  The buy's trade may add a higher stop and a take-profit, see levels.
+ */
+type simStop struct {
+	order models.Order
+	buy   *simOrder
+}
+
+/*
+*  NewSimExchange starts with the given balances, e.g. {"USDT": 1000},
+*  and charges costs on every fill
+ */
+func NewSimExchange(balances map[string]float64, costs Costs) *SimExchange {
+	s := &SimExchange{
+		costs:    costs,
+		balances: make(map[string]float64),
+		prices:   make(map[string]float64),
+		volumes:  make(map[string]float64),
+		candles:  make(map[string][]models.Kline),
+		series:   make(map[string]*simSeries),
+		stops:    make(map[string][]*simStop),
+	}
+	for asset, amount := range balances {
+		s.balances[asset] = amount
+	}
+	return s
+}
+
+/* Now returns the simulated time, when the last candle closed */
+func (s *SimExchange) Now() time.Time {
+	return s.now
+}
+
+/* Costs returns what the fills cost so far */
+func (s *SimExchange) Costs() CostTotals {
+	return s.totals
+}
+
+/*
+	AddCandle
+
+*  closes a base candle of the symbol: orders due in it fill at its
+*  open, the clock moves to its close and the price becomes its close.
+*
+*  Positions whose stop or take-profit the candle's range reached are
+*  sold at that level, or at the open when the candle opened beyond it.
+*  When it reached both, the Intrabar rule picks the one hit first.
+*  Stops pay the taker fee, take-profits rest like limit orders: they
+*  fill at their price and pay the maker fee.
+*/
+func (s *SimExchange) AddCandle(symbol string, k models.Kline) {
+	s.candles[symbol] = append(s.candles[symbol], k)
+	s.volumes[symbol] = k.Volume
+	s.arrive(symbol, k.Open)
+	s.advance(symbol, time.UnixMilli(k.CloseTime+1), k.Open, k.High, k.Low, k.Close)
+}
+
+/*
+	SetPrice
+
+*  observes a price without a candle, e.g. from a depth recording.
+*  Orders due fill at it, and it doesn't come with a volume to slip on.
+*/
+func (s *SimExchange) SetPrice(symbol string, price float64, now time.Time) {
+	s.volumes[symbol] = 0
+	s.arrive(symbol, price)
+	s.advance(symbol, now, price, price, price, price)
+}
+
+/* arrive counts down the symbol's pending orders and fills the due ones at price */
+func (s *SimExchange) arrive(symbol string, price float64) {
+	var pending []*simOrder
+	for _, o := range s.pending {
+		if o.order.Symbol == symbol {
+			if o.due--; o.due <= 0 {
+				s.execute(o, price)
+				continue
+			}
+		}
+		pending = append(pending, o)
+	}
+	s.pending = pending
+}
+
+func (s *SimExchange) advance(symbol string, now time.Time, open, high, low, price float64) {
+	if now.After(s.now) {
+		s.now = now
+	}
+	s.prices[symbol] = price
+
+	var resting []*simStop
+	for _, stop := range s.stops[symbol] {
+		stopPrice, target := s.levels(stop)
+		if exit, isTarget, ok := s.Intrabar.exit(open, high, low, stopPrice, target); ok {
+			s.fillStop(stop, exit, isTarget)
+		} else {
+			resting = append(resting, stop)
+		}
+	}
+	s.stops[symbol] = resting
+}
+
+/*
+*  levels returns the stop and take-profit of a stop's position: the
+*  stop-loss order, raised to the stop of the buy's trade when that is
+*  higher, and the trade's take-profit
+ */
+func (s *SimExchange) levels(stop *simStop) (float64, float64) {
+	stopPrice, target := stop.order.StopLossPrice, 0.0
+	if stop.buy.trade >= 0 {
+		trade := s.trades[stop.buy.trade]
+		stopPrice = math.Max(stopPrice, trade.StopLoss)
+		target = trade.TakeProfit
+	}
+	return stopPrice, target
+}
+
+/*
+	execute
+
+*  fills an order at the reference price plus costs. A buy the cash
+*  can no longer pay for in full is reduced, a sell to what is held.
+*  An order left without quantity is dropped and its trade, if already
+*  saved, canceled.
+*/
+func (s *SimExchange) execute(o *simOrder, price float64) {
+	symbol, base := o.order.Symbol, baseAsset(o.order.Symbol)
+	quantity := o.order.Quantity
+	if o.order.Side == "SELL" {
+		quantity = math.Min(quantity, s.balances[base])
+	}
+	fill, costs := s.costs.Fill(o.order.Side, o.order.Type, price, quantity, s.volumes[symbol])
+	if o.order.Side != "SELL" && fill*quantity > s.balances["USDT"] {
+		quantity = roundToValidQuantity(s.balances["USDT"] / fill)
+		fill, costs = s.costs.Fill(o.order.Side, o.order.Type, price, quantity, s.volumes[symbol])
+	}
+	if quantity <= 0 {
+		s.drop(o)
+		return
+	}
+
+	o.order.Quantity, o.fill, o.fee = quantity, fill, costs.Fees
+	if o.order.Side == "SELL" {
+		costs.Latency = (o.order.Price - price) * quantity
+		s.balances[base] -= quantity
+		s.balances["USDT"] += quantity*fill - costs.Fees
+	} else {
+		costs.Latency = (price - o.order.Price) * quantity
+		s.balances["USDT"] -= quantity * fill
+		s.balances[base] += quantity * (1 - s.costs.FeeRate(o.order.Type))
+		if !o.order.NoStopLoss {
+			s.restStop(o)
+		}
+	}
+	s.totals = s.totals.Add(costs)
+
+	if o.trade >= 0 {
+		s.applyFill(o)
+	}
+}
+
+/* drop forgets an order that couldn't fill */
+func (s *SimExchange) drop(o *simOrder) {
+	if o.trade >= 0 {
+		s.trades[o.trade].Status = "CANCELED"
+		return
+	}
+	for i, unsaved := range s.unsaved {
+		if unsaved == o {
+			s.unsaved = append(s.unsaved[:i], s.unsaved[i+1:]...)
+			break
+		}
+	}
+}
+
+/* restStop places the stop-loss order of a filled buy */
+func (s *SimExchange) restStop(buy *simOrder) {
+	stopLossPrice := buy.order.StopLossPrice
+	if stopLossPrice <= 0 || stopLossPrice >= buy.fill {
+		stopLossPrice = buy.fill * 0.995
+	}
+	s.stops[buy.order.Symbol] = append(s.stops[buy.order.Symbol], &simStop{
+		buy: buy,
+		order: models.Order{
+			Symbol:        buy.order.Symbol,
+			Side:          "SELL",
+			Type:          "STOP_LOSS_LIMIT",
+			Quantity:      buy.order.Quantity * (1 - s.costs.FeeRate(buy.order.Type)),
+			Price:         stopLossPrice * 0.998,
+			StopLossPrice: stopLossPrice,
+			Timestamp:     s.now,
+		},
+	})
+}
+
+/*
+*  applyFill writes the fill of an order into the trade the engine
+*  saved for it, which has the price the order was placed at
+ */
+func (s *SimExchange) applyFill(o *simOrder) {
+	trade := &s.trades[o.trade]
+	trade.Price = o.fill
+	trade.Quantity = o.order.Quantity
+	trade.Value = o.fill * o.order.Quantity
+	trade.Fee = o.fee
+	if trade.Side == "SELL" {
+		trade.PnL, trade.PnLPercent = s.pnl(trade.PositionID, o.fill, o.order.Quantity)
+	}
+}
+
+/*
+*  pnl returns the PnL of selling quantity at price against the
+*  position's buys, at their average price when there are several
+ */
+func (s *SimExchange) pnl(positionID string, price, quantity float64) (float64, float64) {
+	var bought, cost float64
+	for _, buy := range s.trades {
+		if buy.PositionID == positionID && buy.Side == "BUY" && buy.Price > 0 && buy.Status != "CANCELED" {
+			bought += buy.Quantity
+			cost += buy.Price * buy.Quantity
+		}
+	}
+	if bought == 0 {
+		return 0, 0
+	}
+	entry := cost / bought
+	return (price - entry) * quantity, (price - entry) / entry * 100
+}
+
+/* fillStop sells a stop's quantity at the exit price and closes its position */
+func (s *SimExchange) fillStop(stop *simStop, exit float64, isTarget bool) {
+	symbol := stop.order.Symbol
+	quantity := math.Min(stop.order.Quantity, s.balances[baseAsset(symbol)])
+	if quantity <= 0 {
+		return
+	}
+	price, costs := s.costs.Fill("SELL", stop.order.Type, exit, quantity, s.volumes[symbol])
+	reason := fmt.Sprintf("stop-loss %.2f filled", exit)
+	if isTarget {
+		/* A resting limit fills at its price, without spread or slippage */
+		price, costs = exit, CostTotals{Fees: exit * quantity * s.costs.FeeRate("LIMIT")}
+		reason = fmt.Sprintf("take-profit %.2f filled", exit)
+	}
+	s.balances[baseAsset(symbol)] -= quantity
+	s.balances["USDT"] += quantity*price - costs.Fees
+	s.totals = s.totals.Add(costs)
+
+	positionID := ""
+	if stop.buy.trade >= 0 {
+		positionID = s.trades[stop.buy.trade].PositionID
+	}
+	sell := models.Trade{
+		ID:         uint(len(s.trades) + 1),
+		Symbol:     symbol,
+		Side:       "SELL",
+		Price:      price,
+		Quantity:   quantity,
+		Value:      price * quantity,
+		Fee:        costs.Fees,
+		Timestamp:  s.now,
+		PositionID: positionID,
+		Status:     "CLOSED",
+		Reason:     reason,
+	}
+	if positionID != "" {
+		sell.PnL, sell.PnLPercent = s.pnl(positionID, price, quantity)
+		s.UpdateTradeStatus(positionID, "CLOSED")
+	}
+	s.trades = append(s.trades, sell)
+}
+
+/* LastCandle returns the symbol's last closed base candle */
+func (s *SimExchange) LastCandle(symbol string) (models.Kline, bool) {
+	candles := s.candles[symbol]
+	if len(candles) == 0 {
+		return models.Kline{}, false
+	}
+	return candles[len(candles)-1], true
+}
+
+/* Equity values every balance at the current prices, in USDT */
+func (s *SimExchange) Equity() float64 {
+	equity := s.balances["USDT"]
+	for symbol, price := range s.prices {
+		equity += s.balances[baseAsset(symbol)] * price
+	}
+	return equity
+}
+
+/*
+	PlaceOrder
+
+*  fills a market order at the current price plus costs, like
+*  binanceExchange. With LatencyBars set, the order is checked against
+*  the balances now but fills later; order.Price stays the price it was
+*  placed at and order.Fee 0, the fill updates the saved trade.
+*/
+func (s *SimExchange) PlaceOrder(order *models.Order) error {
+	currentPrice, err := s.GetPrice(order.Symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get current price: %v", err)
+	}
+	order.Price = currentPrice
+
+	base := baseAsset(order.Symbol)
+	if order.Side == "SELL" {
+		if order.Type == "MARKET" && currentPrice < order.StopLossPrice {
+			return fmt.Errorf("market sell blocked: price %.2f < stop loss %.2f", currentPrice, order.StopLossPrice)
+		}
+		if s.balances[base] < order.Quantity {
+			return fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", base, s.balances[base], order.Quantity)
+		}
+	} else if usdtBalance := s.balances["USDT"]; usdtBalance < order.Price*order.Quantity {
+		return fmt.Errorf("insufficient USDT balance: have %.2f, need %.2f", usdtBalance, order.Price*order.Quantity)
+	}
+
+	quantity := roundToValidQuantity(order.Quantity)
+	if quantity <= 0 {
+		return fmt.Errorf("order quantity too small: %.8f", order.Quantity)
+	}
+	order.Quantity = quantity
+	if order.Side == "SELL" {
+		delete(s.stops, order.Symbol)
+	}
+
+	o := &simOrder{order: *order, due: s.costs.LatencyBars, trade: -1}
+	s.unsaved = append(s.unsaved, o)
+	if o.due > 0 {
+		s.pending = append(s.pending, o)
+		return nil
+	}
+	s.execute(o, currentPrice)
+	if o.fill == 0 {
+		return fmt.Errorf("insufficient USDT balance for %.8f %s after costs", quantity, order.Symbol)
+	}
+	order.Price, order.Quantity, order.Fee = o.fill, o.order.Quantity, o.fee
+	return nil
+}
+
+/*
+*  PlaceStopLoss rests a stop-loss order for order.Quantity at
+*  order.StopLossPrice, protecting the symbol's open position
+ */
+func (s *SimExchange) PlaceStopLoss(order *models.Order) error {
+	quantity := roundToValidQuantity(order.Quantity)
+	if quantity <= 0 {
+		return fmt.Errorf("stop loss quantity too small: %.8f", order.Quantity)
+	}
+	if order.StopLossPrice <= 0 {
+		return fmt.Errorf("invalid stop loss price: %.2f", order.StopLossPrice)
+	}
+	buy := &simOrder{trade: -1}
+	for i, trade := range s.trades {
+		if trade.Symbol == order.Symbol && trade.Side == "BUY" && trade.Status == "OPEN" {
+			buy.trade = i
+			break
+		}
+	}
+	s.stops[order.Symbol] = append(s.stops[order.Symbol], &simStop{
+		buy: buy,
+		order: models.Order{
+			Symbol:        order.Symbol,
+			Side:          "SELL",
+			Type:          "STOP_LOSS_LIMIT",
+			Quantity:      quantity,
+			Price:         order.StopLossPrice * 0.998,
+			StopLossPrice: order.StopLossPrice,
+			Timestamp:     s.now,
+		},
+	})
+	return nil
+}
+
+/* GetPrice returns the last observed price of the symbol */
+func (s *SimExchange) GetPrice(symbol string) (float64, error) {
+	price, ok := s.prices[symbol]
+	if !ok {
+		return 0, fmt.Errorf("no price found for symbol %s", symbol)
+	}
+	return price, nil
+}
+
+/*
+	GetHistoricalData
+
+*  returns the candles of an interval closed so far, resampled from
+*  the base candles added with AddCandle
+*/
+func (s *SimExchange) GetHistoricalData(symbol string, interval string, limit int) ([]models.Kline, error) {
+	key := symbol + "/" + interval
+	series, ok := s.series[key]
+	if !ok {
+		d, err := timeframe.ParseInterval(interval)
+		if err != nil {
+			return nil, err
+		}
+		series = &simSeries{resampler: timeframe.NewResampler(d, limit)}
+		s.series[key] = series
+	}
+	for _, k := range s.candles[symbol][series.fed:] {
+		series.resampler.Add(k)
+	}
+	series.fed = len(s.candles[symbol])
+
+	closed := series.resampler.Closed()
+	if limit > 0 && len(closed) > limit {
+		closed = closed[len(closed)-limit:]
+	}
+	return closed[:len(closed):len(closed)], nil
+}
+
+/* GetBalance returns the non-zero balances */
+func (s *SimExchange) GetBalance() (map[string]float64, error) {
+	balances := make(map[string]float64, len(s.balances))
+	for asset, amount := range s.balances {
+		if amount > 0 {
+			balances[asset] = amount
+		}
+	}
+	return balances, nil
+}
+
+/* GetTradingSummary aggregates the closed trades per symbol */
+func (s *SimExchange) GetTradingSummary() ([]models.TradingSummary, error) {
+	bySymbol := make(map[string]*models.TradingSummary)
+	var symbols []string
+	for _, trade := range s.trades {
+		summary, ok := bySymbol[trade.Symbol]
+		if !ok {
+			summary = &models.TradingSummary{Symbol: trade.Symbol, FirstTrade: trade.Timestamp}
+			bySymbol[trade.Symbol] = summary
+			symbols = append(symbols, trade.Symbol)
+		}
+		summary.TotalTrades++
+		summary.TotalVolume += trade.Value
+		summary.LastTrade = trade.Timestamp
+		if trade.Side != "SELL" {
+			continue
+		}
+		summary.TotalPnL += trade.PnL
+		summary.AvgPnLPercent += trade.PnLPercent
+		if trade.PnL > 0 {
+			summary.WinningTrades++
+		} else {
+			summary.LosingTrades++
+		}
+	}
+
+	summaries := make([]models.TradingSummary, 0, len(symbols))
+	for _, symbol := range symbols {
+		summary := bySymbol[symbol]
+		if sells := summary.WinningTrades + summary.LosingTrades; sells > 0 {
+			summary.AvgPnLPercent /= float64(sells)
+		}
+		summaries = append(summaries, *summary)
+	}
+	return summaries, nil
+}
+
+/* GetLastBuyTrade returns the latest buy of the symbol */
+func (s *SimExchange) GetLastBuyTrade(symbol string) (*models.Trade, error) {
+	for i := len(s.trades) - 1; i >= 0; i-- {
+		if s.trades[i].Symbol == symbol && s.trades[i].Side == "BUY" {
+			trade := s.trades[i]
+			return &trade, nil
+		}
+	}
+	return nil, fmt.Errorf("no previous buy trade found")
+}
+
+/* GetAllTrades returns every trade, newest first */
+func (s *SimExchange) GetAllTrades() ([]models.Trade, error) {
+	return s.GetRecentTrades(len(s.trades))
+}
+
+/* GetRecentTrades returns up to limit trades, newest first */
+func (s *SimExchange) GetRecentTrades(limit int) ([]models.Trade, error) {
+	trades := make([]models.Trade, 0, limit)
+	for i := len(s.trades) - 1; i >= 0 && len(trades) < limit; i-- {
+		trades = append(trades, s.trades[i])
+	}
+	return trades, nil
+}
+
+/*
+*  SaveTrade records a trade. The trade of an order takes over its
+*  fill, and the stop-loss order a buy placed closes its position.
+ */
+func (s *SimExchange) SaveTrade(trade *models.Trade) error {
+	if trade.Timestamp.IsZero() {
+		trade.Timestamp = s.now
+	}
+	trade.ID = uint(len(s.trades) + 1)
+	s.trades = append(s.trades, *trade)
+
+	for i, o := range s.unsaved {
+		if o.order.Symbol == trade.Symbol && o.order.Side == trade.Side {
+			s.unsaved = append(s.unsaved[:i], s.unsaved[i+1:]...)
+			o.trade = len(s.trades) - 1
+			if o.fill > 0 {
+				s.applyFill(o)
+			}
+			break
+		}
+	}
+	*trade = s.trades[len(s.trades)-1]
+	return nil
+}
+
+/* GetOpenPositions returns the trades still open */
+func (s *SimExchange) GetOpenPositions() ([]models.Trade, error) {
+	var open []models.Trade
+	for _, trade := range s.trades {
+		if trade.Status == "OPEN" {
+			open = append(open, trade)
+		}
+	}
+	return open, nil
+}
+
+/*
+*  GetOpenPosition returns the open buy of the symbol the bot acts on,
+*  the same one binanceExchange finds: the oldest still open
+ */
+func (s *SimExchange) GetOpenPosition(symbol string) (*models.Trade, error) {
+	for i := range s.trades {
+		if trade := s.trades[i]; trade.Symbol == symbol && trade.Side == "BUY" && trade.Status == "OPEN" {
+			return &trade, nil
+		}
+	}
+	return nil, nil
+}
+
+/* GetTrades returns the symbol's trades, newest first */
+func (s *SimExchange) GetTrades(symbol string) ([]*models.Trade, error) {
+	var trades []*models.Trade
+	for i := len(s.trades) - 1; i >= 0; i-- {
+		if s.trades[i].Symbol == symbol {
+			trade := s.trades[i]
+			trades = append(trades, &trade)
+		}
+	}
+	return trades, nil
+}
+
+/* UpdateTradeStatus sets the status of every trade of a position */
+func (s *SimExchange) UpdateTradeStatus(positionID string, status string) error {
+	for i := range s.trades {
+		if s.trades[i].PositionID == positionID {
+			s.trades[i].Status = status
+		}
+	}
+	return nil
+}
+
+/* Trades returns every trade in the order they happened, don't modify it */
+func (s *SimExchange) Trades() []models.Trade {
+	return s.trades[:len(s.trades):len(s.trades)]
+}
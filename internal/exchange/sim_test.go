@@ -0,0 +1,139 @@
+package exchange
+
+import (
+	"math"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestSimExchangeCosts(t *testing.T) {
+	sim := NewSimExchange(map[string]float64{"USDT": 1000}, Costs{
+		TakerBps:    10,
+		Spread:      HalfSpread(10),
+		Slippage:    VolumeSlippage(1),
+		LatencyBars: 1,
+	})
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 100, High: 100, Low: 100, Close: 100, Volume: 100, CloseTime: 59999})
+
+	order := &models.Order{Symbol: "BTCUSDT", Side: "BUY", Type: "MARKET", Quantity: 1, StopLossPrice: 90}
+	if err := sim.PlaceOrder(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trade := &models.Trade{Symbol: "BTCUSDT", Side: "BUY", Price: order.Price, Quantity: order.Quantity, PositionID: "p1", Status: "OPEN"}
+	if err := sim.SaveTrade(trade); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trade.Price != 100 {
+		t.Errorf("Expected the trade at the decision price until the order arrives, got %.4f", trade.Price)
+	}
+
+	/* The order arrives at the next open: 102 + 0.1% spread + 1% slippage for 1% of the volume */
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 102, High: 103, Low: 101, Close: 103, Volume: 100, CloseTime: 119999})
+	fill := sim.Trades()[0]
+	want := 102 * (1 + 0.001 + 0.01)
+	if math.Abs(fill.Price-want) > 1e-9 {
+		t.Errorf("Expected the fill at %.4f, got %.4f", want, fill.Price)
+	}
+
+	costs := sim.Costs()
+	if math.Abs(costs.Latency-2) > 1e-9 || math.Abs(costs.Spread-0.102) > 1e-9 || math.Abs(costs.Fees-want*0.001) > 1e-9 {
+		t.Errorf("Unexpected costs %+v", costs)
+	}
+	balances, _ := sim.GetBalance()
+	if math.Abs(balances["USDT"]-(1000-want)) > 1e-9 || math.Abs(balances["BTC"]-0.999) > 1e-9 {
+		t.Errorf("Unexpected balances %v", balances)
+	}
+
+	/* The stop sells below its stop price by the spread and the fee */
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 95, High: 95, Low: 85, Close: 88, Volume: 0, CloseTime: 179999})
+	trades := sim.Trades()
+	if len(trades) != 2 || trades[1].Side != "SELL" || math.Abs(trades[1].Price-90*0.999) > 1e-9 {
+		t.Fatalf("Expected the stop filled at %.3f, got %+v", 90*0.999, trades)
+	}
+	if trades[0].Status != "CLOSED" || trades[1].PnL >= 0 {
+		t.Errorf("Expected a closed losing position, got %+v", trades)
+	}
+}
+
+func TestPlaceOrderReportsTheFee(t *testing.T) {
+	sim := NewSimExchange(map[string]float64{"USDT": 1000}, Costs{TakerBps: 10})
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 100, High: 100, Low: 100, Close: 100, Volume: 100, CloseTime: 59999})
+
+	/* The taker fee of 0.1% on the fill, for the bot to save with the trade */
+	order := &models.Order{Symbol: "BTCUSDT", Side: "BUY", Type: "MARKET", Quantity: 2, StopLossPrice: 90}
+	if err := sim.PlaceOrder(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(order.Fee-0.2) > 1e-9 {
+		t.Errorf("Expected a fee of 0.2 USDT, got %.4f", order.Fee)
+	}
+}
+
+func TestIntrabarExits(t *testing.T) {
+	tests := []struct {
+		name                   string
+		rule                   IntrabarRule
+		open, high, low        float64
+		wantPrice              float64
+		wantTarget, wantFilled bool
+	}{
+		{"inside the range", Pessimistic, 100, 104, 96, 0, false, false},
+		{"wick to the stop", Pessimistic, 100, 101, 94, 95, false, true},
+		{"wick to the target", Pessimistic, 100, 106, 99, 105, true, true},
+		{"gap through the stop", Pessimistic, 93, 94, 92, 93, false, true},
+		{"gap through the target", Pessimistic, 107, 108, 106, 107, true, true},
+		{"both, pessimistic", Pessimistic, 104, 106, 94, 95, false, true},
+		{"both, open closer to the target", OpenDistance, 104, 106, 94, 105, true, true},
+		{"both, open closer to the stop", OpenDistance, 96, 106, 94, 95, false, true},
+		{"both, optimistic", Optimistic, 96, 106, 94, 105, true, true},
+	}
+	for _, tt := range tests {
+		price, isTarget, ok := tt.rule.exit(tt.open, tt.high, tt.low, 95, 105)
+		if ok != tt.wantFilled || price != tt.wantPrice || isTarget != tt.wantTarget {
+			t.Errorf("%s: got %.2f target=%v filled=%v", tt.name, price, isTarget, ok)
+		}
+	}
+
+	/* The take-profit of a saved buy fills at its price within the candle */
+	sim := NewSimExchange(map[string]float64{"USDT": 1000}, Costs{MakerBps: 5, TakerBps: 10})
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 100, High: 100, Low: 100, Close: 100, CloseTime: 59999})
+	order := &models.Order{Symbol: "BTCUSDT", Side: "BUY", Type: "MARKET", Quantity: 1, StopLossPrice: 95}
+	if err := sim.PlaceOrder(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sim.SaveTrade(&models.Trade{Symbol: "BTCUSDT", Side: "BUY", PositionID: "p1", Status: "OPEN", StopLoss: 95, TakeProfit: 105})
+	sim.AddCandle("BTCUSDT", models.Kline{Open: 100, High: 106, Low: 99, Close: 101, CloseTime: 119999})
+
+	trades := sim.Trades()
+	if len(trades) != 2 || trades[1].Price != 105 || trades[1].Reason != "take-profit 105.00 filled" || trades[0].Status != "CLOSED" {
+		t.Fatalf("Expected the take-profit filled at 105, got %+v", trades)
+	}
+	if fee := trades[1].Fee; math.Abs(fee-105*trades[1].Quantity*0.0005) > 1e-9 {
+		t.Errorf("Expected the maker fee on the take-profit, got %.6f", fee)
+	}
+}
+
+func TestParseIntrabarRule(t *testing.T) {
+	for _, rule := range []IntrabarRule{Pessimistic, OpenDistance, Optimistic} {
+		if parsed, err := ParseIntrabarRule(rule.String()); err != nil || parsed != rule {
+			t.Errorf("Expected %s to round-trip, got %v (%v)", rule, parsed, err)
+		}
+	}
+	if _, err := ParseIntrabarRule("random"); err == nil {
+		t.Errorf("Expected an error for an unknown rule")
+	}
+}
+
+func TestVolumeSlippageCap(t *testing.T) {
+	costs := Costs{Slippage: VolumeSlippage(1)}
+
+	/* 1% of the volume slips 1%, the whole bar's volume at most 10% */
+	if price, _ := costs.Fill("SELL", "MARKET", 100, 1, 100); math.Abs(price-99) > 1e-9 {
+		t.Errorf("Expected the sell at 99, got %.4f", price)
+	}
+	price, totals := costs.Fill("SELL", "MARKET", 100, 200, 100)
+	if math.Abs(price-90) > 1e-9 || math.Abs(totals.Slippage-2000) > 1e-9 {
+		t.Errorf("Expected the sell capped at 90 with 2000 of slippage, got %.4f and %.4f", price, totals.Slippage)
+	}
+}
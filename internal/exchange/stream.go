@@ -0,0 +1,193 @@
+package exchange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	DepthStream
+
+*  keeps the latest order book and recent aggressive trades of a set
+*  of symbols from the Binance public websocket streams:
+*  - <symbol>@depth<levels>@100ms: the top levels of the book
+*  - <symbol>@aggTrade: trades, with the side that crossed the spread
+*
+*  No API key is needed. Dropped connections are retried every few
+*  seconds until Close.
+*/
+type DepthStream struct {
+	mu      sync.RWMutex
+	symbols []string
+	levels  int
+	window  time.Duration
+	books   map[string]*models.OrderBook
+	trades  map[string][]flowTrade
+	stop    chan struct{}
+	log     *logrus.Logger
+}
+
+type flowTrade struct {
+	time     time.Time
+	quantity float64
+	buy      bool // Taker bought, lifting the ask
+}
+
+/* DepthLevels are the book depths Binance streams */
+var DepthLevels = []int{5, 10, 20}
+
+/* retryDelay is the wait before reconnecting a dropped stream */
+const retryDelay = 5 * time.Second
+
+/*
+	NewDepthStream
+
+*  starts streaming the top levels of the book (5, 10 or 20) and
+*  the trades of the last window for every symbol
+*/
+func NewDepthStream(symbols []string, levels int, window time.Duration) (*DepthStream, error) {
+	valid := false
+	for _, l := range DepthLevels {
+		valid = valid || l == levels
+	}
+	if !valid {
+		return nil, fmt.Errorf("depth levels must be 5, 10 or 20, got %d", levels)
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("no symbols to stream")
+	}
+
+	s := &DepthStream{
+		symbols: symbols,
+		levels:  levels,
+		window:  window,
+		books:   make(map[string]*models.OrderBook),
+		trades:  make(map[string][]flowTrade),
+		stop:    make(chan struct{}),
+		log:     logrus.New(),
+	}
+
+	depth := make(map[string]string, len(symbols))
+	for _, symbol := range symbols {
+		depth[symbol] = fmt.Sprintf("%d@100ms", levels)
+	}
+	go s.serve("depth", func(errHandler binance.ErrHandler) (chan struct{}, chan struct{}, error) {
+		return binance.WsCombinedPartialDepthServe(depth, s.onDepth, errHandler)
+	})
+	go s.serve("trades", func(errHandler binance.ErrHandler) (chan struct{}, chan struct{}, error) {
+		return binance.WsCombinedAggTradeServe(symbols, s.onTrade, errHandler)
+	})
+	return s, nil
+}
+
+/* serve keeps one websocket connected until Close */
+func (s *DepthStream) serve(name string, connect func(binance.ErrHandler) (chan struct{}, chan struct{}, error)) {
+	errHandler := func(err error) {
+		s.log.Errorf("%s stream error: %v", name, err)
+	}
+	for {
+		done, stop, err := connect(errHandler)
+		if err != nil {
+			s.log.Errorf("Failed to connect %s stream: %v", name, err)
+		} else {
+			select {
+			case <-s.stop:
+				close(stop)
+				return
+			case <-done:
+				s.log.Errorf("%s stream disconnected, reconnecting", name)
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (s *DepthStream) onDepth(event *binance.WsPartialDepthEvent) {
+	book := &models.OrderBook{Symbol: event.Symbol, Time: time.Now()}
+	for _, bid := range event.Bids {
+		if price, quantity, err := bid.Parse(); err == nil {
+			book.Bids = append(book.Bids, models.BookLevel{Price: price, Quantity: quantity})
+		}
+	}
+	for _, ask := range event.Asks {
+		if price, quantity, err := ask.Parse(); err == nil {
+			book.Asks = append(book.Asks, models.BookLevel{Price: price, Quantity: quantity})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.books[event.Symbol] = book
+}
+
+func (s *DepthStream) onTrade(event *binance.WsAggTradeEvent) {
+	quantity, err := strconv.ParseFloat(event.Quantity, 64)
+	if err != nil {
+		return
+	}
+	trade := flowTrade{
+		time:     time.UnixMilli(event.TradeTime),
+		quantity: quantity,
+		buy:      !event.IsBuyerMaker, // A maker buyer means the seller crossed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	symbol := strings.ToUpper(event.Symbol)
+	s.trades[symbol] = prune(append(s.trades[symbol], trade), time.Now().Add(-s.window))
+}
+
+/* prune drops trades older than cutoff, trades arrive in time order */
+func prune(trades []flowTrade, cutoff time.Time) []flowTrade {
+	i := 0
+	for i < len(trades) && trades[i].time.Before(cutoff) {
+		i++
+	}
+	return trades[i:]
+}
+
+/* Book returns the latest book of a symbol, nil before the first update */
+func (s *DepthStream) Book(symbol string) *models.OrderBook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	book, ok := s.books[symbol]
+	if !ok {
+		return nil
+	}
+	copied := *book
+	return &copied
+}
+
+/* Flow sums the aggressive trades of a symbol over the window up to now */
+func (s *DepthStream) Flow(symbol string, now time.Time) *models.TradeFlow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trades[symbol] = prune(s.trades[symbol], now.Add(-s.window))
+
+	flow := &models.TradeFlow{Window: s.window}
+	for _, trade := range s.trades[symbol] {
+		if trade.buy {
+			flow.BuyVolume += trade.quantity
+		} else {
+			flow.SellVolume += trade.quantity
+		}
+		flow.Trades++
+	}
+	return flow
+}
+
+/* Close disconnects the streams */
+func (s *DepthStream) Close() {
+	close(s.stop)
+}
@@ -0,0 +1,141 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	Cache
+
+*  keeps candles on disk as <Dir>/<SYMBOL>_<interval>.csv in the
+*  WriteCSV layout. With a Downloader it fetches the range it does not
+*  hold yet and saves it; without one it works offline from the files
+*  it has.
+*/
+type Cache struct {
+	Dir      string
+	Download *Downloader // nil to stay offline
+}
+
+/* Path returns the file that caches a symbol's candles of an interval */
+func (c Cache) Path(symbol, interval string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%s_%s.csv", strings.ToUpper(symbol), interval))
+}
+
+/*
+	Candles
+
+*  returns a symbol's candles that open from start and close before
+*  end, downloading and caching what is missing before the first or
+*  after the last cached candle
+*/
+func (c Cache) Candles(symbol, interval string, start, end time.Time) ([]models.Kline, error) {
+	size, err := timeframe.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	path := c.Path(symbol, interval)
+	cached, err := LoadCSV(path, size)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if c.Download != nil {
+		var fetched []models.Kline
+		if len(cached) == 0 {
+			fetched, err = c.Download.Download(symbol, interval, start, end)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if first := cached[0].OpenTime; start.UnixMilli() < first {
+				head, err := c.Download.Download(symbol, interval, start, time.UnixMilli(first))
+				if err != nil {
+					return nil, err
+				}
+				fetched = append(fetched, head...)
+			}
+			if last := cached[len(cached)-1].CloseTime; end.UnixMilli() > last+1 {
+				tail, err := c.Download.Download(symbol, interval, time.UnixMilli(last+1), end)
+				if err != nil {
+					return nil, err
+				}
+				fetched = append(fetched, tail...)
+			}
+		}
+		if len(fetched) > 0 {
+			cached = merge(cached, fetched)
+			if err := c.save(path, cached); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	klines := Between(cached, start, end)
+	if len(klines) == 0 {
+		if c.Download == nil {
+			return nil, fmt.Errorf("no cached %s %s candles in %s %s", symbol, interval, path, describeRange(start, end))
+		}
+		return nil, fmt.Errorf("no %s %s candles %s", symbol, interval, describeRange(start, end))
+	}
+	return klines, nil
+}
+
+/* describeRange formats a time range for errors, zero times are open */
+func describeRange(start, end time.Time) string {
+	switch {
+	case start.IsZero() && end.IsZero():
+		return "at all"
+	case start.IsZero():
+		return "before " + end.UTC().Format(time.RFC3339)
+	case end.IsZero():
+		return "from " + start.UTC().Format(time.RFC3339)
+	default:
+		return "from " + start.UTC().Format(time.RFC3339) + " to " + end.UTC().Format(time.RFC3339)
+	}
+}
+
+/* merge combines two candle sets by open time, the second winning on duplicates */
+func merge(a, b []models.Kline) []models.Kline {
+	byTime := make(map[int64]models.Kline, len(a)+len(b))
+	for _, k := range a {
+		byTime[k.OpenTime] = k
+	}
+	for _, k := range b {
+		byTime[k.OpenTime] = k
+	}
+	merged := make([]models.Kline, 0, len(byTime))
+	for _, k := range byTime {
+		merged = append(merged, k)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].OpenTime < merged[j].OpenTime })
+	return merged
+}
+
+/* save writes candles through a temporary file so a failed write keeps the old cache */
+func (c Cache) save(path string, klines []models.Kline) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := WriteCSV(tmp, klines); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
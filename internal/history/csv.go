@@ -0,0 +1,240 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* header is the layout WriteCSV writes, and the cache keeps */
+var header = []string{"open_time", "open", "high", "low", "close", "volume", "close_time"}
+
+/* Column names ReadCSV recognizes in a header, lower case */
+var columnNames = map[string]string{
+	"open_time": "time", "opentime": "time", "time": "time", "timestamp": "time", "date": "time", "datetime": "time",
+	"open": "open", "high": "high", "low": "low", "close": "close", "price": "price",
+	"volume": "volume", "close_time": "close_time", "closetime": "close_time",
+}
+
+/* Time layouts of text timestamps, read as UTC */
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+/*
+	ReadCSV
+
+*  reads candles of one symbol from CSV, oldest first whatever the
+*  file's order. Understood layouts:
+*  - Binance kline dumps (data.binance.vision), no header: open time,
+*    open, high, low, close, volume, close time, ...
+*  - a header naming the columns: open_time (or time, timestamp,
+*    date), open, high, low, close, volume and optionally close_time
+*  - time, price, volume: every price becomes a flat candle
+*
+*  Times are unix seconds, milliseconds or microseconds, or text such
+*  as 2024-01-31 15:04:05 in UTC. Without a close time, candles close
+*  one interval after they open.
+*/
+func ReadCSV(r io.Reader, interval time.Duration) ([]models.Kline, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns, err := csvColumns(records[0])
+	if err != nil {
+		return nil, err
+	}
+	line := 1
+	if isHeader(records[0]) {
+		records, line = records[1:], 2
+	}
+
+	klines := make([]models.Kline, 0, len(records))
+	for i, record := range records {
+		k, err := parseCandle(record, columns, interval)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line+i, err)
+		}
+		klines = append(klines, k)
+	}
+	sort.SliceStable(klines, func(i, j int) bool { return klines[i].OpenTime < klines[j].OpenTime })
+	return klines, nil
+}
+
+/* isHeader tells whether a record names columns */
+func isHeader(record []string) bool {
+	for _, name := range record {
+		if _, ok := columnNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+/* csvColumns maps column kinds to their index, from a header or the first record's width */
+func csvColumns(first []string) (map[string]int, error) {
+	columns := make(map[string]int)
+	if isHeader(first) {
+		for i, name := range first {
+			if kind, ok := columnNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+				if _, seen := columns[kind]; !seen {
+					columns[kind] = i
+				}
+			}
+		}
+	} else if len(first) >= 6 {
+		for i, kind := range []string{"time", "open", "high", "low", "close", "volume", "close_time"} {
+			if i < len(first) {
+				columns[kind] = i
+			}
+		}
+	} else if len(first) >= 2 {
+		columns["time"], columns["price"] = 0, 1
+		if len(first) >= 3 {
+			columns["volume"] = 2
+		}
+	}
+
+	if _, ok := columns["time"]; !ok {
+		return nil, fmt.Errorf("no time column in CSV")
+	}
+	_, hasPrice := columns["price"]
+	for _, kind := range []string{"open", "high", "low", "close"} {
+		if _, ok := columns[kind]; !ok && !hasPrice {
+			return nil, fmt.Errorf("no %s column in CSV, need open, high, low and close or a price", kind)
+		}
+	}
+	return columns, nil
+}
+
+func parseCandle(record []string, columns map[string]int, interval time.Duration) (models.Kline, error) {
+	field := func(kind string) (string, bool) {
+		i, ok := columns[kind]
+		if !ok || i >= len(record) {
+			return "", false
+		}
+		return strings.TrimSpace(record[i]), true
+	}
+	number := func(kind string) (float64, error) {
+		text, ok := field(kind)
+		if !ok {
+			return 0, nil
+		}
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", kind, text)
+		}
+		return v, nil
+	}
+
+	var k models.Kline
+	text, _ := field("time")
+	openTime, err := parseTime(text)
+	if err != nil {
+		return k, err
+	}
+	k.OpenTime = openTime
+	k.CloseTime = openTime + interval.Milliseconds() - 1
+	if text, ok := field("close_time"); ok && text != "" {
+		if k.CloseTime, err = parseTime(text); err != nil {
+			return k, err
+		}
+	}
+
+	if _, ok := columns["price"]; ok {
+		price, err := number("price")
+		if err != nil {
+			return k, err
+		}
+		k.Open, k.High, k.Low, k.Close = price, price, price, price
+	}
+	for kind, v := range map[string]*float64{"open": &k.Open, "high": &k.High, "low": &k.Low, "close": &k.Close, "volume": &k.Volume} {
+		if _, ok := columns[kind]; !ok {
+			continue
+		}
+		if *v, err = number(kind); err != nil {
+			return k, err
+		}
+	}
+	return k, nil
+}
+
+/* parseTime returns a timestamp in unix milliseconds */
+func parseTime(text string) (int64, error) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		switch {
+		case n > 1e14: // Microseconds
+			return n / 1000, nil
+		case n < 1e11: // Seconds
+			return n * 1000, nil
+		default:
+			return n, nil
+		}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", text)
+}
+
+/* LoadCSV reads the candles of a CSV file, see ReadCSV */
+func LoadCSV(path string, interval time.Duration) ([]models.Kline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	klines, err := ReadCSV(f, interval)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return klines, nil
+}
+
+/* WriteCSV writes candles with a header, times in unix milliseconds */
+func WriteCSV(w io.Writer, klines []models.Kline) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, k := range klines {
+		record := []string{strconv.FormatInt(k.OpenTime, 10), format(k.Open), format(k.High), format(k.Low),
+			format(k.Close), format(k.Volume), strconv.FormatInt(k.CloseTime, 10)}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+/* Between returns the candles that opened from start and closed by end, a zero time leaves that side open */
+func Between(klines []models.Kline, start, end time.Time) []models.Kline {
+	var in []models.Kline
+	for _, k := range klines {
+		if !start.IsZero() && k.OpenTime < start.UnixMilli() {
+			continue
+		}
+		if !end.IsZero() && k.CloseTime >= end.UnixMilli() {
+			continue
+		}
+		in = append(in, k)
+	}
+	return in
+}
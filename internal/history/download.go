@@ -0,0 +1,131 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/* pageSize is the most candles Binance returns per request */
+const pageSize = 1000
+
+/*
+	Downloader
+
+*  fetches candles from Binance's public market data, which needs no
+*  API key
+*/
+type Downloader struct {
+	BaseURL string       // Default https://api.binance.com
+	Client  *http.Client // Default http.DefaultClient
+}
+
+/*
+	Download
+
+*  returns the closed candles of a symbol that open from start and
+*  close before end, oldest first, paging through as many requests as
+*  it takes
+*/
+func (d Downloader) Download(symbol, interval string, start, end time.Time) ([]models.Kline, error) {
+	size, err := timeframe.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+
+	var klines []models.Kline
+	for from := start.UnixMilli(); from < end.UnixMilli(); {
+		page, err := d.page(symbol, interval, from, end.UnixMilli()-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range page {
+			if k.CloseTime < end.UnixMilli() {
+				klines = append(klines, k)
+			}
+		}
+		if len(page) < pageSize {
+			break
+		}
+		from = page[len(page)-1].OpenTime + size.Milliseconds()
+	}
+	return klines, nil
+}
+
+/* page requests one page of candles between two times in ms */
+func (d Downloader) page(symbol, interval string, from, to int64) ([]models.Kline, error) {
+	base, client := d.BaseURL, d.Client
+	if base == "" {
+		base = "https://api.binance.com"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	query := url.Values{
+		"symbol":    {symbol},
+		"interval":  {interval},
+		"startTime": {strconv.FormatInt(from, 10)},
+		"endTime":   {strconv.FormatInt(to, 10)},
+		"limit":     {strconv.Itoa(pageSize)},
+	}
+
+	resp, err := client.Get(base + "/api/v3/klines?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s %s candles: %v", symbol, interval, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to download %s %s candles: %s %s", symbol, interval, resp.Status, body)
+	}
+
+	var raw [][]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode %s %s candles: %v", symbol, interval, err)
+	}
+	klines := make([]models.Kline, 0, len(raw))
+	for _, r := range raw {
+		k, err := parseRawKline(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s %s candles: %v", symbol, interval, err)
+		}
+		klines = append(klines, k)
+	}
+	return klines, nil
+}
+
+/* parseRawKline reads a kline array: open time, open, high, low, close, volume, close time, ... */
+func parseRawKline(r []interface{}) (models.Kline, error) {
+	var k models.Kline
+	if len(r) < 7 {
+		return k, fmt.Errorf("kline has %d fields, expected at least 7", len(r))
+	}
+	openTime, ok1 := r[0].(float64)
+	closeTime, ok2 := r[6].(float64)
+	if !ok1 || !ok2 {
+		return k, fmt.Errorf("kline times are not numbers")
+	}
+	k.OpenTime, k.CloseTime = int64(openTime), int64(closeTime)
+	for i, v := range []*float64{&k.Open, &k.High, &k.Low, &k.Close, &k.Volume} {
+		text, ok := r[i+1].(string)
+		if !ok {
+			return k, fmt.Errorf("kline field %d is not a string", i+1)
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return k, err
+		}
+		*v = f
+	}
+	return k, nil
+}
@@ -0,0 +1,85 @@
+package history
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	layouts := map[string]string{
+		"binance": "1704067260000,101,102,100,101.5,7,1704067319999,0,0,0,0,0\n" +
+			"1704067200000,100,101,99,100.5,5,1704067259999,0,0,0,0,0\n",
+		"header": "timestamp,open,high,low,close,volume\n" +
+			"2024-01-01 00:00:00,100,101,99,100.5,5\n2024-01-01 00:01:00,101,102,100,101.5,7\n",
+		"prices": "2024-01-01 00:00:00,100.5,5\n2024-01-01 00:01:00,101.5,7\n",
+	}
+	for name, text := range layouts {
+		klines, err := ReadCSV(strings.NewReader(text), time.Minute)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(klines) != 2 {
+			t.Fatalf("%s: expected 2 candles, got %d", name, len(klines))
+		}
+		first, second := klines[0], klines[1]
+		if first.OpenTime != 1704067200000 || first.CloseTime != 1704067259999 || first.Close != 100.5 || first.Volume != 5 {
+			t.Errorf("%s: unexpected first candle %+v", name, first)
+		}
+		if second.OpenTime != 1704067260000 || second.Close != 101.5 {
+			t.Errorf("%s: unexpected second candle %+v", name, second)
+		}
+	}
+
+	if _, err := ReadCSV(strings.NewReader("time,open,high,low,close\nyesterday,1,1,1,1\n"), time.Minute); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func TestCacheDownloadsOnlyMissingCandles(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		from, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		to, _ := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		var rows []string
+		for open := from; open+59999 <= to; open += 60000 {
+			rows = append(rows, fmt.Sprintf(`[%d,"100","101","99","100","1",%d,"0",0,"0","0","0"]`, open, open+59999))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(rows, ","))
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := Cache{Dir: t.TempDir(), Download: &Downloader{BaseURL: server.URL}}
+	klines, err := cache.Candles("BTCUSDT", "1m", start, start.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(klines) != 10 || len(requests) != 1 {
+		t.Fatalf("Expected 10 candles from 1 request, got %d from %d", len(klines), len(requests))
+	}
+
+	/* Extending the range fetches only the new tail */
+	klines, err = cache.Candles("BTCUSDT", "1m", start, start.Add(15*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(klines) != 15 || len(requests) != 2 || !strings.Contains(requests[1], strconv.FormatInt(start.Add(10*time.Minute).UnixMilli(), 10)) {
+		t.Fatalf("Expected 15 candles and a second request from the 10th minute, got %d and %v", len(klines), requests)
+	}
+
+	/* Offline, the cache answers alone */
+	offline := Cache{Dir: cache.Dir}
+	klines, err = offline.Candles("BTCUSDT", "1m", start.Add(5*time.Minute), start.Add(15*time.Minute))
+	if err != nil || len(klines) != 10 {
+		t.Fatalf("Expected 10 cached candles offline, got %d (%v)", len(klines), err)
+	}
+	if _, err := offline.Candles("ETHUSDT", "1m", start, start.Add(time.Minute)); err == nil {
+		t.Error("Expected an error for candles that were never cached")
+	}
+}
@@ -0,0 +1,323 @@
+package indicator
+
+import "math"
+
+/*
+	Indicator Library
+
+*  Streaming technical indicators. Each indicator is fed one bar
+*  at a time through Update and reports Ready once it has seen
+*  enough bars for its value to be meaningful.
+*/
+
+/*
+*  EMA means Exponential Moving Average
+*  It is seeded with the simple average of the first 'period' values
+ */
+type EMA struct {
+	period int
+	alpha  float64
+	value  float64
+	count  int
+	sum    float64
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{
+		period: period,
+		alpha:  2 / float64(period+1),
+	}
+}
+
+func (e *EMA) Update(v float64) float64 {
+	e.count++
+	if e.count <= e.period {
+		e.sum += v
+		e.value = e.sum / float64(e.count)
+		return e.value
+	}
+	e.value += e.alpha * (v - e.value)
+	return e.value
+}
+
+func (e *EMA) Value() float64 { return e.value }
+func (e *EMA) Ready() bool    { return e.count >= e.period }
+
+/*
+*  SMA means Simple Moving Average over the last 'period' values
+ */
+type SMA struct {
+	period int
+	values []float64
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{
+		period: period,
+		values: make([]float64, 0, period),
+	}
+}
+
+func (s *SMA) Update(v float64) float64 {
+	s.values = append(s.values, v)
+	s.sum += v
+	if len(s.values) > s.period {
+		s.sum -= s.values[0]
+		s.values = s.values[1:]
+	}
+	return s.Value()
+}
+
+func (s *SMA) Value() float64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	return s.sum / float64(len(s.values))
+}
+
+func (s *SMA) Ready() bool { return len(s.values) >= s.period }
+
+/*
+*  wilder is Wilder's smoothing (an EMA with alpha = 1/period),
+*  used by ATR, ADX and the classic RSI
+ */
+type wilder struct {
+	period int
+	value  float64
+	count  int
+	sum    float64
+}
+
+func (w *wilder) update(v float64) float64 {
+	w.count++
+	if w.count <= w.period {
+		w.sum += v
+		w.value = w.sum / float64(w.count)
+		return w.value
+	}
+	w.value = (w.value*float64(w.period-1) + v) / float64(w.period)
+	return w.value
+}
+
+func (w *wilder) ready() bool { return w.count >= w.period }
+
+/*
+*  ATR means Average True Range
+*  It measures volatility as the smoothed range of each bar,
+*  including gaps from the previous close
+ */
+type ATR struct {
+	smooth    wilder
+	prevClose float64
+	hasPrev   bool
+}
+
+func NewATR(period int) *ATR {
+	return &ATR{smooth: wilder{period: period}}
+}
+
+func (a *ATR) Update(high, low, close float64) float64 {
+	tr := high - low
+	if a.hasPrev {
+		tr = math.Max(tr, math.Max(math.Abs(high-a.prevClose), math.Abs(low-a.prevClose)))
+	}
+	a.prevClose = close
+	a.hasPrev = true
+	return a.smooth.update(tr)
+}
+
+func (a *ATR) Value() float64 { return a.smooth.value }
+func (a *ATR) Ready() bool    { return a.smooth.ready() }
+
+/*
+*  ADX means Average Directional Index
+*  It measures trend strength (not direction) on a 0-100 scale,
+*  readings above ~25 usually mean a trending market
+ */
+type ADX struct {
+	period   int
+	tr       wilder
+	plusDM   wilder
+	minusDM  wilder
+	dx       wilder
+	prevHigh float64
+	prevLow  float64
+	prevCls  float64
+	hasPrev  bool
+	plusDI   float64
+	minusDI  float64
+}
+
+func NewADX(period int) *ADX {
+	return &ADX{
+		period:  period,
+		tr:      wilder{period: period},
+		plusDM:  wilder{period: period},
+		minusDM: wilder{period: period},
+		dx:      wilder{period: period},
+	}
+}
+
+func (a *ADX) Update(high, low, close float64) float64 {
+	if !a.hasPrev {
+		a.prevHigh, a.prevLow, a.prevCls = high, low, close
+		a.hasPrev = true
+		return 0
+	}
+
+	upMove := high - a.prevHigh
+	downMove := a.prevLow - low
+	plusDM, minusDM := 0.0, 0.0
+	if upMove > downMove && upMove > 0 {
+		plusDM = upMove
+	}
+	if downMove > upMove && downMove > 0 {
+		minusDM = downMove
+	}
+	tr := math.Max(high-low, math.Max(math.Abs(high-a.prevCls), math.Abs(low-a.prevCls)))
+	a.prevHigh, a.prevLow, a.prevCls = high, low, close
+
+	atr := a.tr.update(tr)
+	smoothPlus := a.plusDM.update(plusDM)
+	smoothMinus := a.minusDM.update(minusDM)
+	if !a.tr.ready() || atr == 0 {
+		return 0
+	}
+
+	a.plusDI = 100 * smoothPlus / atr
+	a.minusDI = 100 * smoothMinus / atr
+	sum := a.plusDI + a.minusDI
+	dx := 0.0
+	if sum > 0 {
+		dx = 100 * math.Abs(a.plusDI-a.minusDI) / sum
+	}
+	return a.dx.update(dx)
+}
+
+func (a *ADX) Value() float64 { return a.dx.value }
+func (a *ADX) Ready() bool    { return a.dx.ready() }
+
+/* PlusDI and MinusDI give the trend direction behind the ADX reading */
+func (a *ADX) PlusDI() float64  { return a.plusDI }
+func (a *ADX) MinusDI() float64 { return a.minusDI }
+
+/*
+*  Donchian channel: highest high and lowest low of the last 'period' bars.
+*  Read Upper/Lower before calling Update to compare the current bar
+*  against the channel of the bars before it.
+ */
+type Donchian struct {
+	period int
+	highs  []float64
+	lows   []float64
+}
+
+func NewDonchian(period int) *Donchian {
+	return &Donchian{
+		period: period,
+		highs:  make([]float64, 0, period),
+		lows:   make([]float64, 0, period),
+	}
+}
+
+func (d *Donchian) Update(high, low float64) {
+	d.highs = append(d.highs, high)
+	d.lows = append(d.lows, low)
+	if len(d.highs) > d.period {
+		d.highs = d.highs[1:]
+		d.lows = d.lows[1:]
+	}
+}
+
+func (d *Donchian) Upper() float64 {
+	upper := math.Inf(-1)
+	for _, h := range d.highs {
+		upper = math.Max(upper, h)
+	}
+	return upper
+}
+
+func (d *Donchian) Lower() float64 {
+	lower := math.Inf(1)
+	for _, l := range d.lows {
+		lower = math.Min(lower, l)
+	}
+	return lower
+}
+
+func (d *Donchian) Ready() bool { return len(d.highs) >= d.period }
+
+/*
+*  RSI means Relative Strength Index
+*  The classic Wilder version on a 0-100 scale. (The mean reversion
+*  strategy keeps its own faster, simple average variant.)
+ */
+type RSI struct {
+	gain      wilder
+	loss      wilder
+	prevClose float64
+	hasPrev   bool
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{gain: wilder{period: period}, loss: wilder{period: period}}
+}
+
+func (r *RSI) Update(close float64) float64 {
+	if !r.hasPrev {
+		r.prevClose, r.hasPrev = close, true
+		return r.Value()
+	}
+	change := close - r.prevClose
+	r.prevClose = close
+	r.gain.update(math.Max(change, 0))
+	r.loss.update(math.Max(-change, 0))
+	return r.Value()
+}
+
+func (r *RSI) Value() float64 {
+	if r.loss.value == 0 {
+		if r.gain.value == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.gain.value/r.loss.value)
+}
+
+func (r *RSI) Ready() bool { return r.gain.ready() }
+
+/*
+*  Bollinger Bands: the SMA of the last 'period' closes plus and
+*  minus k population standard deviations
+ */
+type Bollinger struct {
+	sma *SMA
+	k   float64
+}
+
+func NewBollinger(period int, k float64) *Bollinger {
+	return &Bollinger{sma: NewSMA(period), k: k}
+}
+
+func (b *Bollinger) Update(close float64) {
+	b.sma.Update(close)
+}
+
+func (b *Bollinger) Middle() float64 { return b.sma.Value() }
+func (b *Bollinger) Upper() float64  { return b.Middle() + b.k*b.stddev() }
+func (b *Bollinger) Lower() float64  { return b.Middle() - b.k*b.stddev() }
+func (b *Bollinger) Ready() bool     { return b.sma.Ready() }
+
+func (b *Bollinger) stddev() float64 {
+	mean := b.Middle()
+	sum := 0.0
+	for _, v := range b.sma.values {
+		sum += (v - mean) * (v - mean)
+	}
+	if len(b.sma.values) == 0 {
+		return 0
+	}
+	return math.Sqrt(sum / float64(len(b.sma.values)))
+}
@@ -0,0 +1,51 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEMA(t *testing.T) {
+	ema := NewEMA(3)
+	for _, v := range []float64{1, 2, 3} {
+		ema.Update(v)
+	}
+	if !ema.Ready() || ema.Value() != 2 {
+		t.Fatalf("Expected seeded EMA of 2, got %v (ready %v)", ema.Value(), ema.Ready())
+	}
+
+	// alpha = 0.5: 2 + 0.5 * (6 - 2) = 4
+	if got := ema.Update(6); got != 4 {
+		t.Errorf("Expected EMA of 4, got %v", got)
+	}
+}
+
+func TestATRConstantRange(t *testing.T) {
+	atr := NewATR(5)
+	for i := 0; i < 10; i++ {
+		atr.Update(102, 98, 100)
+	}
+	if !atr.Ready() || math.Abs(atr.Value()-4) > 1e-9 {
+		t.Errorf("Expected ATR of 4, got %v", atr.Value())
+	}
+}
+
+func TestADXTrend(t *testing.T) {
+	trending := NewADX(14)
+	flat := NewADX(14)
+	for i := 0; i < 60; i++ {
+		p := 100 + float64(i)
+		trending.Update(p+1, p-1, p)
+		q := 100 + float64(i%2)
+		flat.Update(q+1, q-1, q)
+	}
+	if !trending.Ready() || trending.Value() < 50 {
+		t.Errorf("Expected strong ADX for a steady uptrend, got %v", trending.Value())
+	}
+	if flat.Value() > 25 {
+		t.Errorf("Expected weak ADX for a flat market, got %v", flat.Value())
+	}
+	if trending.PlusDI() <= trending.MinusDI() {
+		t.Errorf("Expected +DI above -DI in an uptrend")
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -19,6 +20,15 @@ func NewLogger() *Logger {
 	}
 }
 
+/* NewLoggerTo writes every level to out, e.g. io.Discard for backtests */
+func NewLoggerTo(out io.Writer) *Logger {
+	return &Logger{
+		info:  log.New(out, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
+		error: log.New(out, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+		debug: log.New(out, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile),
+	}
+}
+
 func (l *Logger) Info(format string, v ...interface{}) {
 	l.info.Printf(format, v...)
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// GridLevel is one price level of a grid strategy
+type GridLevel struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Symbol    string    `gorm:"index;type:varchar(20);not null"`
+	Level     int       `gorm:"not null"`                     // 0 is the lowest level
+	Price     float64   `gorm:"type:decimal(20,8);not null"`  // Buy price of this level
+	Filled    bool      `gorm:"default:false"`                // Bought here, waiting to sell one level up
+	Quantity  float64   `gorm:"type:decimal(20,8);default:0"` // Quantity bought when filled
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for the GridLevel model
+func (GridLevel) TableName() string {
+	return "grid_levels"
+}
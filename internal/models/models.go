@@ -2,18 +2,85 @@ package models
 
 import "time"
 
+/*
+*  MarketData is one observation handed to a strategy.
+*  Price is the last price (the close when replaying candles).
+*  Open/High/Low/Volume are only set when the source is a candle,
+*  live price polls leave them zero.
+*  Frames holds closed candles of the higher timeframes the strategy
+*  subscribed to, keyed by interval ("1h") and oldest first.
+*  Book and Flow are set for strategies that watch the order book,
+*  from the live depth stream or a recording, nil otherwise.
+*  Position is the symbol's open position from the trades, nil when
+*  there is none.
+ */
 type MarketData struct {
-	Symbol string
-	Price  float64
-	Time   time.Time
+	Symbol   string
+	Price    float64
+	Time     time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Volume   float64
+	Frames   map[string][]Kline
+	Book     *OrderBook
+	Flow     *TradeFlow
+	Position *Position
 }
 
+/*
+*  Position is an open position summed up from the trades of its
+*  PositionID: the Quantity bought minus what was sold, and the
+*  AverageCost of the buys
+ */
+type Position struct {
+	ID          string
+	Quantity    float64
+	AverageCost float64
+}
+
+/*
+*  HighLow returns the bar range, falling back to Price
+*  for plain price ticks without candle data
+ */
+func (m *MarketData) HighLow() (float64, float64) {
+	if m.High == 0 || m.Low == 0 {
+		return m.Price, m.Price
+	}
+	return m.High, m.Low
+}
+
+/* Frame returns the closed candles of one subscribed interval */
+func (m *MarketData) Frame(interval string) []Kline {
+	return m.Frames[interval]
+}
+
+/*
+*  Signal is a strategy's trade suggestion.
+*  Action is BUY or SELL, strategies that sell short (pairs in
+*  hedge mode) also use SHORT to open and COVER to close a short.
+*  Everything besides Symbol and Action is optional:
+*  - Quantity: the strategy sized the order itself (grid, DCA)
+*  - Confidence: 0-1 strength of the signal, 0 means unspecified.
+*    Scales the order size, bounded by risk.MinConfidenceScale
+*  - Reason: human readable explanation, stored with the trade
+*  - Indicators: indicator values the decision was based on
+*  - StopLoss / TakeProfit: suggested exit levels for a BUY
+ */
 type Signal struct {
-	Symbol    string
-	Action    string
-	Price     float64
-	Quantity  float64
-	Timestamp time.Time
+	Symbol     string
+	Action     string
+	Price      float64
+	Quantity   float64
+	Timestamp  time.Time
+	Confidence float64
+	Reason     string
+	Indicators map[string]float64
+	StopLoss   float64
+	TakeProfit float64
+
+	/* Set when the strategy that gave it manages its own exits (strategy.ExitManager) */
+	ManagesExits bool
 }
 
 type Order struct {
@@ -25,6 +92,8 @@ type Order struct {
 	Timestamp     time.Time
 	Status        string
 	StopLossPrice float64
+	NoStopLoss    bool    // A BUY that rests no stop-loss order, e.g. DCA
+	Fee           float64 // Commission of the fill in USDT, set by PlaceOrder
 }
 
 type Kline struct {
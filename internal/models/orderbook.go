@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+/* BookLevel is one price level of the order book */
+type BookLevel struct {
+	Price    float64 `json:"p"`
+	Quantity float64 `json:"q"`
+}
+
+/*
+*  OrderBook is a depth snapshot of the best levels,
+*  best price first on both sides
+ */
+type OrderBook struct {
+	Symbol string
+	Time   time.Time
+	Bids   []BookLevel
+	Asks   []BookLevel
+}
+
+/* Mid returns the price halfway between the best bid and ask, 0 for an empty side */
+func (b *OrderBook) Mid() float64 {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0
+	}
+	return (b.Bids[0].Price + b.Asks[0].Price) / 2
+}
+
+/* SpreadPct returns the bid-ask spread as % of the mid price */
+func (b *OrderBook) SpreadPct() float64 {
+	mid := b.Mid()
+	if mid == 0 {
+		return 0
+	}
+	return (b.Asks[0].Price - b.Bids[0].Price) / mid * 100
+}
+
+/*
+*  TradeFlow is the aggressive volume traded over a recent window.
+*  Buys are taker buys lifting the ask, sells are taker sells
+*  hitting the bid.
+ */
+type TradeFlow struct {
+	Window     time.Duration
+	BuyVolume  float64
+	SellVolume float64
+	Trades     int
+}
+
+/* BuyRatio returns the share of aggressive volume that bought, 0.5 when nothing traded */
+func (f *TradeFlow) BuyRatio() float64 {
+	total := f.BuyVolume + f.SellVolume
+	if total == 0 {
+		return 0.5
+	}
+	return f.BuyVolume / total
+}
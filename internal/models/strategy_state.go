@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// StrategyState is the saved memory of a trading pair's strategy
+type StrategyState struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Symbol    string    `gorm:"uniqueIndex;type:varchar(20);not null"`
+	Spec      string    `gorm:"type:text;not null"` // Strategy spec the state belongs to
+	State     []byte    `gorm:"type:blob"`          // Opaque, written by StatefulStrategy.MarshalState
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for the StrategyState model
+func (StrategyState) TableName() string {
+	return "strategy_states"
+}
@@ -20,6 +20,10 @@ type Trade struct {
 	PnL        float64   `gorm:"column:pn_l;type:decimal(20,8);default:0"`         // Profit/Loss in USDT
 	PnLPercent float64   `gorm:"column:pn_l_percent;type:decimal(10,4);default:0"` // Profit/Loss percentage
 	Status     string    `gorm:"index;type:varchar(20);default:'OPEN'"`            // OPEN or CLOSED
+	Reason     string    `gorm:"type:varchar(255);default:''"`                     // Why the strategy traded
+	StopLoss   float64   `gorm:"type:decimal(20,8);default:0"`                     // Stop-loss level of a BUY, 0 if none
+	TakeProfit float64   `gorm:"type:decimal(20,8);default:0"`                     // Take-profit level of a BUY, 0 if none
+	OwnExits   bool      `gorm:"default:false"`                                    // The BUY's strategy manages the position's exits
 	CreatedAt  time.Time `gorm:"autoCreateTime"`                                   // When the record was created
 	UpdatedAt  time.Time `gorm:"autoUpdateTime"`                                   // When the record was last updated
 }
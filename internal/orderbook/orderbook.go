@@ -0,0 +1,196 @@
+package orderbook
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	Order Book Imbalance
+
+*  What is order book imbalance?
+*
+*  The difference between resting buy and sell quantity near the
+*  price, as a share of both:
+*
+*    imbalance = (bid qty - ask qty) / (bid qty + ask qty)
+*
+*  +1 is all bids, -1 is all asks. Over the top level alone it says
+*  which side is about to be exhausted first, over several levels it
+*  shows where the depth is. Together with trade flow (who is
+*  crossing the spread) it is a short-horizon pressure reading.
+*/
+func Imbalance(book *models.OrderBook, levels int) float64 {
+	if book == nil {
+		return 0
+	}
+	bids, asks := depth(book.Bids, levels), depth(book.Asks, levels)
+	if bids+asks == 0 {
+		return 0
+	}
+	return (bids - asks) / (bids + asks)
+}
+
+func depth(side []models.BookLevel, levels int) float64 {
+	if levels > len(side) {
+		levels = len(side)
+	}
+	total := 0.0
+	for _, level := range side[:levels] {
+		total += level.Quantity
+	}
+	return total
+}
+
+/*
+*  Record is one recorded observation: the price, the book and the
+*  trade flow a strategy saw at that moment. Recordings are JSON
+*  lines, one Record per line.
+ */
+type Record struct {
+	Time       time.Time          `json:"time"`
+	Symbol     string             `json:"symbol"`
+	Price      float64            `json:"price"`
+	Bids       []models.BookLevel `json:"bids"`
+	Asks       []models.BookLevel `json:"asks"`
+	FlowWindow time.Duration      `json:"flow_window"`
+	BuyVolume  float64            `json:"buy_volume"`
+	SellVolume float64            `json:"sell_volume"`
+	Trades     int                `json:"trades"`
+}
+
+/* NewRecord captures market data that carries a book */
+func NewRecord(data *models.MarketData) Record {
+	record := Record{Time: data.Time, Symbol: data.Symbol, Price: data.Price}
+	if data.Book != nil {
+		record.Bids, record.Asks = data.Book.Bids, data.Book.Asks
+	}
+	if data.Flow != nil {
+		record.FlowWindow = data.Flow.Window
+		record.BuyVolume, record.SellVolume, record.Trades = data.Flow.BuyVolume, data.Flow.SellVolume, data.Flow.Trades
+	}
+	return record
+}
+
+/* MarketData turns the record back into what the strategy saw */
+func (r Record) MarketData() *models.MarketData {
+	return &models.MarketData{
+		Symbol: r.Symbol,
+		Price:  r.Price,
+		Time:   r.Time,
+		Book:   &models.OrderBook{Symbol: r.Symbol, Time: r.Time, Bids: r.Bids, Asks: r.Asks},
+		Flow: &models.TradeFlow{
+			Window:     r.FlowWindow,
+			BuyVolume:  r.BuyVolume,
+			SellVolume: r.SellVolume,
+			Trades:     r.Trades,
+		},
+	}
+}
+
+/*
+	Recorder
+
+*  appends records to one file per symbol, <dir>/<SYMBOL>.depth.jsonl.
+*  Files are opened on first use and appended to across restarts.
+*/
+type Recorder struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]*os.File
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	return &Recorder{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+/* RecordingPath returns the file a symbol is recorded to */
+func RecordingPath(dir, symbol string) string {
+	return filepath.Join(dir, strings.ToUpper(symbol)+".depth.jsonl")
+}
+
+func (r *Recorder) Record(data *models.MarketData) error {
+	line, err := json.Marshal(NewRecord(data))
+	if err != nil {
+		return fmt.Errorf("failed to encode depth record: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[data.Symbol]
+	if !ok {
+		file, err = os.OpenFile(RecordingPath(r.dir, data.Symbol), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open depth recording: %v", err)
+		}
+		r.files[data.Symbol] = file
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write depth record: %v", err)
+	}
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first error
+	for symbol, file := range r.files {
+		if err := file.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(r.files, symbol)
+	}
+	return first
+}
+
+/*
+	Load
+
+*  reads a recording, sorted by time. A truncated last line, left
+*  by a bot that was killed mid-write, is skipped.
+*/
+func Load(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open depth recording: %v", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	var pending error
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if pending != nil {
+			return nil, pending
+		}
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			pending = fmt.Errorf("%s line %d: %v", path, line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read depth recording: %v", err)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
@@ -0,0 +1,76 @@
+package orderbook
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestImbalance(t *testing.T) {
+	book := &models.OrderBook{
+		Bids: []models.BookLevel{{Price: 99, Quantity: 1}, {Price: 98, Quantity: 5}},
+		Asks: []models.BookLevel{{Price: 101, Quantity: 3}, {Price: 102, Quantity: 1}},
+	}
+	if got := Imbalance(book, 1); math.Abs(got-(-0.5)) > 1e-9 {
+		t.Errorf("Expected top imbalance -0.5, got %.4f", got)
+	}
+	if got := Imbalance(book, 10); math.Abs(got-0.2) > 1e-9 {
+		t.Errorf("Expected depth imbalance 0.2, got %.4f", got)
+	}
+	if got := Imbalance(nil, 5); got != 0 {
+		t.Errorf("Expected 0 without a book, got %.4f", got)
+	}
+	if book.Mid() != 100 || math.Abs(book.SpreadPct()-2) > 1e-9 {
+		t.Errorf("Expected mid 100 and spread 2%%, got %.2f and %.4f", book.Mid(), book.SpreadPct())
+	}
+}
+
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 2; i >= 0; i-- {
+		err := recorder.Record(&models.MarketData{
+			Symbol: "BTCUSDT",
+			Price:  100 + float64(i),
+			Time:   start.Add(time.Duration(i) * 10 * time.Second),
+			Book: &models.OrderBook{
+				Bids: []models.BookLevel{{Price: 99, Quantity: 2}},
+				Asks: []models.BookLevel{{Price: 101, Quantity: 1}},
+			},
+			Flow: &models.TradeFlow{Window: time.Minute, BuyVolume: 3, SellVolume: 1, Trades: 4},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	recorder.Close()
+
+	/* A bot killed mid-write leaves half a line */
+	file, _ := os.OpenFile(RecordingPath(dir, "btcusdt"), os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"time":"2024-01-01T00:00:30Z","sym`)
+	file.Close()
+
+	records, err := Load(RecordingPath(dir, "BTCUSDT"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Price != 100 || records[2].Price != 102 {
+		t.Errorf("Records not sorted by time: %.0f ... %.0f", records[0].Price, records[2].Price)
+	}
+
+	data := records[0].MarketData()
+	if Imbalance(data.Book, 1) <= 0 || data.Flow.BuyRatio() != 0.75 || data.Flow.Window != time.Minute {
+		t.Errorf("Book or flow not restored: %+v %+v", data.Book, data.Flow)
+	}
+}
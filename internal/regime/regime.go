@@ -0,0 +1,213 @@
+package regime
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+)
+
+/*
+	Regime
+
+*  What is a market regime?
+*
+*  The kind of market price is in right now. Strategies that work
+*  in one regime usually lose in another: mean reversion makes money
+*  in a range and gets run over in a trend.
+*
+*  The detector classifies every bar from three readings:
+*  - ATR percentile: how today's volatility (ATR as % of price)
+*    ranks against the last ATRWindow bars
+*  - ADX: trend strength
+*  - MA slope: trend direction, % change of the moving average
+*    per bar over SlopeBars bars
+*/
+type Regime string
+
+const (
+	Unknown        Regime = ""
+	TrendingUp     Regime = "trending_up"
+	TrendingDown   Regime = "trending_down"
+	Ranging        Regime = "ranging"
+	HighVolatility Regime = "high_volatility"
+)
+
+/* All lists the regimes the detector can produce */
+var All = []Regime{TrendingUp, TrendingDown, Ranging, HighVolatility}
+
+/* Trending reports whether the regime is a trend in either direction */
+func (r Regime) Trending() bool {
+	return r == TrendingUp || r == TrendingDown
+}
+
+func (r Regime) String() string {
+	if r == Unknown {
+		return "unknown"
+	}
+	return string(r)
+}
+
+/*
+*  Config holds the detector thresholds
+*  - ADXPeriod / ADXTrend: ADX at or above ADXTrend is a trend
+*  - ATRPeriod / ATRWindow / HighVolPercentile: ATR ranking at or
+*    above the percentile is high volatility, which wins over trend
+*  - MAPeriod / SlopeBars / SlopeMin: the trend needs the MA to move
+*    at least SlopeMin % per bar in its direction
+ */
+type Config struct {
+	ADXPeriod         int
+	ADXTrend          float64
+	ATRPeriod         int
+	ATRWindow         int
+	HighVolPercentile float64
+	MAPeriod          int
+	SlopeBars         int
+	SlopeMin          float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ADXPeriod:         14,
+		ADXTrend:          25,
+		ATRPeriod:         14,
+		ATRWindow:         100,
+		HighVolPercentile: 90,
+		MAPeriod:          50,
+		SlopeBars:         5,
+		SlopeMin:          0.01,
+	}
+}
+
+/* Snapshot is the detector's latest reading */
+type Snapshot struct {
+	Regime        Regime
+	ADX           float64
+	ATRPercentile float64
+	Slope         float64
+}
+
+/*
+	Detector
+
+*  classifies one price series, call Update once per bar
+*/
+type Detector struct {
+	config   Config
+	adx      *indicator.ADX
+	atr      *indicator.ATR
+	ma       *indicator.EMA
+	atrPcts  []float64
+	maValues []float64
+	current  Snapshot
+}
+
+func NewDetector(config Config) *Detector {
+	return &Detector{
+		config: config,
+		adx:    indicator.NewADX(config.ADXPeriod),
+		atr:    indicator.NewATR(config.ATRPeriod),
+		ma:     indicator.NewEMA(config.MAPeriod),
+	}
+}
+
+/*
+	Update
+
+*  feeds one bar and returns the regime, Unknown until every
+*  reading has warmed up
+*/
+func (d *Detector) Update(high, low, close float64) Regime {
+	adx := d.adx.Update(high, low, close)
+	atr := d.atr.Update(high, low, close)
+	ma := d.ma.Update(close)
+
+	if d.atr.Ready() && close > 0 {
+		d.atrPcts = append(d.atrPcts, atr/close*100)
+		if len(d.atrPcts) > d.config.ATRWindow {
+			d.atrPcts = d.atrPcts[1:]
+		}
+	}
+	if d.ma.Ready() {
+		d.maValues = append(d.maValues, ma)
+		if len(d.maValues) > d.config.SlopeBars+1 {
+			d.maValues = d.maValues[1:]
+		}
+	}
+
+	if !d.adx.Ready() || len(d.atrPcts) < d.config.ATRWindow || len(d.maValues) <= d.config.SlopeBars {
+		d.current = Snapshot{ADX: adx}
+		return Unknown
+	}
+
+	oldest := d.maValues[0]
+	slope := (ma - oldest) / oldest * 100 / float64(d.config.SlopeBars)
+	percentile := percentRank(d.atrPcts, d.atrPcts[len(d.atrPcts)-1])
+
+	regime := Ranging
+	switch {
+	case percentile >= d.config.HighVolPercentile:
+		regime = HighVolatility
+	case adx >= d.config.ADXTrend && slope >= d.config.SlopeMin:
+		regime = TrendingUp
+	case adx >= d.config.ADXTrend && slope <= -d.config.SlopeMin:
+		regime = TrendingDown
+	}
+	d.current = Snapshot{Regime: regime, ADX: adx, ATRPercentile: percentile, Slope: slope}
+	return regime
+}
+
+/* Current returns the latest reading */
+func (d *Detector) Current() Snapshot {
+	return d.current
+}
+
+/* percentRank returns the % of values strictly below v */
+func percentRank(values []float64, v float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	below := sort.SearchFloat64s(sorted, v)
+	return math.Round(float64(below)/float64(len(sorted))*10000) / 100
+}
+
+/*
+	Board
+
+*  shares the latest snapshot per symbol between the trading loop
+*  and readers such as the dashboard
+*/
+type Board struct {
+	mu        sync.RWMutex
+	snapshots map[string]Snapshot
+}
+
+func NewBoard() *Board {
+	return &Board{snapshots: make(map[string]Snapshot)}
+}
+
+func (b *Board) Set(symbol string, snapshot Snapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.snapshots[symbol] = snapshot
+}
+
+/* Get returns the latest snapshot of one symbol */
+func (b *Board) Get(symbol string) (Snapshot, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	snapshot, ok := b.snapshots[symbol]
+	return snapshot, ok
+}
+
+/* All returns a copy of every snapshot */
+func (b *Board) All() map[string]Snapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	all := make(map[string]Snapshot, len(b.snapshots))
+	for symbol, snapshot := range b.snapshots {
+		all[symbol] = snapshot
+	}
+	return all
+}
@@ -0,0 +1,52 @@
+package regime
+
+import (
+	"math"
+	"testing"
+)
+
+func run(d *Detector, prices []float64) Regime {
+	var r Regime
+	for _, p := range prices {
+		r = d.Update(p*1.001, p*0.999, p)
+	}
+	return r
+}
+
+func TestDetectorClassifies(t *testing.T) {
+	n := 400
+
+	up := make([]float64, n)
+	down := make([]float64, n)
+	flat := make([]float64, n)
+	for i := 0; i < n; i++ {
+		noise := 1 + 0.002*math.Sin(float64(i)*1.7)
+		up[i] = 100 * math.Pow(1.002, float64(i)) * noise
+		down[i] = 100 * math.Pow(0.998, float64(i)) * noise
+		flat[i] = 100 + math.Sin(float64(i)/3)*0.5
+	}
+
+	if r := run(NewDetector(DefaultConfig()), up); r != TrendingUp {
+		t.Errorf("steady rise: got %s, want %s", r, TrendingUp)
+	}
+	if r := run(NewDetector(DefaultConfig()), down); r != TrendingDown {
+		t.Errorf("steady fall: got %s, want %s", r, TrendingDown)
+	}
+	if r := run(NewDetector(DefaultConfig()), flat); r != Ranging {
+		t.Errorf("oscillation: got %s, want %s", r, Ranging)
+	}
+
+	/* A sudden burst of wide bars after a quiet range */
+	d := NewDetector(DefaultConfig())
+	run(d, flat)
+	for i := 0; i < 3; i++ {
+		d.Update(106, 94, 100)
+	}
+	if r := d.Current().Regime; r != HighVolatility {
+		t.Errorf("volatility spike: got %s, want %s", r, HighVolatility)
+	}
+
+	if r := run(NewDetector(DefaultConfig()), up[:50]); r != Unknown {
+		t.Errorf("before warm-up: got %s, want %s", r, Unknown)
+	}
+}
@@ -2,8 +2,16 @@ package risk
 
 import (
 	"math"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
 )
 
+/* Stop-loss distance used when a signal doesn't suggest one */
+const DefaultStopLossPercent = 0.5
+
+/* Smallest share of the risk based size a low confidence signal gets */
+const MinConfidenceScale = 0.5
+
 type RiskManager struct {
 	maxDrawdown       float64
 	riskPerTrade      float64
@@ -55,6 +63,31 @@ func (r *RiskManager) CalculatePositionSize(price float64, stopLoss float64) (fl
 	return math.Min(quantity, maxQuantity), nil
 }
 
+/*
+*  Calculate the position size for a signal
+*  - uses the signal's stop-loss when it is below price,
+*    otherwise DefaultStopLossPercent below price
+*  - scales the size by the signal confidence when it is set,
+*    clamped to [MinConfidenceScale, 1] so a shallow entry still
+*    gets a usable order
+*  Returns the quantity and the stop-loss it was sized for
+ */
+func (r *RiskManager) CalculateSignalPositionSize(price float64, signal *models.Signal) (float64, float64, error) {
+	stopLoss := price * (1 - DefaultStopLossPercent/100)
+	if signal.StopLoss > 0 && signal.StopLoss < price {
+		stopLoss = signal.StopLoss
+	}
+
+	quantity, err := r.CalculatePositionSize(price, stopLoss)
+	if err != nil {
+		return 0, 0, err
+	}
+	if signal.Confidence > 0 {
+		quantity *= math.Max(MinConfidenceScale, math.Min(signal.Confidence, 1))
+	}
+	return quantity, stopLoss, nil
+}
+
 /*
 *  Update the balance
  */
@@ -0,0 +1,38 @@
+package risk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestSignalPositionSizeScalesByConfidence(t *testing.T) {
+	r := NewRiskManager(1000, 0.2, 0.02, 1, false)
+
+	/* 2% of 1000 risked over a 2 USDT stop distance */
+	full, stopLoss, err := r.CalculateSignalPositionSize(100, &models.Signal{Action: "BUY", StopLoss: 98, Confidence: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stopLoss != 98 || math.Abs(full-10) > 1e-9 {
+		t.Fatalf("Expected 10 units with the stop at 98, got %.4f with the stop at %.2f", full, stopLoss)
+	}
+
+	/* Confidence scales the size, a shallow entry (RSI just below oversold) no lower than half */
+	for _, c := range []struct{ confidence, want float64 }{{0, 10}, {0.8, 8}, {0.16, 5}, {1.5, 10}} {
+		quantity, _, err := r.CalculateSignalPositionSize(100, &models.Signal{Action: "BUY", StopLoss: 98, Confidence: c.confidence})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if math.Abs(quantity-c.want) > 1e-9 {
+			t.Errorf("Expected %.2f units at confidence %.2f, got %.4f", c.want, c.confidence, quantity)
+		}
+	}
+
+	/* Without a usable stop the default distance applies */
+	_, stopLoss, _ = r.CalculateSignalPositionSize(100, &models.Signal{Action: "BUY", StopLoss: 101})
+	if want := 100 * (1 - DefaultStopLossPercent/100); stopLoss != want {
+		t.Errorf("Expected the default stop at %.2f, got %.2f", want, stopLoss)
+	}
+}
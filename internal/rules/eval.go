@@ -0,0 +1,340 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+)
+
+/* Bar is what a rule sees each step */
+type Bar struct {
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+/*
+*  Position describes the trade the rules are managing,
+*  EntryPrice is 0 while flat
+ */
+type Position struct {
+	EntryPrice  float64
+	BarsInTrade int
+}
+
+/*
+*  variables available to every rule. Position variables are
+*  NaN while flat, so comparisons against them are false.
+ */
+var variables = map[string]func(b Bar, p Position) float64{
+	"open":   func(b Bar, p Position) float64 { return b.Open },
+	"high":   func(b Bar, p Position) float64 { return b.High },
+	"low":    func(b Bar, p Position) float64 { return b.Low },
+	"close":  func(b Bar, p Position) float64 { return b.Close },
+	"price":  func(b Bar, p Position) float64 { return b.Close },
+	"volume": func(b Bar, p Position) float64 { return b.Volume },
+	"entry_price": func(b Bar, p Position) float64 {
+		if p.EntryPrice == 0 {
+			return math.NaN()
+		}
+		return p.EntryPrice
+	},
+	"profit_pct": func(b Bar, p Position) float64 {
+		if p.EntryPrice == 0 {
+			return math.NaN()
+		}
+		return (b.Close - p.EntryPrice) / p.EntryPrice * 100
+	},
+	"bars_in_trade": func(b Bar, p Position) float64 {
+		if p.EntryPrice == 0 {
+			return math.NaN()
+		}
+		return float64(p.BarsInTrade)
+	},
+}
+
+/* argSpec validates one constant function argument */
+type argSpec struct {
+	name    string
+	integer bool
+	min     float64
+}
+
+func (a argSpec) check(v float64) error {
+	if a.integer && v != math.Trunc(v) {
+		return fmt.Errorf("must be a whole number, got %g", v)
+	}
+	if v < a.min {
+		return fmt.Errorf("must be at least %g, got %g", a.min, v)
+	}
+	return nil
+}
+
+var (
+	period = argSpec{name: "period", integer: true, min: 1}
+	stddev = argSpec{name: "k", min: 0}
+)
+
+/*
+*  series is a streaming indicator behind a function call. update
+*  is called once per bar and returns NaN until it is ready.
+ */
+type series interface {
+	update(b Bar) float64
+}
+
+type seriesFunc func(b Bar) float64
+
+func (f seriesFunc) update(b Bar) float64 { return f(b) }
+
+type funcSpec struct {
+	args    []argSpec
+	example string
+	build   func(args []float64) series
+}
+
+func ready(ok bool, v float64) float64 {
+	if !ok {
+		return math.NaN()
+	}
+	return v
+}
+
+/* functions maps a rule function to the indicator library */
+var functions = map[string]funcSpec{
+	"sma": {[]argSpec{period}, "sma(20)", func(a []float64) series {
+		s := indicator.NewSMA(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { return ready(s.Ready(), s.Update(b.Close)) })
+	}},
+	"ema": {[]argSpec{period}, "ema(21)", func(a []float64) series {
+		e := indicator.NewEMA(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { return ready(e.Ready(), e.Update(b.Close)) })
+	}},
+	"rsi": {[]argSpec{period}, "rsi(14)", func(a []float64) series {
+		r := indicator.NewRSI(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { v := r.Update(b.Close); return ready(r.Ready(), v) })
+	}},
+	"atr": {[]argSpec{period}, "atr(14)", func(a []float64) series {
+		r := indicator.NewATR(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { v := r.Update(b.High, b.Low, b.Close); return ready(r.Ready(), v) })
+	}},
+	"adx": {[]argSpec{period}, "adx(14)", func(a []float64) series {
+		r := indicator.NewADX(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { v := r.Update(b.High, b.Low, b.Close); return ready(r.Ready(), v) })
+	}},
+	"plus_di": {[]argSpec{period}, "plus_di(14)", func(a []float64) series {
+		r := indicator.NewADX(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { r.Update(b.High, b.Low, b.Close); return ready(r.Ready(), r.PlusDI()) })
+	}},
+	"minus_di": {[]argSpec{period}, "minus_di(14)", func(a []float64) series {
+		r := indicator.NewADX(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { r.Update(b.High, b.Low, b.Close); return ready(r.Ready(), r.MinusDI()) })
+	}},
+	"bb_upper": {[]argSpec{period, stddev}, "bb_upper(20, 2)", func(a []float64) series {
+		bb := indicator.NewBollinger(int(a[0]), a[1])
+		return seriesFunc(func(b Bar) float64 { bb.Update(b.Close); return ready(bb.Ready(), bb.Upper()) })
+	}},
+	"bb_mid": {[]argSpec{period, stddev}, "bb_mid(20, 2)", func(a []float64) series {
+		bb := indicator.NewBollinger(int(a[0]), a[1])
+		return seriesFunc(func(b Bar) float64 { bb.Update(b.Close); return ready(bb.Ready(), bb.Middle()) })
+	}},
+	"bb_lower": {[]argSpec{period, stddev}, "bb_lower(20, 2)", func(a []float64) series {
+		bb := indicator.NewBollinger(int(a[0]), a[1])
+		return seriesFunc(func(b Bar) float64 { bb.Update(b.Close); return ready(bb.Ready(), bb.Lower()) })
+	}},
+	/* highest / lowest look at the bars before the current one, so close > highest(20) is a breakout */
+	"highest": {[]argSpec{period}, "highest(20)", func(a []float64) series {
+		d := indicator.NewDonchian(int(a[0]))
+		return seriesFunc(func(b Bar) float64 {
+			v := ready(d.Ready(), d.Upper())
+			d.Update(b.High, b.Low)
+			return v
+		})
+	}},
+	"lowest": {[]argSpec{period}, "lowest(20)", func(a []float64) series {
+		d := indicator.NewDonchian(int(a[0]))
+		return seriesFunc(func(b Bar) float64 {
+			v := ready(d.Ready(), d.Lower())
+			d.Update(b.High, b.Low)
+			return v
+		})
+	}},
+	"volume_sma": {[]argSpec{period}, "volume_sma(20)", func(a []float64) series {
+		s := indicator.NewSMA(int(a[0]))
+		return seriesFunc(func(b Bar) float64 { return ready(s.Ready(), s.Update(b.Volume)) })
+	}},
+}
+
+/* Functions returns the names of the rule functions, sorted */
+func Functions() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* Variables returns the names of the rule variables, sorted */
+func Variables() []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+	Evaluator
+
+*  runs a set of rules over one price series. Each distinct
+*  function call gets one indicator, shared by every rule that
+*  uses it, and is updated exactly once per bar.
+*/
+type Evaluator struct {
+	calls  map[string]series
+	values map[string]float64
+	order  []string
+	prev   map[*Binary]float64
+	bar    Bar
+	pos    Position
+}
+
+func NewEvaluator(nodes ...Node) *Evaluator {
+	e := &Evaluator{
+		calls:  make(map[string]series),
+		values: make(map[string]float64),
+		prev:   make(map[*Binary]float64),
+	}
+	for _, n := range nodes {
+		if n != nil {
+			e.collect(n)
+		}
+	}
+	sort.Strings(e.order)
+	return e
+}
+
+func (e *Evaluator) collect(n Node) {
+	switch n := n.(type) {
+	case *Call:
+		key := n.String()
+		if _, ok := e.calls[key]; !ok {
+			e.calls[key] = functions[n.Name].build(n.Args)
+			e.order = append(e.order, key)
+		}
+	case *Unary:
+		e.collect(n.X)
+	case *Binary:
+		e.collect(n.X)
+		e.collect(n.Y)
+	}
+}
+
+/* Update feeds one bar to every indicator */
+func (e *Evaluator) Update(bar Bar, pos Position) {
+	e.bar, e.pos = bar, pos
+	for _, key := range e.order {
+		e.values[key] = e.calls[key].update(bar)
+	}
+}
+
+/* Values returns the current value of every indicator call, keyed by call */
+func (e *Evaluator) Values() map[string]float64 {
+	values := make(map[string]float64, len(e.values))
+	for key, v := range e.values {
+		if !math.IsNaN(v) {
+			values[key] = v
+		}
+	}
+	return values
+}
+
+/*
+	Condition
+
+*  evaluates a condition on the current bar. Every condition must be
+*  evaluated every bar for crosses_above / crosses_below to see the
+*  previous bar, NaN (not ready) comparisons are false.
+*/
+func (e *Evaluator) Condition(n Node) bool {
+	return e.eval(n) == 1
+}
+
+/* Level evaluates a numeric rule, NaN while its indicators warm up */
+func (e *Evaluator) Level(n Node) float64 {
+	return e.eval(n)
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *Evaluator) eval(n Node) float64 {
+	switch n := n.(type) {
+	case *NumberLit:
+		return n.Value
+	case *Variable:
+		return variables[n.Name](e.bar, e.pos)
+	case *Call:
+		return e.values[n.String()]
+	case *Unary:
+		x := e.eval(n.X)
+		if n.Op == "not" {
+			return truth(x != 1)
+		}
+		return -x
+	case *Binary:
+		/* Both sides every time, crosses need their previous value */
+		x, y := e.eval(n.X), e.eval(n.Y)
+		switch n.Op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "/":
+			if y == 0 {
+				return math.NaN()
+			}
+			return x / y
+		case "and":
+			return truth(x == 1 && y == 1)
+		case "or":
+			return truth(x == 1 || y == 1)
+		case "<":
+			return truth(x < y)
+		case "<=":
+			return truth(x <= y)
+		case ">":
+			return truth(x > y)
+		case ">=":
+			return truth(x >= y)
+		case "==":
+			return truth(x == y)
+		case "!=":
+			return truth(!math.IsNaN(x) && !math.IsNaN(y) && x != y)
+		case "crosses_above", "crosses_below":
+			diff := x - y
+			prev, seen := e.prev[n]
+			e.prev[n] = diff
+			if !seen || math.IsNaN(prev) || math.IsNaN(diff) {
+				return 0
+			}
+			if n.Op == "crosses_above" {
+				return truth(prev <= 0 && diff > 0)
+			}
+			return truth(prev >= 0 && diff < 0)
+		}
+	}
+	return math.NaN()
+}
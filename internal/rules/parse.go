@@ -0,0 +1,460 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+	Rule Expressions
+
+*  A rule is a small expression over the current bar and the
+*  indicator library, e.g.
+*
+*    rsi(14) < 30 and close < bb_lower(20, 2)
+*    ema(9) crosses_above ema(21) or profit_pct > 3
+*
+*  Grammar, loosest binding first:
+*
+*    or:       and ("or" and)*
+*    and:      not ("and" not)*
+*    not:      "not" not | compare
+*    compare:  sum (op sum)?     op: < <= > >= == != crosses_above crosses_below
+*    sum:      product (("+" | "-") product)*
+*    product:  unary (("*" | "/") unary)*
+*    unary:    "-" unary | primary
+*    primary:  number | variable | function "(" number ("," number)* ")" | "(" or ")"
+*
+*  Expressions are type checked when parsed, so a rule like
+*  "rsi(14) and close" fails at load time instead of at runtime.
+*/
+
+/* Type is the static type of an expression */
+type Type int
+
+const (
+	Number Type = iota
+	Bool
+)
+
+func (t Type) String() string {
+	if t == Bool {
+		return "condition"
+	}
+	return "number"
+}
+
+/* Node is an expression in the rule AST */
+type Node interface {
+	Pos() int // 1-based column in the source
+	Type() Type
+	String() string
+}
+
+type NumberLit struct {
+	pos   int
+	Value float64
+}
+
+type Variable struct {
+	pos  int
+	Name string
+}
+
+/* Call is an indicator, its arguments are constants */
+type Call struct {
+	pos  int
+	Name string
+	Args []float64
+}
+
+/* Unary is "-" or "not" */
+type Unary struct {
+	pos int
+	Op  string
+	X   Node
+}
+
+type Binary struct {
+	pos int
+	Op  string
+	X   Node
+	Y   Node
+}
+
+func (n *NumberLit) Pos() int { return n.pos }
+func (n *Variable) Pos() int  { return n.pos }
+func (n *Call) Pos() int      { return n.pos }
+func (n *Unary) Pos() int     { return n.pos }
+func (n *Binary) Pos() int    { return n.pos }
+
+func (n *NumberLit) Type() Type { return Number }
+func (n *Variable) Type() Type  { return Number }
+func (n *Call) Type() Type      { return Number }
+
+func (n *Unary) Type() Type {
+	if n.Op == "not" {
+		return Bool
+	}
+	return Number
+}
+
+func (n *Binary) Type() Type {
+	switch n.Op {
+	case "+", "-", "*", "/":
+		return Number
+	}
+	return Bool
+}
+
+func (n *NumberLit) String() string { return strconv.FormatFloat(n.Value, 'g', -1, 64) }
+func (n *Variable) String() string  { return n.Name }
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = strconv.FormatFloat(a, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%s(%s)", n.Name, strings.Join(args, ", "))
+}
+
+func (n *Unary) String() string {
+	if n.Op == "not" {
+		return "not " + n.X.String()
+	}
+	return "-" + n.X.String()
+}
+
+func (n *Binary) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.X, n.Op, n.Y)
+}
+
+/* Error is a parse or validation error at a column of the rule */
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("col %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start + 1})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, strings.ToLower(src[start:i]), start + 1})
+		default:
+			if i+1 < len(src) {
+				if two := src[i : i+2]; two == "<=" || two == ">=" || two == "==" || two == "!=" {
+					tokens = append(tokens, token{tokOp, two, i + 1})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("<>+-*/(),", c) {
+				return nil, errorf(i+1, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{tokOp, string(c), i + 1})
+			i++
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src) + 1}), nil
+}
+
+type parser struct {
+	tokens []token
+	at     int
+}
+
+func (p *parser) peek() token { return p.tokens[p.at] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.at]
+	if t.kind != tokEOF {
+		p.at++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) (token, bool) {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		return p.next(), true
+	}
+	return token{}, false
+}
+
+/*
+	Parse
+
+*  parses and type checks a rule. want is the type the rule must
+*  have: Bool for entry / exit conditions, Number for price levels.
+*/
+func Parse(src string, want Type) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, errorf(1, "empty rule")
+	}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", t.text)
+	}
+	if node.Type() != want {
+		return nil, errorf(1, "rule is a %s, expected a %s", node.Type(), want)
+	}
+	return node, nil
+}
+
+func (p *parser) or() (Node, error) {
+	return p.logical("or", p.and)
+}
+
+func (p *parser) and() (Node, error) {
+	return p.logical("and", p.not)
+}
+
+func (p *parser) logical(op string, operand func() (Node, error)) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(op)
+		if !ok {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(x, Bool, op); err != nil {
+			return nil, err
+		}
+		if err := expect(y, Bool, op); err != nil {
+			return nil, err
+		}
+		x = &Binary{pos: t.pos, Op: op, X: x, Y: y}
+	}
+}
+
+func (p *parser) not() (Node, error) {
+	if t, ok := p.accept("not"); ok {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(x, Bool, "not"); err != nil {
+			return nil, err
+		}
+		return &Unary{pos: t.pos, Op: "not", X: x}, nil
+	}
+	return p.compare()
+}
+
+var comparisons = []string{"<", "<=", ">", ">=", "==", "!=", "crosses_above", "crosses_below"}
+
+func (p *parser) compare() (Node, error) {
+	x, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range comparisons {
+		t, ok := p.accept(op)
+		if !ok {
+			continue
+		}
+		y, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(x, Number, op); err != nil {
+			return nil, err
+		}
+		if err := expect(y, Number, op); err != nil {
+			return nil, err
+		}
+		return &Binary{pos: t.pos, Op: op, X: x, Y: y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) sum() (Node, error) {
+	return p.arithmetic([]string{"+", "-"}, p.product)
+}
+
+func (p *parser) product() (Node, error) {
+	return p.arithmetic([]string{"*", "/"}, p.unary)
+}
+
+func (p *parser) arithmetic(ops []string, operand func() (Node, error)) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var t token
+		ok := false
+		for _, op := range ops {
+			if t, ok = p.accept(op); ok {
+				break
+			}
+		}
+		if !ok {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(x, Number, t.text); err != nil {
+			return nil, err
+		}
+		if err := expect(y, Number, t.text); err != nil {
+			return nil, err
+		}
+		x = &Binary{pos: t.pos, Op: t.text, X: x, Y: y}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if t, ok := p.accept("-"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(x, Number, "-"); err != nil {
+			return nil, err
+		}
+		return &Unary{pos: t.pos, Op: "-", X: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		return &NumberLit{pos: t.pos, Value: v}, nil
+	case tokIdent:
+		if _, ok := p.accept("("); ok {
+			return p.call(t)
+		}
+		if _, ok := variables[t.text]; !ok {
+			if _, isFunc := functions[t.text]; isFunc {
+				return nil, errorf(t.pos, "%s needs arguments, e.g. %s", t.text, functions[t.text].example)
+			}
+			return nil, errorf(t.pos, "unknown variable %q", t.text)
+		}
+		return &Variable{pos: t.pos, Name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, errorf(p.peek().pos, "missing )")
+			}
+			return x, nil
+		}
+	case tokEOF:
+		return nil, errorf(t.pos, "unexpected end of rule")
+	}
+	return nil, errorf(t.pos, "unexpected %q", t.text)
+}
+
+func (p *parser) call(name token) (Node, error) {
+	spec, ok := functions[name.text]
+	if !ok {
+		return nil, errorf(name.pos, "unknown function %q", name.text)
+	}
+
+	var args []float64
+	for {
+		negative := false
+		if _, ok := p.accept("-"); ok {
+			negative = true
+		}
+		t := p.next()
+		if t.kind != tokNumber {
+			return nil, errorf(t.pos, "%s arguments must be numbers", name.text)
+		}
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		if negative {
+			v = -v
+		}
+		args = append(args, v)
+		if _, ok := p.accept(","); !ok {
+			break
+		}
+	}
+	if _, ok := p.accept(")"); !ok {
+		return nil, errorf(p.peek().pos, "missing ) after %s arguments", name.text)
+	}
+
+	if len(args) != len(spec.args) {
+		return nil, errorf(name.pos, "%s takes %d argument(s), e.g. %s", name.text, len(spec.args), spec.example)
+	}
+	for i, arg := range spec.args {
+		if err := arg.check(args[i]); err != nil {
+			return nil, errorf(name.pos, "%s %s: %v", name.text, arg.name, err)
+		}
+	}
+	return &Call{pos: name.pos, Name: name.text, Args: args}, nil
+}
+
+func expect(n Node, want Type, op string) error {
+	if n.Type() != want {
+		return errorf(n.Pos(), "%q needs a %s, got %s %s", op, want, n.Type(), n)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"rsi(14) < 30 and close < bb_lower(20,2)", ""},
+		{"ema(9) crosses_above ema(21) or not (profit_pct > 3)", ""},
+		{"rsl(14) < 30", `col 1: unknown function "rsl"`},
+		{"rsi(14.5) < 30", "whole number"},
+		{"bb_lower(20) > close", "takes 2 argument(s)"},
+		{"rsi(14) and close > 1", `"and" needs a condition`},
+		{"rsi(14) < 30 and", "unexpected end of rule"},
+		{"closing < 3", `unknown variable "closing"`},
+		{"rsi(14) < 30)", `col 13: unexpected ")"`},
+		{"rsi < 30", "rsi needs arguments"},
+		{"close + 1", "rule is a number, expected a condition"},
+		{"close $ 1", "unexpected character"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.rule, Bool)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%q: unexpected error %v", tt.rule, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%q: expected error containing %q, got %v", tt.rule, tt.want, err)
+		}
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	entry, err := Parse("sma(3) crosses_above sma(5) and close > 100", Bool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, err := Parse("close - 2 * atr(3)", Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEvaluator(entry, stop)
+
+	prices := []float64{110, 108, 106, 104, 102, 101, 103, 106, 109}
+	fired := -1
+	for i, p := range prices {
+		e.Update(Bar{Open: p, High: p + 1, Low: p - 1, Close: p}, Position{})
+		if e.Condition(entry) {
+			if fired >= 0 {
+				t.Fatalf("cross fired twice, at bars %d and %d", fired, i)
+			}
+			fired = i
+		}
+	}
+	if fired != 7 {
+		t.Errorf("expected the cross on bar 7, got %d", fired)
+	}
+	if level := e.Level(stop); math.IsNaN(level) || level >= 109 {
+		t.Errorf("expected a stop below the close, got %v", level)
+	}
+	if _, ok := e.Values()["sma(5)"]; !ok {
+		t.Errorf("expected indicator values keyed by call, got %v", e.Values())
+	}
+}
+
+func TestExpressionFile(t *testing.T) {
+	src, err := parseExpressionFile(`
+# Buy dips below the lower band
+entry: rsi(14) < 30
+  and close < bb_lower(20, 2)
+exit: rsi(14) > 70   # overbought
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Entry != "rsi(14) < 30 and close < bb_lower(20, 2)" || src.Exit != "rsi(14) > 70" {
+		t.Errorf("unexpected source %+v", src)
+	}
+	if _, err := (Source{Entry: "close > 1"}).Compile(); err == nil {
+		t.Error("expected an error for a rule set without a way out")
+	}
+}
@@ -0,0 +1,168 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+	RuleSet
+
+*  a strategy written as rules:
+*  - Entry: condition to buy while flat (required)
+*  - Exit: condition to sell while in a trade
+*  - StopLoss / TakeProfit: price levels computed on the entry bar
+*
+*  At least one way out (Exit, StopLoss or TakeProfit) is required.
+*/
+type RuleSet struct {
+	Name        string
+	Description string
+	Entry       Node
+	Exit        Node
+	StopLoss    Node
+	TakeProfit  Node
+	Source      Source // The rules as written
+}
+
+/* Source is the text form of a rule set, as written in a file */
+type Source struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Entry       string `yaml:"entry"`
+	Exit        string `yaml:"exit"`
+	StopLoss    string `yaml:"stop_loss"`
+	TakeProfit  string `yaml:"take_profit"`
+}
+
+/*
+	Compile
+
+*  parses and validates every rule of the source
+*/
+func (s Source) Compile() (*RuleSet, error) {
+	set := &RuleSet{Name: s.Name, Description: s.Description, Source: s}
+	for _, rule := range []struct {
+		key    string
+		src    string
+		want   Type
+		target *Node
+	}{
+		{"entry", s.Entry, Bool, &set.Entry},
+		{"exit", s.Exit, Bool, &set.Exit},
+		{"stop_loss", s.StopLoss, Number, &set.StopLoss},
+		{"take_profit", s.TakeProfit, Number, &set.TakeProfit},
+	} {
+		if strings.TrimSpace(rule.src) == "" {
+			continue
+		}
+		node, err := Parse(rule.src, rule.want)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", rule.key, err)
+		}
+		*rule.target = node
+	}
+
+	if set.Entry == nil {
+		return nil, fmt.Errorf("entry: rule is required")
+	}
+	if set.Exit == nil && set.StopLoss == nil && set.TakeProfit == nil {
+		return nil, fmt.Errorf("need a way out: set exit, stop_loss or take_profit")
+	}
+	return set, nil
+}
+
+/*
+	Load
+
+*  reads a rule file. Files ending in .yaml / .yml are YAML,
+*  anything else is an expression file of "key: rule" lines where
+*  indented lines continue the rule above and # starts a comment:
+*
+*    entry: rsi(14) < 30
+*      and close < bb_lower(20, 2)
+*    exit:  rsi(14) > 70
+*/
+func Load(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %v", err)
+	}
+
+	var src Source
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&src); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		if src, err = parseExpressionFile(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if src.Name == "" {
+		src.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	set, err := src.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return set, nil
+}
+
+func parseExpressionFile(text string) (Source, error) {
+	var src Source
+	fields := map[string]*string{
+		"name":        &src.Name,
+		"description": &src.Description,
+		"entry":       &src.Entry,
+		"exit":        &src.Exit,
+		"stop_loss":   &src.StopLoss,
+		"take_profit": &src.TakeProfit,
+	}
+
+	var current *string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		if i := strings.IndexByte(raw, '#'); i >= 0 {
+			raw = raw[:i]
+		}
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		/* Indented lines continue the previous rule */
+		if raw[0] == ' ' || raw[0] == '\t' {
+			if current == nil {
+				return src, fmt.Errorf("line %d: continuation without a rule", line)
+			}
+			*current += " " + strings.TrimSpace(raw)
+			continue
+		}
+
+		colon := strings.IndexByte(raw, ':')
+		if colon < 0 {
+			return src, fmt.Errorf("line %d: expected key: rule", line)
+		}
+		key := strings.TrimSpace(raw[:colon])
+		field, ok := fields[key]
+		if !ok {
+			return src, fmt.Errorf("line %d: unknown key %q", line, key)
+		}
+		if *field != "" {
+			return src, fmt.Errorf("line %d: %s is set twice", line, key)
+		}
+		*field = strings.TrimSpace(raw[colon+1:])
+		current = field
+	}
+	return src, scanner.Err()
+}
@@ -0,0 +1,275 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	BreakoutStrategy
+
+*  What is a Donchian Breakout Strategy?
+*
+*  A volatility breakout strategy. It buys when the close breaks
+*  above the highest high of the previous N bars, optionally only
+*  when volume confirms the move. It exits when the close falls
+*  below the lowest low of the previous M bars, or below an ATR
+*  trailing stop that ratchets up behind the highest close.
+*
+*  Each call to Analyze is treated as one bar. Volume confirmation
+*  needs candle volume, so it never passes on plain price ticks.
+*/
+type BreakoutStrategy struct {
+	config BreakoutConfig
+	states map[string]*breakoutState
+}
+
+/*
+*  BreakoutConfig holds the tunable parameters
+*  - EntryPeriod: N, bars in the entry channel
+*  - ExitPeriod: M, bars in the exit channel (0 disables)
+*  - ConfirmVolume / VolumePeriod / VolumeMult: require volume above
+*    VolumeMult times its VolumePeriod average on the breakout bar
+*  - ATRPeriod / TrailATRMult: trailing stop distance (0 disables)
+ */
+type BreakoutConfig struct {
+	EntryPeriod   int
+	ExitPeriod    int
+	ConfirmVolume bool
+	VolumePeriod  int
+	VolumeMult    float64
+	ATRPeriod     int
+	TrailATRMult  float64
+}
+
+type breakoutState struct {
+	entry     *indicator.Donchian
+	exit      *indicator.Donchian
+	volume    *indicator.SMA
+	atr       *indicator.ATR
+	inTrade   bool
+	highClose float64
+	trailStop float64
+}
+
+func DefaultBreakoutConfig() BreakoutConfig {
+	return BreakoutConfig{
+		EntryPeriod:   20,
+		ExitPeriod:    10,
+		ConfirmVolume: false,
+		VolumePeriod:  20,
+		VolumeMult:    1.5,
+		ATRPeriod:     14,
+		TrailATRMult:  3,
+	}
+}
+
+func NewBreakoutStrategy(config BreakoutConfig) *BreakoutStrategy {
+	return &BreakoutStrategy{
+		config: config,
+		states: make(map[string]*breakoutState),
+	}
+}
+
+func init() {
+	defaults := DefaultBreakoutConfig()
+	Register(Definition{
+		Name:        "breakout",
+		Description: "Buys a close above the N-bar Donchian high, exits on the M-bar low or an ATR trailing stop",
+		Params: []ParamSpec{
+			{Name: "entry_period", Type: ParamInt, Default: defaults.EntryPeriod, Min: 2, Max: 1000},
+			{Name: "exit_period", Type: ParamInt, Default: defaults.ExitPeriod, Min: 0, Max: 1000},
+			{Name: "confirm_volume", Type: ParamBool, Default: defaults.ConfirmVolume},
+			{Name: "volume_period", Type: ParamInt, Default: defaults.VolumePeriod, Min: 2, Max: 1000},
+			{Name: "volume_mult", Type: ParamFloat, Default: defaults.VolumeMult, Min: 0, Max: 100},
+			{Name: "atr_period", Type: ParamInt, Default: defaults.ATRPeriod, Min: 2, Max: 200},
+			{Name: "trail_atr_mult", Type: ParamFloat, Default: defaults.TrailATRMult, Min: 0, Max: 20},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			config := BreakoutConfig{
+				EntryPeriod:   p.Int("entry_period"),
+				ExitPeriod:    p.Int("exit_period"),
+				ConfirmVolume: p.Bool("confirm_volume"),
+				VolumePeriod:  p.Int("volume_period"),
+				VolumeMult:    p.Float("volume_mult"),
+				ATRPeriod:     p.Int("atr_period"),
+				TrailATRMult:  p.Float("trail_atr_mult"),
+			}
+			if config.ExitPeriod == 0 && config.TrailATRMult == 0 {
+				return nil, fmt.Errorf("need an exit: set exit_period or trail_atr_mult")
+			}
+			return NewBreakoutStrategy(config), nil
+		},
+	})
+}
+
+/* ManagesExits is true, the exit channel and trailing stop exit at any price */
+func (s *BreakoutStrategy) ManagesExits() bool {
+	return true
+}
+
+func (s *BreakoutStrategy) state(symbol string) *breakoutState {
+	st, ok := s.states[symbol]
+	if !ok {
+		exitPeriod := s.config.ExitPeriod
+		if exitPeriod == 0 {
+			exitPeriod = 1
+		}
+		st = &breakoutState{
+			entry:  indicator.NewDonchian(s.config.EntryPeriod),
+			exit:   indicator.NewDonchian(exitPeriod),
+			volume: indicator.NewSMA(s.config.VolumePeriod),
+			atr:    indicator.NewATR(s.config.ATRPeriod),
+		}
+		s.states[symbol] = st
+	}
+	return st
+}
+
+/* breakoutTrade is the persisted part of an open breakout trade */
+type breakoutTrade struct {
+	HighClose float64 `json:"high_close"`
+	TrailStop float64 `json:"trail_stop"`
+}
+
+/*
+*  MarshalState snapshots open trades with their trailing stops.
+*  The channels and ATR warm up again.
+ */
+func (s *BreakoutStrategy) MarshalState() ([]byte, error) {
+	trades := make(map[string]breakoutTrade)
+	for symbol, st := range s.states {
+		if st.inTrade {
+			trades[symbol] = breakoutTrade{HighClose: st.highClose, TrailStop: st.trailStop}
+		}
+	}
+	return json.Marshal(trades)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *BreakoutStrategy) UnmarshalState(data []byte) error {
+	var trades map[string]breakoutTrade
+	if err := json.Unmarshal(data, &trades); err != nil {
+		return err
+	}
+	for symbol, trade := range trades {
+		st := s.state(symbol)
+		st.inTrade, st.highClose, st.trailStop = true, trade.HighClose, trade.TrailStop
+	}
+	return nil
+}
+
+/*
+* Analyze market data
+ */
+func (s *BreakoutStrategy) Analyze(data *models.MarketData) *models.Signal {
+	st := s.state(data.Symbol)
+	high, low := data.HighLow()
+
+	/* The open position decides whether it is in a trade: a skipped buy
+	*  never opens one, the bot's stop-loss closes it. The trailing stop
+	*  set by the entry carries over once the buy filled.
+	 */
+	switch {
+	case data.Position == nil:
+		st.inTrade, st.highClose, st.trailStop = false, 0, 0
+	case !st.inTrade:
+		st.inTrade = true
+		if st.highClose == 0 {
+			st.highClose = data.Position.AverageCost
+		}
+	}
+
+	/* Channels and volume average of the bars before this one */
+	channelHigh := st.entry.Upper()
+	channelLow := st.exit.Lower()
+	entryReady := st.entry.Ready()
+	exitReady := st.exit.Ready()
+	avgVolume := st.volume.Value()
+	volumeReady := st.volume.Ready()
+
+	st.entry.Update(high, low)
+	st.exit.Update(high, low)
+	st.volume.Update(data.Volume)
+	atr := st.atr.Update(high, low, data.Price)
+
+	if st.inTrade {
+		/* Ratchet the trailing stop up behind the highest close */
+		if s.config.TrailATRMult > 0 && st.atr.Ready() {
+			st.highClose = math.Max(st.highClose, data.Price)
+			st.trailStop = math.Max(st.trailStop, st.highClose-s.config.TrailATRMult*atr)
+		}
+
+		reason := ""
+		switch {
+		case s.config.ExitPeriod > 0 && exitReady && data.Price < channelLow:
+			reason = fmt.Sprintf("close below %d-bar low %.2f", s.config.ExitPeriod, channelLow)
+		case st.trailStop > 0 && data.Price < st.trailStop:
+			reason = fmt.Sprintf("close below ATR trailing stop %.2f", st.trailStop)
+		}
+		if reason == "" {
+			return nil
+		}
+
+		log.Infof("SELL SIGNAL - %s: %s", data.Symbol, reason)
+		signal := &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "SELL",
+			Price:      data.Price,
+			Timestamp:  data.Time,
+			Confidence: 1,
+			Reason:     reason,
+			Indicators: map[string]float64{"exit_low": channelLow, "trail_stop": st.trailStop, "atr": atr},
+		}
+		return signal
+	}
+
+	if !entryReady || data.Price <= channelHigh {
+		return nil
+	}
+
+	if s.config.ConfirmVolume && (!volumeReady || data.Volume < s.config.VolumeMult*avgVolume) {
+		log.Infof("%s breakout above %.2f skipped: volume %.2f below %.1fx average %.2f",
+			data.Symbol, channelHigh, data.Volume, s.config.VolumeMult, avgVolume)
+		return nil
+	}
+
+	st.highClose = data.Price
+	if s.config.TrailATRMult > 0 && st.atr.Ready() {
+		st.trailStop = data.Price - s.config.TrailATRMult*atr
+	}
+
+	/* Initial stop is the tighter of the exit channel and the ATR stop */
+	stopLoss := st.trailStop
+	if s.config.ExitPeriod > 0 && exitReady && channelLow < data.Price {
+		stopLoss = math.Max(stopLoss, channelLow)
+	}
+
+	/* Confidence grows with the size of the breakout relative to ATR */
+	confidence := 0.5
+	if atr > 0 {
+		confidence = math.Min(0.5+(data.Price-channelHigh)/atr/2, 1)
+	}
+	indicators := map[string]float64{"channel_high": channelHigh, "exit_low": channelLow, "atr": atr}
+	if s.config.ConfirmVolume {
+		indicators["volume"] = data.Volume
+		indicators["avg_volume"] = avgVolume
+	}
+
+	log.Infof("BUY SIGNAL - %s: close %.2f above %d-bar high %.2f (stop %.2f)",
+		data.Symbol, data.Price, s.config.EntryPeriod, channelHigh, stopLoss)
+	return &models.Signal{
+		Symbol:     data.Symbol,
+		Action:     "BUY",
+		Price:      data.Price,
+		Timestamp:  data.Time,
+		Confidence: confidence,
+		Reason:     fmt.Sprintf("close %.2f broke above %d-bar high %.2f", data.Price, s.config.EntryPeriod, channelHigh),
+		Indicators: indicators,
+		StopLoss:   stopLoss,
+	}
+}
@@ -0,0 +1,70 @@
+package strategy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBreakoutTrailingStop(t *testing.T) {
+	s, err := NewFromSpec("breakout{entry_period: 5, exit_period: 0, confirm_volume: false, atr_period: 3, trail_atr_mult: 1}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* A range up to 101.2, the break to 103, a run to 109 and the pull back */
+	signals := signalsOver(s, candleBars(100, 101, 100, 101, 100, 101, 103, 105, 107, 109, 106, 104))
+	if len(signals) != 2 {
+		t.Fatalf("Expected an entry and an exit, got %v", signals)
+	}
+
+	buy := signals[6]
+	if buy == nil || buy.Action != "BUY" || buy.Indicators["channel_high"] >= 103 {
+		t.Fatalf("Expected the breakout at 103 above the channel, got %+v", buy)
+	}
+	if buy.StopLoss <= 0 || buy.StopLoss >= 103 {
+		t.Errorf("Expected an ATR stop below 103, got %.4f", buy.StopLoss)
+	}
+
+	/* The stop trailed the run up, 106 closes below it */
+	sell := signals[10]
+	if sell == nil || sell.Action != "SELL" || !strings.Contains(sell.Reason, "trailing stop") {
+		t.Fatalf("Expected the trailing stop exit at 106, got %+v", sell)
+	}
+	if trail := sell.Indicators["trail_stop"]; trail <= buy.StopLoss || trail <= 106 {
+		t.Errorf("Expected the stop raised above 106 from %.4f, got %.4f", buy.StopLoss, trail)
+	}
+}
+
+func TestBreakoutNeedsVolume(t *testing.T) {
+	s, err := NewFromSpec("breakout{entry_period: 5, exit_period: 0, confirm_volume: true, volume_period: 5, volume_mult: 2}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bars := candleBars(100, 101, 100, 101, 100, 101, 103, 100, 101, 104)
+	bars[9].Volume = 3
+
+	/* The break to 103 has average volume, the one to 104 three times it */
+	signals := signalsOver(s, bars)
+	if len(signals) != 1 || signals[9] == nil || signals[9].Action != "BUY" {
+		t.Errorf("Expected only the breakout on volume to buy, got %v", signals)
+	}
+}
+
+func TestBreakoutFollowsThePosition(t *testing.T) {
+	s, err := NewFromSpec("breakout{entry_period: 5, exit_period: 0, confirm_volume: false, atr_period: 3, trail_atr_mult: 1}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* The bot skipped the break to 103: nothing to exit, the break to 105 buys again */
+	bars := candleBars(100, 101, 100, 101, 100, 101, 103, 105, 107, 109, 106, 104)
+	for i, bar := range bars {
+		signal := s.Analyze(bar)
+		if i == 7 && (signal == nil || signal.Action != "BUY") {
+			t.Errorf("Expected the break to 105 to buy, got %+v", signal)
+		}
+		if signal != nil && signal.Action == "SELL" {
+			t.Errorf("Unexpected exit without a position at bar %d: %+v", i, signal)
+		}
+	}
+}
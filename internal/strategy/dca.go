@@ -0,0 +1,220 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	DCAStrategy
+
+*  What is Dollar-Cost Averaging?
+*
+*  DCA buys a fixed quote amount on a schedule no matter the price,
+*  which averages the entry over time. "Smart DCA" buys more when
+*  the price is below its moving average. The buys accumulate into
+*  one position (Accumulator), the stack, and the strategy can take
+*  profit on the whole stack once price is far enough above its
+*  average cost, which the bot derives from the stack's trades.
+*/
+type DCAStrategy struct {
+	config DCAConfig
+	stacks map[string]*dcaStack
+}
+
+/*
+*  DCAConfig holds the schedule and sizing
+*  - Amount: quote amount (USDT) per scheduled buy
+*  - Interval: time between buys
+*  - Smart / MAPeriod / SmartMultiplier: buy Amount * SmartMultiplier
+*    when price is below the MAPeriod moving average
+*  - TakeProfit: sell the whole stack this % above cost basis (0 disables)
+ */
+type DCAConfig struct {
+	Amount          float64
+	Interval        time.Duration
+	Smart           bool
+	MAPeriod        int
+	SmartMultiplier float64
+	TakeProfit      float64
+}
+
+/* dcaStack is the schedule of a symbol and the position it last saw */
+type dcaStack struct {
+	ma       *indicator.SMA
+	lastBuy  time.Time
+	position *models.Position
+}
+
+func NewDCAStrategy(config DCAConfig) *DCAStrategy {
+	return &DCAStrategy{
+		config: config,
+		stacks: make(map[string]*dcaStack),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "dca",
+		Description: "Buys a fixed USDT amount on a schedule, optionally more below the moving average",
+		Params: []ParamSpec{
+			{Name: "amount", Type: ParamFloat, Default: 10.0, Min: 0, Max: 1e9, Description: "USDT per buy"},
+			{Name: "interval", Type: ParamString, Default: "daily", Description: "hourly, daily, weekly or a duration like 12h"},
+			{Name: "smart", Type: ParamBool, Default: false},
+			{Name: "ma_period", Type: ParamInt, Default: 50, Min: 2, Max: 10000},
+			{Name: "smart_multiplier", Type: ParamFloat, Default: 2.0, Min: 1, Max: 100},
+			{Name: "take_profit", Type: ParamFloat, Default: 0.0, Min: 0, Max: 10000, Description: "% above cost basis, 0 disables"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			interval, err := parseSchedule(p.String("interval"))
+			if err != nil {
+				return nil, err
+			}
+			if p.Float("amount") <= 0 {
+				return nil, fmt.Errorf("amount must be positive")
+			}
+			return NewDCAStrategy(DCAConfig{
+				Amount:          p.Float("amount"),
+				Interval:        interval,
+				Smart:           p.Bool("smart"),
+				MAPeriod:        p.Int("ma_period"),
+				SmartMultiplier: p.Float("smart_multiplier"),
+				TakeProfit:      p.Float("take_profit"),
+			}), nil
+		},
+	})
+}
+
+func parseSchedule(value string) (time.Duration, error) {
+	switch value {
+	case "hourly":
+		return time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("interval must be hourly, daily, weekly or a positive duration, got %q", value)
+	}
+	return d, nil
+}
+
+/* Accumulates adds every DCA buy to the open stack, which rests no stop */
+func (s *DCAStrategy) Accumulates() bool {
+	return true
+}
+
+func (s *DCAStrategy) stack(symbol string) *dcaStack {
+	st, ok := s.stacks[symbol]
+	if !ok {
+		st = &dcaStack{ma: indicator.NewSMA(s.config.MAPeriod)}
+		s.stacks[symbol] = st
+	}
+	return st
+}
+
+/*
+	CostBasis
+
+*  returns the accumulated quantity and average cost for a symbol, as
+*  of the last bar the bot handed it
+*/
+func (s *DCAStrategy) CostBasis(symbol string) (quantity float64, averageCost float64) {
+	if position := s.stack(symbol).position; position != nil {
+		return position.Quantity, position.AverageCost
+	}
+	return 0, 0
+}
+
+/*
+*  dcaStackState is the persisted part of a stack. The stack itself is
+*  in the trades table and the MA warms up again.
+ */
+type dcaStackState struct {
+	LastBuy time.Time `json:"last_buy"`
+}
+
+/* MarshalState snapshots the schedule of every stack */
+func (s *DCAStrategy) MarshalState() ([]byte, error) {
+	state := make(map[string]dcaStackState, len(s.stacks))
+	for symbol, st := range s.stacks {
+		state[symbol] = dcaStackState{LastBuy: st.lastBuy}
+	}
+	return json.Marshal(state)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *DCAStrategy) UnmarshalState(data []byte) error {
+	var state map[string]dcaStackState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for symbol, saved := range state {
+		s.stack(symbol).lastBuy = saved.LastBuy
+	}
+	return nil
+}
+
+/*
+* Analyze market data
+ */
+func (s *DCAStrategy) Analyze(data *models.MarketData) *models.Signal {
+	st := s.stack(data.Symbol)
+	ma := st.ma.Update(data.Price)
+	st.position = data.Position
+	quantity, avgCost := s.CostBasis(data.Symbol)
+
+	/* Take profit on the whole stack */
+	if s.config.TakeProfit > 0 && quantity > 0 && avgCost > 0 {
+		profit := (data.Price - avgCost) / avgCost * 100
+		if profit >= s.config.TakeProfit {
+			log.Infof("SELL SIGNAL - %s: DCA take profit on %.8f at %.2f (cost basis %.2f, +%.2f%%)",
+				data.Symbol, quantity, data.Price, avgCost, profit)
+			return &models.Signal{
+				Symbol:     data.Symbol,
+				Action:     "SELL",
+				Price:      data.Price,
+				Quantity:   quantity,
+				Timestamp:  data.Time,
+				Confidence: 1,
+				Reason:     fmt.Sprintf("DCA take profit: +%.2f%% over cost basis %.2f", profit, avgCost),
+				Indicators: map[string]float64{"cost_basis": avgCost, "stack": quantity, "ma": ma},
+			}
+		}
+	}
+
+	/* Scheduled buy */
+	if !st.lastBuy.IsZero() && data.Time.Sub(st.lastBuy) < s.config.Interval {
+		return nil
+	}
+
+	amount := s.config.Amount
+	reason := "scheduled DCA buy"
+	if s.config.Smart && st.ma.Ready() && data.Price < ma {
+		amount *= s.config.SmartMultiplier
+		reason = fmt.Sprintf("scheduled DCA buy, %.1fx below MA %.2f", s.config.SmartMultiplier, ma)
+	}
+
+	/* The schedule moves on whether or not the bot could buy, the stack only with its trades */
+	st.lastBuy = data.Time
+
+	log.Infof("BUY SIGNAL - %s: DCA buy %.2f USDT at %.2f (stack %.8f, cost basis %.2f)",
+		data.Symbol, amount, data.Price, quantity, avgCost)
+	/* No TakeProfit on the signal, the stack exit is managed above */
+	return &models.Signal{
+		Symbol:     data.Symbol,
+		Action:     "BUY",
+		Price:      data.Price,
+		Quantity:   amount / data.Price,
+		Timestamp:  data.Time,
+		Confidence: 1,
+		Reason:     reason,
+		Indicators: map[string]float64{"cost_basis": avgCost, "stack": quantity, "ma": ma},
+	}
+}
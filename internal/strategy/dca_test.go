@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestDCAStackFromPosition(t *testing.T) {
+	s, err := NewFromSpec("dca{amount: 100, interval: daily, take_profit: 10}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dca := s.(*DCAStrategy)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	buy := dca.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 100, Time: start})
+	if buy == nil || buy.Action != "BUY" || buy.Quantity != 1 {
+		t.Fatalf("Expected a buy of 1, got %+v", buy)
+	}
+	if signal := dca.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 100, Time: start.Add(time.Hour)}); signal != nil {
+		t.Fatalf("Unexpected signal before the next scheduled buy: %+v", signal)
+	}
+
+	/* The bot only bought half of it, the stack is what it traded */
+	position := &models.Position{ID: "dca", Quantity: 0.5, AverageCost: 100}
+	buy = dca.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 50, Time: start.Add(24 * time.Hour), Position: position})
+	if buy == nil || buy.Action != "BUY" || buy.Quantity != 2 {
+		t.Fatalf("Expected the next scheduled buy of 2, got %+v", buy)
+	}
+	if quantity, cost := dca.CostBasis("BTCUSDT"); quantity != 0.5 || cost != 100 {
+		t.Errorf("Expected a stack of 0.5 at 100, got %.8f at %.2f", quantity, cost)
+	}
+
+	/* 2.5 at an average cost of 60, 80 is over 10% above it */
+	position = &models.Position{ID: "dca", Quantity: 2.5, AverageCost: 60}
+	sell := dca.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 80, Time: start.Add(25 * time.Hour), Position: position})
+	if sell == nil || sell.Action != "SELL" || sell.Quantity != 2.5 {
+		t.Fatalf("Expected the whole stack of 2.5 sold, got %+v", sell)
+	}
+
+	/* Sold, the stack is gone with the position */
+	if signal := dca.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 80, Time: start.Add(26 * time.Hour)}); signal != nil {
+		t.Errorf("Unexpected signal without a stack: %+v", signal)
+	}
+	if quantity, _ := dca.CostBasis("BTCUSDT"); quantity != 0 {
+		t.Errorf("Expected an empty stack, got %.8f", quantity)
+	}
+
+	/* Only the schedule is saved, the stack is in the trades */
+	state, err := dca.MarshalState()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(state), "last_buy") || strings.Contains(string(state), "quantity") {
+		t.Errorf("Expected only the last buy in the state, got %s", state)
+	}
+}
@@ -0,0 +1,256 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	EMACrossStrategy
+
+*  What is a Moving Average Crossover Strategy?
+*
+*  A trend following strategy. It buys when the fast EMA crosses
+*  above the slow EMA (golden cross) and exits when it crosses back
+*  below (death cross). An optional ADX filter skips entries when
+*  the market isn't trending, and every buy carries an ATR based
+*  initial stop-loss. An optional higher timeframe filter only takes
+*  entries while the last closed candle of that interval is above
+*  its EMA (e.g. 1m crosses with the 1h trend).
+*
+*  Each call to Analyze is treated as one bar.
+*/
+type EMACrossStrategy struct {
+	config EMACrossConfig
+	states map[string]*emaCrossState
+}
+
+/*
+*  EMACrossConfig holds the tunable parameters
+*  - FastPeriod / SlowPeriod: EMA lengths
+*  - UseADX / ADXPeriod / ADXMin: optional trend strength filter
+*  - ATRPeriod / ATRStopMult: initial stop at close - mult * ATR (0 disables)
+*  - TrendInterval / TrendPeriod: higher timeframe EMA filter ("" disables)
+ */
+type EMACrossConfig struct {
+	FastPeriod  int
+	SlowPeriod  int
+	UseADX      bool
+	ADXPeriod   int
+	ADXMin      float64
+	ATRPeriod   int
+	ATRStopMult float64
+
+	TrendInterval string
+	TrendPeriod   int
+}
+
+type emaCrossState struct {
+	fast     *indicator.EMA
+	slow     *indicator.EMA
+	adx      *indicator.ADX
+	atr      *indicator.ATR
+	prevDiff float64
+	hasPrev  bool
+	inTrade  bool
+}
+
+func DefaultEMACrossConfig() EMACrossConfig {
+	return EMACrossConfig{
+		FastPeriod:  12,
+		SlowPeriod:  26,
+		UseADX:      false,
+		ADXPeriod:   14,
+		ADXMin:      25,
+		ATRPeriod:   14,
+		ATRStopMult: 2,
+		TrendPeriod: 50,
+	}
+}
+
+func NewEMACrossStrategy(config EMACrossConfig) *EMACrossStrategy {
+	return &EMACrossStrategy{
+		config: config,
+		states: make(map[string]*emaCrossState),
+	}
+}
+
+func init() {
+	defaults := DefaultEMACrossConfig()
+	Register(Definition{
+		Name:        "ema_cross",
+		Description: "Goes long on a fast/slow EMA golden cross, exits on the death cross",
+		Params: []ParamSpec{
+			{Name: "fast", Type: ParamInt, Default: defaults.FastPeriod, Min: 2, Max: 500},
+			{Name: "slow", Type: ParamInt, Default: defaults.SlowPeriod, Min: 3, Max: 1000},
+			{Name: "use_adx", Type: ParamBool, Default: defaults.UseADX},
+			{Name: "adx_period", Type: ParamInt, Default: defaults.ADXPeriod, Min: 2, Max: 200},
+			{Name: "adx_min", Type: ParamFloat, Default: defaults.ADXMin, Min: 0, Max: 100},
+			{Name: "atr_period", Type: ParamInt, Default: defaults.ATRPeriod, Min: 2, Max: 200},
+			{Name: "atr_stop_mult", Type: ParamFloat, Default: defaults.ATRStopMult, Min: 0, Max: 20},
+			{Name: "trend_interval", Type: ParamString, Default: defaults.TrendInterval, Description: "higher timeframe for the trend filter, e.g. 1h"},
+			{Name: "trend_period", Type: ParamInt, Default: defaults.TrendPeriod, Min: 2, Max: timeframe.DefaultLimit},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			config := EMACrossConfig{
+				FastPeriod:  p.Int("fast"),
+				SlowPeriod:  p.Int("slow"),
+				UseADX:      p.Bool("use_adx"),
+				ADXPeriod:   p.Int("adx_period"),
+				ADXMin:      p.Float("adx_min"),
+				ATRPeriod:   p.Int("atr_period"),
+				ATRStopMult: p.Float("atr_stop_mult"),
+
+				TrendInterval: p.String("trend_interval"),
+				TrendPeriod:   p.Int("trend_period"),
+			}
+			if config.FastPeriod >= config.SlowPeriod {
+				return nil, fmt.Errorf("fast (%d) must be below slow (%d)", config.FastPeriod, config.SlowPeriod)
+			}
+			if config.TrendInterval != "" {
+				if _, err := timeframe.ParseInterval(config.TrendInterval); err != nil {
+					return nil, fmt.Errorf("trend_interval: %v", err)
+				}
+			}
+			return NewEMACrossStrategy(config), nil
+		},
+	})
+}
+
+/* ManagesExits is true, a cross down exits at any price */
+func (s *EMACrossStrategy) ManagesExits() bool {
+	return true
+}
+
+/* Timeframes subscribes to the trend interval when the filter is on */
+func (s *EMACrossStrategy) Timeframes() []string {
+	if s.config.TrendInterval == "" {
+		return nil
+	}
+	return []string{s.config.TrendInterval}
+}
+
+/*
+	trend
+
+*  returns the last closed higher timeframe close and its EMA,
+*  ok is false until enough candles have closed
+*/
+func (s *EMACrossStrategy) trend(data *models.MarketData) (last float64, ema float64, ok bool) {
+	candles := data.Frame(s.config.TrendInterval)
+	if len(candles) < s.config.TrendPeriod {
+		return 0, 0, false
+	}
+	e := indicator.NewEMA(s.config.TrendPeriod)
+	for _, c := range candles {
+		ema = e.Update(c.Close)
+	}
+	return candles[len(candles)-1].Close, ema, true
+}
+
+func (s *EMACrossStrategy) state(symbol string) *emaCrossState {
+	st, ok := s.states[symbol]
+	if !ok {
+		st = &emaCrossState{
+			fast: indicator.NewEMA(s.config.FastPeriod),
+			slow: indicator.NewEMA(s.config.SlowPeriod),
+			adx:  indicator.NewADX(s.config.ADXPeriod),
+			atr:  indicator.NewATR(s.config.ATRPeriod),
+		}
+		s.states[symbol] = st
+	}
+	return st
+}
+
+/*
+* Analyze market data
+ */
+func (s *EMACrossStrategy) Analyze(data *models.MarketData) *models.Signal {
+	st := s.state(data.Symbol)
+	high, low := data.HighLow()
+
+	/* The open position decides whether it is in a trade: a skipped buy
+	*  never opens one, the bot's stop-loss closes it
+	 */
+	st.inTrade = data.Position != nil
+
+	fast := st.fast.Update(data.Price)
+	slow := st.slow.Update(data.Price)
+	adx := st.adx.Update(high, low, data.Price)
+	atr := st.atr.Update(high, low, data.Price)
+
+	if !st.slow.Ready() {
+		return nil
+	}
+
+	diff := fast - slow
+	prevDiff, hasPrev := st.prevDiff, st.hasPrev
+	st.prevDiff, st.hasPrev = diff, true
+	if !hasPrev {
+		return nil
+	}
+
+	/* Golden cross: fast EMA moves above slow EMA */
+	if prevDiff <= 0 && diff > 0 && !st.inTrade {
+		if s.config.UseADX && (!st.adx.Ready() || adx < s.config.ADXMin) {
+			log.Infof("%s golden cross skipped: ADX %.2f below %.2f", data.Symbol, adx, s.config.ADXMin)
+			return nil
+		}
+		trendClose, trendEMA := 0.0, 0.0
+		if s.config.TrendInterval != "" {
+			var ok bool
+			trendClose, trendEMA, ok = s.trend(data)
+			if !ok || trendClose <= trendEMA {
+				log.Infof("%s golden cross skipped: %s trend close %.2f not above EMA%d %.2f",
+					data.Symbol, s.config.TrendInterval, trendClose, s.config.TrendPeriod, trendEMA)
+				return nil
+			}
+		}
+
+		/* Confidence follows trend strength when ADX is available */
+		confidence := 0.5
+		if st.adx.Ready() {
+			confidence = math.Min(adx/50, 1)
+		}
+		signal := &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "BUY",
+			Price:      data.Price,
+			Timestamp:  data.Time,
+			Confidence: confidence,
+			Reason:     fmt.Sprintf("golden cross: EMA%d %.2f above EMA%d %.2f", s.config.FastPeriod, fast, s.config.SlowPeriod, slow),
+			Indicators: map[string]float64{"ema_fast": fast, "ema_slow": slow, "adx": adx, "atr": atr},
+		}
+		if s.config.TrendInterval != "" {
+			signal.Indicators["trend_close"] = trendClose
+			signal.Indicators["trend_ema"] = trendEMA
+		}
+		if s.config.ATRStopMult > 0 && st.atr.Ready() {
+			signal.StopLoss = data.Price - s.config.ATRStopMult*atr
+		}
+
+		log.Infof("BUY SIGNAL - %s: golden cross (fast %.2f > slow %.2f, ADX %.2f, stop %.2f)",
+			data.Symbol, fast, slow, adx, signal.StopLoss)
+		return signal
+	}
+
+	/* Death cross: fast EMA moves back below slow EMA */
+	if prevDiff >= 0 && diff < 0 && st.inTrade {
+		log.Infof("SELL SIGNAL - %s: death cross (fast %.2f < slow %.2f)", data.Symbol, fast, slow)
+		return &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "SELL",
+			Price:      data.Price,
+			Timestamp:  data.Time,
+			Confidence: 1,
+			Reason:     fmt.Sprintf("death cross: EMA%d %.2f below EMA%d %.2f", s.config.FastPeriod, fast, s.config.SlowPeriod, slow),
+			Indicators: map[string]float64{"ema_fast": fast, "ema_slow": slow, "adx": adx, "atr": atr},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* candleBars turns closes into one minute candles with a 0.2% range around the close */
+func candleBars(closes ...float64) []*models.MarketData {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]*models.MarketData, len(closes))
+	for i, close := range closes {
+		bars[i] = &models.MarketData{
+			Symbol: "BTCUSDT",
+			Price:  close,
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Open:   close,
+			High:   close * 1.002,
+			Low:    close * 0.998,
+			Volume: 1,
+		}
+	}
+	return bars
+}
+
+/*
+*  signalsOver runs the bars through a strategy and returns its signals
+*  by bar. Like the bot, it holds a position from every BUY to the next
+*  SELL and hands it to the strategy with the bars in between.
+ */
+func signalsOver(s Strategy, bars []*models.MarketData) map[int]*models.Signal {
+	signals := make(map[int]*models.Signal)
+	var position *models.Position
+	for i, bar := range bars {
+		bar.Position = position
+		signal := s.Analyze(bar)
+		if signal == nil {
+			continue
+		}
+		signals[i] = signal
+		switch signal.Action {
+		case "BUY":
+			position = &models.Position{ID: "test", Quantity: 1, AverageCost: signal.Price}
+		case "SELL":
+			position = nil
+		}
+	}
+	return signals
+}
+
+/* crossBars drift down, turn up through the slow EMA, then fall back through it */
+func crossBars() []*models.MarketData {
+	var closes []float64
+	for i := 0; i < 10; i++ {
+		closes = append(closes, 100-0.5*float64(i))
+	}
+	return candleBars(append(closes, 96, 98, 100, 102, 104, 106, 103, 100, 97, 94)...)
+}
+
+func TestEMACrossCrossovers(t *testing.T) {
+	s, err := NewFromSpec("ema_cross{fast: 3, slow: 6, atr_period: 3}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signals := signalsOver(s, crossBars())
+	if len(signals) != 2 {
+		t.Fatalf("Expected a golden and a death cross, got %d signals", len(signals))
+	}
+
+	buy, sell := signals[11], signals[18]
+	if buy == nil || buy.Action != "BUY" {
+		t.Fatalf("Expected the golden cross at 98, got %v", signals)
+	}
+	if buy.StopLoss <= 0 || buy.StopLoss >= buy.Price {
+		t.Errorf("Expected an ATR stop below 98, got %.4f", buy.StopLoss)
+	}
+	if sell == nil || sell.Action != "SELL" {
+		t.Fatalf("Expected the death cross at 97, got %v", signals)
+	}
+}
+
+func TestEMACrossADXFilter(t *testing.T) {
+	/* The turn comes with an ADX of about 70 */
+	for _, c := range []struct {
+		spec string
+		buys bool
+	}{
+		{"ema_cross{fast: 3, slow: 6, use_adx: true, adx_period: 3, adx_min: 20}", true},
+		{"ema_cross{fast: 3, slow: 6, use_adx: true, adx_period: 3, adx_min: 90}", false},
+		{"ema_cross{fast: 3, slow: 6, use_adx: true, adx_period: 50, adx_min: 20}", false},
+	} {
+		s, err := NewFromSpec(c.spec)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		signals := signalsOver(s, crossBars())
+		if buy := signals[11]; (buy != nil) != c.buys {
+			t.Errorf("%s: expected a buy %v, got %+v", c.spec, c.buys, buy)
+		}
+		if !c.buys && len(signals) != 0 {
+			t.Errorf("%s: expected no death cross without an entry, got %v", c.spec, signals)
+		}
+	}
+}
+
+func TestEMACrossFollowsThePosition(t *testing.T) {
+	s, err := NewFromSpec("ema_cross{fast: 3, slow: 6, atr_period: 3}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* The bot never filled the golden cross: no exit, and the next cross buys again */
+	bars := append(crossBars(), candleBars(96, 99, 102, 105)...)
+	signals := make(map[int]*models.Signal)
+	for i, bar := range bars {
+		if signal := s.Analyze(bar); signal != nil {
+			signals[i] = signal
+		}
+	}
+	if len(signals) != 2 || signals[11] == nil || signals[11].Action != "BUY" {
+		t.Fatalf("Expected the golden cross at 98 and no death cross, got %v", signals)
+	}
+	for i, signal := range signals {
+		if i != 11 && signal.Action != "BUY" {
+			t.Errorf("Expected a second golden cross, got %+v at bar %d", signal, i)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	EnsembleStrategy
+
+*  What is an Ensemble Strategy?
+*
+*  A composite strategy that runs several child strategies on the
+*  same data and combines what they say. Every child sees every bar.
+*
+*  A child's vote is its most recent signal: BUY counts as +1 and
+*  SELL as -1 until the child says something else (or until Hold
+*  bars have passed, when Hold is set). Modes:
+*  - unanimous: every child votes the same way
+*  - majority: more than half of the children vote the same way
+*  - weighted: the weighted average vote reaches +/- Threshold
+*  - veto: the first child trades, the other children are filters
+*    and its BUY only goes through while every filter votes BUY.
+*    Exits are never vetoed.
+*
+*  In the voting modes a signal is emitted when the combined
+*  decision changes, so a standing majority doesn't re-buy every bar.
+*/
+type EnsembleStrategy struct {
+	mode      string
+	threshold float64
+	hold      int
+	members   []ensembleMember
+	states    map[string]*ensembleState
+}
+
+const (
+	EnsembleUnanimous = "unanimous"
+	EnsembleMajority  = "majority"
+	EnsembleWeighted  = "weighted"
+	EnsembleVeto      = "veto"
+)
+
+type ensembleMember struct {
+	name     string
+	strategy Strategy
+	weight   float64
+	stats    Contribution
+}
+
+type ensembleState struct {
+	bar      int
+	votes    []vote
+	decision string
+}
+
+type vote struct {
+	signal *models.Signal
+	bar    int
+}
+
+/*
+*  Contribution counts what a child strategy did inside an ensemble
+*  - Buys / Sells: signals the child produced
+*  - Agreed: ensemble signals the child voted for
+*  - Vetoed: primary entries this child blocked (veto mode)
+ */
+type Contribution struct {
+	Name   string
+	Weight float64
+	Buys   int
+	Sells  int
+	Agreed int
+	Vetoed int
+}
+
+/*
+*  ContributionReporter is implemented by composite strategies
+*  that can break their signals down per child
+ */
+type ContributionReporter interface {
+	Contributions() []Contribution
+}
+
+func NewEnsembleStrategy(mode string, threshold float64, hold int, children []Strategy, names []string, weights []float64) (*EnsembleStrategy, error) {
+	switch mode {
+	case EnsembleUnanimous, EnsembleMajority, EnsembleWeighted, EnsembleVeto:
+	default:
+		return nil, fmt.Errorf("mode must be unanimous, majority, weighted or veto, got %q", mode)
+	}
+	if len(children) < 2 {
+		return nil, fmt.Errorf("an ensemble needs at least two members, got %d", len(children))
+	}
+	if weights != nil && len(weights) != len(children) {
+		return nil, fmt.Errorf("got %d weights for %d members", len(weights), len(children))
+	}
+
+	/*
+	* A sized strategy (grid, DCA) tracks the orders it asked for and
+	* the position they build, which a vote would drop or merge
+	 */
+	for i, child := range children {
+		if Accumulates(child) {
+			return nil, fmt.Errorf("member %d (%s) sizes its own orders and can't be an ensemble member", i+1, names[i])
+		}
+	}
+
+	members := make([]ensembleMember, len(children))
+	for i, child := range children {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		members[i] = ensembleMember{
+			name:     names[i],
+			strategy: child,
+			weight:   weight,
+			stats:    Contribution{Name: names[i], Weight: weight},
+		}
+	}
+	return &EnsembleStrategy{
+		mode:      mode,
+		threshold: threshold,
+		hold:      hold,
+		members:   members,
+		states:    make(map[string]*ensembleState),
+	}, nil
+}
+
+func init() {
+	Register(Definition{
+		Name:        "ensemble",
+		Description: "Combines child strategies by unanimous, majority or weighted vote, or lets filters veto entries",
+		Params: []ParamSpec{
+			{Name: "members", Type: ParamString, Default: "", Description: "child specs, e.g. [mean_reversion, ema_cross{fast: 9}]"},
+			{Name: "mode", Type: ParamString, Default: EnsembleMajority, Description: "unanimous, majority, weighted or veto"},
+			{Name: "weights", Type: ParamString, Default: "", Description: "comma separated, one per member (weighted mode)"},
+			{Name: "threshold", Type: ParamFloat, Default: 0.5, Min: 0, Max: 1, Description: "weighted score needed to act"},
+			{Name: "hold", Type: ParamInt, Default: 0, Min: 0, Max: 1000000, Description: "bars a vote stays valid, 0 = until the next signal"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			specs, err := ParseSpecList(p.String("members"))
+			if err != nil {
+				return nil, fmt.Errorf("members: %v", err)
+			}
+			children := make([]Strategy, len(specs))
+			names := make([]string, len(specs))
+			for i, spec := range specs {
+				child, err := New(spec.Name, spec.Params)
+				if err != nil {
+					return nil, fmt.Errorf("member %d: %v", i+1, err)
+				}
+				children[i] = child
+				names[i] = spec.String()
+			}
+
+			var weights []float64
+			if raw := strings.TrimSpace(p.String("weights")); raw != "" {
+				for _, w := range strings.Split(strings.Trim(raw, "[]"), ",") {
+					weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+					if err != nil || weight < 0 {
+						return nil, fmt.Errorf("weights: invalid weight %q", w)
+					}
+					weights = append(weights, weight)
+				}
+			}
+			return NewEnsembleStrategy(p.String("mode"), p.Float("threshold"), p.Int("hold"), children, names, weights)
+		},
+	})
+}
+
+/* Children returns the wrapped strategies */
+func (e *EnsembleStrategy) Children() []Strategy {
+	children := make([]Strategy, len(e.members))
+	for i, m := range e.members {
+		children[i] = m.strategy
+	}
+	return children
+}
+
+/* Contributions returns per-child signal statistics */
+func (e *EnsembleStrategy) Contributions() []Contribution {
+	stats := make([]Contribution, len(e.members))
+	for i, m := range e.members {
+		stats[i] = m.stats
+	}
+	return stats
+}
+
+/* ensembleSnapshot holds the children's state and the standing decisions */
+type ensembleSnapshot struct {
+	Members   []json.RawMessage `json:"members"`
+	Decisions map[string]string `json:"decisions"`
+}
+
+/* MarshalState snapshots every stateful child and the current decisions */
+func (e *EnsembleStrategy) MarshalState() ([]byte, error) {
+	members, err := marshalChildren(e.Children())
+	if err != nil {
+		return nil, err
+	}
+	decisions := make(map[string]string)
+	for symbol, st := range e.states {
+		decisions[symbol] = st.decision
+	}
+	return json.Marshal(ensembleSnapshot{Members: members, Decisions: decisions})
+}
+
+/*
+*  UnmarshalState restores a snapshot taken by MarshalState.
+*  Votes are not kept, children vote again as they see new bars.
+ */
+func (e *EnsembleStrategy) UnmarshalState(data []byte) error {
+	var snapshot ensembleSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if err := unmarshalChildren(e.Children(), snapshot.Members); err != nil {
+		return err
+	}
+	for symbol, decision := range snapshot.Decisions {
+		e.state(symbol).decision = decision
+	}
+	return nil
+}
+
+func (e *EnsembleStrategy) state(symbol string) *ensembleState {
+	st, ok := e.states[symbol]
+	if !ok {
+		st = &ensembleState{votes: make([]vote, len(e.members))}
+		e.states[symbol] = st
+	}
+	return st
+}
+
+/*
+* Analyze market data
+ */
+func (e *EnsembleStrategy) Analyze(data *models.MarketData) *models.Signal {
+	st := e.state(data.Symbol)
+	st.bar++
+
+	/* Every child sees every bar so its indicators stay current */
+	fresh := make([]*models.Signal, len(e.members))
+	for i := range e.members {
+		m := &e.members[i]
+		signal := Analyze(m.strategy, data)
+		fresh[i] = signal
+		if signal == nil {
+			continue
+		}
+		st.votes[i] = vote{signal: signal, bar: st.bar}
+		switch signal.Action {
+		case "BUY":
+			m.stats.Buys++
+		case "SELL":
+			m.stats.Sells++
+		}
+	}
+
+	if e.mode == EnsembleVeto {
+		return e.veto(data, st, fresh[0])
+	}
+	return e.combine(data, st)
+}
+
+/* current returns the standing vote of member i, nil when it has expired */
+func (e *EnsembleStrategy) current(st *ensembleState, i int) *models.Signal {
+	v := st.votes[i]
+	if v.signal == nil || (e.hold > 0 && st.bar-v.bar >= e.hold) {
+		return nil
+	}
+	return v.signal
+}
+
+func (e *EnsembleStrategy) veto(data *models.MarketData, st *ensembleState, primary *models.Signal) *models.Signal {
+	if primary == nil {
+		return nil
+	}
+	if primary.Action == "BUY" {
+		for i := 1; i < len(e.members); i++ {
+			if v := e.current(st, i); v == nil || v.Action != "BUY" {
+				e.members[i].stats.Vetoed++
+				log.Infof("%s BUY from %s vetoed by %s", data.Symbol, e.members[0].name, e.members[i].name)
+				return nil
+			}
+		}
+	}
+
+	for i := range e.members {
+		if v := e.current(st, i); v != nil && v.Action == primary.Action {
+			e.members[i].stats.Agreed++
+		}
+	}
+	return primary
+}
+
+func (e *EnsembleStrategy) combine(data *models.MarketData, st *ensembleState) *models.Signal {
+	var buyWeight, sellWeight, totalWeight float64
+	buys, sells := 0, 0
+	for i, m := range e.members {
+		totalWeight += m.weight
+		v := e.current(st, i)
+		if v == nil {
+			continue
+		}
+		switch v.Action {
+		case "BUY":
+			buys++
+			buyWeight += m.weight
+		case "SELL":
+			sells++
+			sellWeight += m.weight
+		}
+	}
+
+	decision := ""
+	n := len(e.members)
+	switch e.mode {
+	case EnsembleUnanimous:
+		if buys == n {
+			decision = "BUY"
+		} else if sells == n {
+			decision = "SELL"
+		}
+	case EnsembleMajority:
+		if 2*buys > n {
+			decision = "BUY"
+		} else if 2*sells > n {
+			decision = "SELL"
+		}
+	case EnsembleWeighted:
+		score := 0.0
+		if totalWeight > 0 {
+			score = (buyWeight - sellWeight) / totalWeight
+		}
+		if score >= e.threshold && score > 0 {
+			decision = "BUY"
+		} else if score <= -e.threshold && score < 0 {
+			decision = "SELL"
+		}
+	}
+
+	previous := st.decision
+	st.decision = decision
+	if decision == "" || decision == previous {
+		return nil
+	}
+
+	signal := &models.Signal{
+		Symbol:     data.Symbol,
+		Action:     decision,
+		Price:      data.Price,
+		Timestamp:  data.Time,
+		Indicators: make(map[string]float64),
+	}
+	/* The decision manages its exits only when every child behind it does */
+	signal.ManagesExits = true
+	var agreeing []string
+	for i := range e.members {
+		v := e.current(st, i)
+		if v == nil || v.Action != decision {
+			continue
+		}
+		e.members[i].stats.Agreed++
+		agreeing = append(agreeing, e.members[i].name)
+		signal.ManagesExits = signal.ManagesExits && v.ManagesExits
+
+		/* Keep the tightest stop and the nearest target any agreeing child suggested */
+		if decision == "BUY" && v.StopLoss > 0 && v.StopLoss < data.Price {
+			signal.StopLoss = math.Max(signal.StopLoss, v.StopLoss)
+		}
+		if decision == "BUY" && v.TakeProfit > data.Price && (signal.TakeProfit == 0 || v.TakeProfit < signal.TakeProfit) {
+			signal.TakeProfit = v.TakeProfit
+		}
+		for name, value := range v.Indicators {
+			signal.Indicators[fmt.Sprintf("%d.%s", i+1, name)] = value
+		}
+	}
+
+	/* Confidence is the share of weight behind the decision */
+	if totalWeight > 0 {
+		if decision == "BUY" {
+			signal.Confidence = buyWeight / totalWeight
+		} else {
+			signal.Confidence = sellWeight / totalWeight
+		}
+	}
+	signal.Reason = fmt.Sprintf("ensemble %s: %d buy / %d sell of %d (%s)",
+		e.mode, buys, sells, n, strings.Join(agreeing, ", "))
+
+	log.Infof("%s SIGNAL - %s: ensemble %s (%d buy / %d sell of %d)",
+		decision, data.Symbol, e.mode, buys, sells, n)
+	return signal
+}
@@ -0,0 +1,93 @@
+package strategy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* scriptedStub signals on the bars it was told to, with an optional stop */
+type scriptedStub struct {
+	bar     int
+	actions map[int]string
+	stop    float64
+}
+
+func (s *scriptedStub) Analyze(data *models.MarketData) *models.Signal {
+	s.bar++
+	action, ok := s.actions[s.bar]
+	if !ok {
+		return nil
+	}
+	return &models.Signal{Symbol: data.Symbol, Action: action, Price: data.Price, StopLoss: s.stop}
+}
+
+func TestEnsembleMajority(t *testing.T) {
+	a := &scriptedStub{actions: map[int]string{1: "BUY", 4: "SELL"}, stop: 95}
+	b := &scriptedStub{actions: map[int]string{2: "BUY"}, stop: 97}
+	c := &scriptedStub{actions: map[int]string{4: "SELL"}}
+	e, err := NewEnsembleStrategy(EnsembleMajority, 0.5, 0, []Strategy{a, b, c}, []string{"a", "b", "c"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var signals []*models.Signal
+	for i := 0; i < 4; i++ {
+		signals = append(signals, e.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 100}))
+	}
+
+	/* One BUY is no majority, the second is; it stands without re-buying */
+	if signals[0] != nil {
+		t.Errorf("Unexpected signal from one vote of three: %+v", signals[0])
+	}
+	if buy := signals[1]; buy == nil || buy.Action != "BUY" || buy.StopLoss != 97 {
+		t.Fatalf("Expected a BUY with the tightest stop 97, got %+v", buy)
+	}
+	if signals[2] != nil {
+		t.Errorf("Unexpected signal from a standing decision: %+v", signals[2])
+	}
+	if sell := signals[3]; sell == nil || sell.Action != "SELL" || !strings.Contains(sell.Reason, "a, c") {
+		t.Fatalf("Expected a SELL from a and c, got %+v", sell)
+	}
+
+	stats := e.Contributions()
+	if stats[0].Agreed != 2 || stats[1].Agreed != 1 || stats[2].Agreed != 1 {
+		t.Errorf("Unexpected contributions: %+v", stats)
+	}
+}
+
+func TestEnsembleVeto(t *testing.T) {
+	primary := &scriptedStub{actions: map[int]string{1: "BUY", 2: "BUY", 3: "SELL"}}
+	filter := &scriptedStub{actions: map[int]string{1: "SELL", 2: "BUY", 3: "SELL"}}
+	e, err := NewEnsembleStrategy(EnsembleVeto, 0.5, 0, []Strategy{primary, filter}, []string{"primary", "filter"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bar := &models.MarketData{Symbol: "BTCUSDT", Price: 100}
+	if signal := e.Analyze(bar); signal != nil {
+		t.Errorf("Expected the BUY vetoed while the filter votes SELL, got %+v", signal)
+	}
+	if signal := e.Analyze(bar); signal == nil || signal.Action != "BUY" {
+		t.Errorf("Expected the BUY through once the filter votes BUY, got %+v", signal)
+	}
+	if signal := e.Analyze(bar); signal == nil || signal.Action != "SELL" {
+		t.Errorf("Expected the exit never vetoed, got %+v", signal)
+	}
+	if vetoed := e.Contributions()[1].Vetoed; vetoed != 1 {
+		t.Errorf("Expected 1 vetoed entry, got %d", vetoed)
+	}
+}
+
+func TestEnsembleRejectsSizedMembers(t *testing.T) {
+	for _, spec := range []string{
+		"ensemble{members: [grid{lower: 90, upper: 110}, ema_cross]}",
+		"ensemble{members: [mean_reversion, dca], mode: veto}",
+		"ensemble{members: [mean_reversion, guard{strategy: dca, max_atr_pct: 5}]}",
+	} {
+		if _, err := NewFromSpec(spec); err == nil || !strings.Contains(err.Error(), "sizes its own orders") {
+			t.Errorf("%s: expected a sized member to be rejected, got %v", spec, err)
+		}
+	}
+}
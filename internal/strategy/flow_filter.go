@@ -0,0 +1,168 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/orderbook"
+)
+
+/*
+	FlowFilterStrategy
+
+*  What is a Flow Filter?
+*
+*  A wrapper that keeps another strategy from buying into a wall of
+*  selling. When the wrapped strategy wants to buy while sell
+*  pressure dominates, i.e. aggressive sellers make up sell_pressure
+*  of the flow or the book leans to the asks past book_imbalance,
+*  the buy is held back. It goes through at the then current price
+*  once the pressure eases, or is dropped after max_wait observations.
+*
+*  Sells always pass. Without order book data every signal passes,
+*  so the wrapped strategy backtests on candles as before.
+*/
+type FlowFilterStrategy struct {
+	strategy     Strategy
+	levels       int
+	sellPressure float64
+	bookLimit    float64
+	minTrades    int
+	maxWait      int
+	pending      map[string]*pendingBuy
+}
+
+type pendingBuy struct {
+	signal *models.Signal
+	waited int
+}
+
+func NewFlowFilterStrategy(strategy Strategy, levels int, sellPressure, bookLimit float64, minTrades, maxWait int) *FlowFilterStrategy {
+	return &FlowFilterStrategy{
+		strategy:     strategy,
+		levels:       levels,
+		sellPressure: sellPressure,
+		bookLimit:    bookLimit,
+		minTrades:    minTrades,
+		maxWait:      maxWait,
+		pending:      make(map[string]*pendingBuy),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "flow_filter",
+		Description: "Delays another strategy's buys while sell pressure dominates the order flow",
+		Params: []ParamSpec{
+			{Name: "strategy", Type: ParamString, Default: "mean_reversion", Description: "strategy spec to filter"},
+			{Name: "levels", Type: ParamInt, Default: 10, Min: 1, Max: 20, Description: "book levels of the depth imbalance"},
+			{Name: "sell_pressure", Type: ParamFloat, Default: 0.6, Min: 0.5, Max: 1, Description: "share of aggressive selling that holds buys back"},
+			{Name: "book_imbalance", Type: ParamFloat, Default: -0.3, Min: -1, Max: 0, Description: "depth imbalance at or below which buys are held back"},
+			{Name: "min_trades", Type: ParamInt, Default: 10, Min: 0, Max: 100000, Description: "trades in the flow window for a flow reading"},
+			{Name: "max_wait", Type: ParamInt, Default: 30, Min: 0, Max: 100000, Description: "observations a held back buy waits before it is dropped"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			child, err := NewFromSpec(p.String("strategy"))
+			if err != nil {
+				return nil, fmt.Errorf("strategy: %v", err)
+			}
+			return NewFlowFilterStrategy(child, p.Int("levels"), p.Float("sell_pressure"),
+				p.Float("book_imbalance"), p.Int("min_trades"), p.Int("max_wait")), nil
+		},
+	})
+}
+
+/* Children returns the filtered strategy */
+func (f *FlowFilterStrategy) Children() []Strategy {
+	return []Strategy{f.strategy}
+}
+
+/* BookLevels returns the depth the filter reads */
+func (f *FlowFilterStrategy) BookLevels() int {
+	return f.levels
+}
+
+/* pressure explains why buying should wait, "" when it needn't */
+func (f *FlowFilterStrategy) pressure(data *models.MarketData) string {
+	if data.Book == nil || data.Flow == nil {
+		return ""
+	}
+	if data.Flow.Trades >= f.minTrades && 1-data.Flow.BuyRatio() >= f.sellPressure {
+		return fmt.Sprintf("%.0f%% of flow selling", (1-data.Flow.BuyRatio())*100)
+	}
+	if imbalance := orderbook.Imbalance(data.Book, f.levels); len(data.Book.Bids) > 0 && imbalance <= f.bookLimit {
+		return fmt.Sprintf("book imbalance %.2f", imbalance)
+	}
+	return ""
+}
+
+/*
+* Analyze market data
+ */
+func (f *FlowFilterStrategy) Analyze(data *models.MarketData) *models.Signal {
+	signal := Analyze(f.strategy, data)
+	pressure := f.pressure(data)
+
+	if signal != nil && signal.Action == "SELL" {
+		if _, ok := f.pending[data.Symbol]; ok {
+			delete(f.pending, data.Symbol)
+			log.Infof("%s held back buy cancelled by a sell", data.Symbol)
+		}
+		return signal
+	}
+
+	if signal != nil && signal.Action == "BUY" {
+		if pressure == "" {
+			return signal
+		}
+		f.pending[data.Symbol] = &pendingBuy{signal: signal}
+		log.Infof("%s buy held back: %s (%s)", data.Symbol, pressure, signal.Reason)
+		return nil
+	}
+
+	held, ok := f.pending[data.Symbol]
+	if !ok {
+		return signal
+	}
+	held.waited++
+	if pressure != "" {
+		if held.waited >= f.maxWait {
+			delete(f.pending, data.Symbol)
+			log.Infof("%s held back buy dropped after %d observations: %s", data.Symbol, held.waited, pressure)
+		}
+		return signal
+	}
+
+	/* Pressure eased, buy now at the current price */
+	delete(f.pending, data.Symbol)
+	buy := *held.signal
+	buy.Price, buy.Timestamp = data.Price, data.Time
+	if buy.StopLoss >= data.Price {
+		buy.StopLoss = 0
+	}
+	if buy.TakeProfit <= data.Price {
+		buy.TakeProfit = 0
+	}
+	buy.Reason = fmt.Sprintf("%s (held back %d observations by sell pressure)", buy.Reason, held.waited)
+	log.Infof("BUY SIGNAL - %s: %s", data.Symbol, buy.Reason)
+	return &buy
+}
+
+/* MarshalState snapshots the filtered strategy, held back buys are short-lived and not kept */
+func (f *FlowFilterStrategy) MarshalState() ([]byte, error) {
+	members, err := marshalChildren(f.Children())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (f *FlowFilterStrategy) UnmarshalState(data []byte) error {
+	var members []json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	return unmarshalChildren(f.Children(), members)
+}
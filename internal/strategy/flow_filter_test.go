@@ -0,0 +1,75 @@
+package strategy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestFlowFilterHoldsBuysBack(t *testing.T) {
+	child := &scriptedStub{actions: map[int]string{1: "BUY"}, stop: 95}
+	f := NewFlowFilterStrategy(child, 10, 0.6, -0.3, 10, 3)
+
+	/* 80% of the flow selling holds the buy back while it lasts */
+	if signal := f.Analyze(flowBar(100, 1, 1, 2, 8, 20)); signal != nil {
+		t.Fatalf("Expected the buy held back, got %+v", signal)
+	}
+	if signal := f.Analyze(flowBar(99, 1, 1, 2, 8, 20)); signal != nil {
+		t.Fatalf("Expected the buy still held back, got %+v", signal)
+	}
+
+	/* Eased, it buys at the current price */
+	buy := f.Analyze(flowBar(98, 1, 1, 5, 5, 20))
+	if buy == nil || buy.Action != "BUY" || buy.Price != 98 || buy.StopLoss != 95 {
+		t.Fatalf("Expected the held back buy at 98 with its stop, got %+v", buy)
+	}
+	if !strings.Contains(buy.Reason, "held back 2 observations") {
+		t.Errorf("Expected the wait in the reason, got %q", buy.Reason)
+	}
+	if signal := f.Analyze(flowBar(98, 1, 1, 5, 5, 20)); signal != nil {
+		t.Errorf("Unexpected signal after the held back buy went through: %+v", signal)
+	}
+}
+
+func TestFlowFilterDropsStaleBuys(t *testing.T) {
+	child := &scriptedStub{actions: map[int]string{1: "BUY", 6: "BUY"}, stop: 99}
+	f := NewFlowFilterStrategy(child, 10, 0.6, -0.3, 10, 3)
+
+	/* A book leaning to the asks holds it back, after 3 more observations it is dropped */
+	for i := 0; i < 4; i++ {
+		if signal := f.Analyze(flowBar(100, 1, 3, 5, 5, 20)); signal != nil {
+			t.Fatalf("Expected the buy held back, got %+v", signal)
+		}
+	}
+	if signal := f.Analyze(flowBar(100, 1, 1, 5, 5, 20)); signal != nil {
+		t.Fatalf("Expected the stale buy dropped, got %+v", signal)
+	}
+
+	/* Without pressure the next buy passes */
+	if buy := f.Analyze(flowBar(100, 1, 1, 5, 5, 20)); buy == nil || buy.Action != "BUY" {
+		t.Fatalf("Expected the buy through without pressure, got %+v", buy)
+	}
+}
+
+func TestFlowFilterPassesSellsAndCandles(t *testing.T) {
+	child := &scriptedStub{actions: map[int]string{1: "BUY", 2: "SELL", 3: "BUY"}}
+	f := NewFlowFilterStrategy(child, 10, 0.6, -0.3, 10, 3)
+
+	if signal := f.Analyze(flowBar(100, 1, 1, 2, 8, 20)); signal != nil {
+		t.Fatalf("Expected the buy held back, got %+v", signal)
+	}
+
+	/* The sell goes through and cancels the held back buy */
+	if sell := f.Analyze(flowBar(100, 1, 1, 2, 8, 20)); sell == nil || sell.Action != "SELL" {
+		t.Fatalf("Expected the sell through, got %+v", sell)
+	}
+	if len(f.pending) != 0 {
+		t.Errorf("Expected the held back buy cancelled by the sell")
+	}
+
+	/* Candles without a book pass every signal */
+	if buy := f.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 100}); buy == nil || buy.Action != "BUY" {
+		t.Errorf("Expected the buy through without a book, got %+v", buy)
+	}
+}
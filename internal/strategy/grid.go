@@ -0,0 +1,365 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	GridStrategy
+
+*  What is Grid Trading?
+*
+*  Grid trading splits a price range into levels. Each time the price
+*  falls through a level it buys a fixed amount, and that purchase is
+*  sold when the price rises through the next level up. When the sell
+*  fills, the level is re-armed for the next dip. It suits range-bound
+*  pairs and loses when price leaves the range for good.
+*
+*  Levels are evenly spaced (arithmetic) or share a constant ratio
+*  (geometric). A level only counts as filled once the bot reports the
+*  trade of its buy (Filled), a buy it skipped or clamped doesn't fill
+*  it or fills it in part. The buys form one position with a stop
+*  below the lowest level; when the position is gone, e.g. stopped
+*  out, every level is re-armed. The filled state of each level is
+*  persisted through a GridStore, so a restart resumes the same grid.
+*/
+type GridStrategy struct {
+	config  GridConfig
+	store   GridStore
+	mu      sync.Mutex
+	grids   map[string][]models.GridLevel
+	last    map[string]float64
+	pending map[string]gridOrder
+}
+
+/* gridOrder is a signal waiting for its trade: its side, levels and quantity */
+type gridOrder struct {
+	side     string
+	levels   []int
+	quantity float64
+}
+
+/*
+*  GridConfig holds the grid layout
+*  - Lower / Upper: price bounds of the grid
+*  - Levels: number of price levels including both bounds
+*  - Geometric: constant ratio between levels instead of constant distance
+*  - OrderSize: quote amount (USDT) bought at each level
+*  - StopPct: stop-loss of the buys, % below the lowest level
+ */
+type GridConfig struct {
+	Lower     float64
+	Upper     float64
+	Levels    int
+	Geometric bool
+	OrderSize float64
+	StopPct   float64
+}
+
+/* GridStore persists grid levels so a restart resumes the same grid */
+type GridStore interface {
+	LoadGrid(symbol string) ([]models.GridLevel, error)
+	SaveGrid(symbol string, levels []models.GridLevel) error
+}
+
+func NewGridStrategy(config GridConfig) *GridStrategy {
+	return &GridStrategy{
+		config:  config,
+		grids:   make(map[string][]models.GridLevel),
+		last:    make(map[string]float64),
+		pending: make(map[string]gridOrder),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "grid",
+		Description: "Buys at evenly or geometrically spaced levels and sells one level up",
+		Params: []ParamSpec{
+			{Name: "lower", Type: ParamFloat, Default: 0.0, Description: "Lowest grid price"},
+			{Name: "upper", Type: ParamFloat, Default: 0.0, Description: "Highest grid price"},
+			{Name: "levels", Type: ParamInt, Default: 10, Min: 2, Max: 500},
+			{Name: "spacing", Type: ParamString, Default: "arithmetic", Description: "arithmetic or geometric"},
+			{Name: "order_size", Type: ParamFloat, Default: 10.0, Min: 0, Max: 1e9, Description: "USDT per level"},
+			{Name: "stop_pct", Type: ParamFloat, Default: 1.0, Min: 0.01, Max: 99, Description: "stop-loss % below the lowest level"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			config := GridConfig{
+				Lower:     p.Float("lower"),
+				Upper:     p.Float("upper"),
+				Levels:    p.Int("levels"),
+				OrderSize: p.Float("order_size"),
+				StopPct:   p.Float("stop_pct"),
+			}
+			switch p.String("spacing") {
+			case "arithmetic":
+			case "geometric":
+				config.Geometric = true
+			default:
+				return nil, fmt.Errorf("spacing must be arithmetic or geometric, got %q", p.String("spacing"))
+			}
+			if config.Lower <= 0 || config.Upper <= config.Lower {
+				return nil, fmt.Errorf("need 0 < lower < upper, got lower %.8f upper %.8f", config.Lower, config.Upper)
+			}
+			if config.OrderSize <= 0 {
+				return nil, fmt.Errorf("order_size must be positive")
+			}
+			return NewGridStrategy(config), nil
+		},
+	})
+}
+
+/*
+	AttachGridStores
+
+*  connects every grid strategy in the map, including grids
+*  nested in composite strategies, to a persistent store
+*/
+func AttachGridStores(strategies map[string]Strategy, store GridStore) {
+	for _, s := range strategies {
+		Walk(s, func(s Strategy) {
+			if g, ok := s.(*GridStrategy); ok {
+				g.AttachStore(store)
+			}
+		})
+	}
+}
+
+/*
+	AttachStore
+
+*  sets the store used to load and save grid levels.
+*  Without a store the grid only lives in memory (e.g. backtests).
+*/
+func (g *GridStrategy) AttachStore(store GridStore) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.store = store
+	g.grids = make(map[string][]models.GridLevel)
+}
+
+/* Accumulates is true, the grid's buys form one position */
+func (g *GridStrategy) Accumulates() bool {
+	return true
+}
+
+/* StopLoss returns the stop of the grid's buys, below the lowest level */
+func (g *GridStrategy) StopLoss() float64 {
+	return g.config.Lower * (1 - g.config.StopPct/100)
+}
+
+/*
+	LevelPrices
+
+*  returns the price of every level, lowest first
+*/
+func (g *GridStrategy) LevelPrices() []float64 {
+	prices := make([]float64, g.config.Levels)
+	steps := float64(g.config.Levels - 1)
+	for i := range prices {
+		if g.config.Geometric {
+			ratio := math.Pow(g.config.Upper/g.config.Lower, 1/steps)
+			prices[i] = g.config.Lower * math.Pow(ratio, float64(i))
+		} else {
+			prices[i] = g.config.Lower + (g.config.Upper-g.config.Lower)*float64(i)/steps
+		}
+	}
+	return prices
+}
+
+/*
+*  grid loads the levels for a symbol from the store,
+*  or lays out a fresh grid when none is stored or the layout changed
+ */
+func (g *GridStrategy) grid(symbol string) []models.GridLevel {
+	if levels, ok := g.grids[symbol]; ok {
+		return levels
+	}
+
+	prices := g.LevelPrices()
+	if g.store != nil {
+		stored, err := g.store.LoadGrid(symbol)
+		if err != nil {
+			log.Errorf("%s: failed to load grid, starting fresh: %v", symbol, err)
+		} else if sameLayout(stored, prices) {
+			log.Infof("%s: resumed grid with %d filled levels", symbol, countFilled(stored))
+			g.grids[symbol] = stored
+			return stored
+		} else if len(stored) > 0 {
+			log.Warnf("%s: stored grid doesn't match configuration, starting fresh", symbol)
+		}
+	}
+
+	levels := make([]models.GridLevel, len(prices))
+	for i, price := range prices {
+		levels[i] = models.GridLevel{Symbol: symbol, Level: i, Price: price}
+	}
+	g.grids[symbol] = levels
+	g.save(symbol, levels)
+	return levels
+}
+
+func (g *GridStrategy) save(symbol string, levels []models.GridLevel) {
+	if g.store == nil {
+		return
+	}
+	if err := g.store.SaveGrid(symbol, levels); err != nil {
+		log.Errorf("%s: failed to save grid: %v", symbol, err)
+	}
+}
+
+/*
+	Filled
+
+*  applies the trade of the grid's last signal to its levels. A buy
+*  fills its levels, in part when the bot bought less than asked; a
+*  sell re-arms them. Any other sell came from the bot's exits, which
+*  sell the whole position, and re-arms every level.
+*/
+func (g *GridStrategy) Filled(trade models.Trade) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	levels, ok := g.grids[trade.Symbol]
+	if !ok {
+		return
+	}
+	order, isPending := g.pending[trade.Symbol]
+	delete(g.pending, trade.Symbol)
+
+	switch {
+	case isPending && order.side == "BUY" && trade.Side == "BUY":
+		share := math.Min(trade.Quantity/order.quantity, 1)
+		for _, i := range order.levels {
+			levels[i].Filled = true
+			levels[i].Quantity = g.config.OrderSize / levels[i].Price * share
+		}
+	case isPending && order.side == "SELL" && trade.Side == "SELL":
+		for _, i := range order.levels {
+			levels[i].Filled, levels[i].Quantity = false, 0
+		}
+	case trade.Side == "SELL":
+		log.Infof("%s: position sold by %q, re-arming the grid", trade.Symbol, trade.Reason)
+		rearm(levels)
+	default:
+		return
+	}
+	g.save(trade.Symbol, levels)
+}
+
+/*
+* Analyze market data
+ */
+func (g *GridStrategy) Analyze(data *models.MarketData) *models.Signal {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	/* A signal without a trade by now was skipped */
+	delete(g.pending, data.Symbol)
+
+	levels := g.grid(data.Symbol)
+	prev, hasPrev := g.last[data.Symbol]
+	g.last[data.Symbol] = data.Price
+
+	/* Without a position nothing is held, e.g. the stop sold it */
+	if data.Position == nil && countFilled(levels) > 0 {
+		log.Infof("%s: no open position, re-arming %d filled grid levels", data.Symbol, countFilled(levels))
+		rearm(levels)
+		g.save(data.Symbol, levels)
+	}
+	if !hasPrev {
+		return nil
+	}
+
+	/*
+	* Sell side: a filled level sells once price is at the level above
+	* it, which re-arms the level for the next dip
+	 */
+	sell := gridOrder{side: "SELL"}
+	for i := 0; i < len(levels)-1; i++ {
+		if levels[i].Filled && data.Price >= levels[i+1].Price {
+			sell.levels = append(sell.levels, i)
+			sell.quantity += levels[i].Quantity
+		}
+	}
+	if sell.quantity > 0 {
+		g.pending[data.Symbol] = sell
+		log.Infof("SELL SIGNAL - %s: grid sell %.8f at %.2f (%d levels filled)",
+			data.Symbol, sell.quantity, data.Price, countFilled(levels))
+		return &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "SELL",
+			Price:      data.Price,
+			Quantity:   sell.quantity,
+			Timestamp:  data.Time,
+			Confidence: 1,
+			Reason:     fmt.Sprintf("grid sell at %.2f, %d levels filled", data.Price, countFilled(levels)),
+			Indicators: map[string]float64{"previous_price": prev},
+		}
+	}
+
+	/*
+	* Buy side: an armed level buys when price falls through it.
+	* The top level has nothing above it to sell into, so it never buys,
+	* and nothing buys at or below the stop.
+	 */
+	buy := gridOrder{side: "BUY"}
+	for i := 0; i < len(levels)-1 && data.Price > g.StopLoss(); i++ {
+		price := levels[i].Price
+		if !levels[i].Filled && prev > price && data.Price <= price {
+			buy.levels = append(buy.levels, i)
+			buy.quantity += g.config.OrderSize / price
+		}
+	}
+	if buy.quantity > 0 {
+		g.pending[data.Symbol] = buy
+		log.Infof("BUY SIGNAL - %s: grid buy %.8f at %.2f (%d levels filled)",
+			data.Symbol, buy.quantity, data.Price, countFilled(levels))
+		return &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "BUY",
+			Price:      data.Price,
+			Quantity:   buy.quantity,
+			Timestamp:  data.Time,
+			Confidence: 1,
+			Reason:     fmt.Sprintf("grid buy at %.2f, %d levels filled", data.Price, countFilled(levels)),
+			Indicators: map[string]float64{"previous_price": prev},
+			StopLoss:   g.StopLoss(),
+		}
+	}
+
+	return nil
+}
+
+/* rearm marks every level unfilled */
+func rearm(levels []models.GridLevel) {
+	for i := range levels {
+		levels[i].Filled, levels[i].Quantity = false, 0
+	}
+}
+
+func sameLayout(stored []models.GridLevel, prices []float64) bool {
+	if len(stored) != len(prices) {
+		return false
+	}
+	for i, level := range stored {
+		if level.Level != i || math.Abs(level.Price-prices[i]) > prices[i]*1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func countFilled(levels []models.GridLevel) int {
+	n := 0
+	for _, level := range levels {
+		if level.Filled {
+			n++
+		}
+	}
+	return n
+}
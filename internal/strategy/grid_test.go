@@ -0,0 +1,114 @@
+package strategy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* memoryGridStore keeps the saved grids in memory */
+type memoryGridStore map[string][]models.GridLevel
+
+func (m memoryGridStore) LoadGrid(symbol string) ([]models.GridLevel, error) {
+	return m[symbol], nil
+}
+
+func (m memoryGridStore) SaveGrid(symbol string, levels []models.GridLevel) error {
+	m[symbol] = append([]models.GridLevel(nil), levels...)
+	return nil
+}
+
+func newTestGrid(t *testing.T) (*GridStrategy, memoryGridStore) {
+	s, err := NewFromSpec("grid{lower: 90, upper: 110, levels: 5, order_size: 100}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grid := s.(*GridStrategy)
+	store := memoryGridStore{}
+	grid.AttachStore(store)
+	return grid, store
+}
+
+/* gridBar is a price of BTCUSDT, with an open position of quantity unless it is 0 */
+func gridBar(price, quantity float64) *models.MarketData {
+	data := &models.MarketData{Symbol: "BTCUSDT", Price: price}
+	if quantity > 0 {
+		data.Position = &models.Position{ID: "grid", Quantity: quantity, AverageCost: 100}
+	}
+	return data
+}
+
+func TestGridFillsFromTrades(t *testing.T) {
+	grid, store := newTestGrid(t)
+
+	/* Levels at 90, 95, 100, 105 and 110, falling through 100 buys 1 */
+	grid.Analyze(gridBar(102, 0))
+	buy := grid.Analyze(gridBar(99.5, 0))
+	if buy == nil || buy.Action != "BUY" || buy.Quantity != 1 {
+		t.Fatalf("Expected a buy of 1 at the 100 level, got %+v", buy)
+	}
+	if math.Abs(buy.StopLoss-89.1) > 1e-9 {
+		t.Errorf("Expected the stop 1%% below the lowest level at 89.1, got %.4f", buy.StopLoss)
+	}
+
+	/* The bot skipped the buy: the level stays armed and buys on the next dip */
+	if signal := grid.Analyze(gridBar(101, 0)); signal != nil {
+		t.Fatalf("Unexpected signal above the level: %+v", signal)
+	}
+	if n := countFilled(store["BTCUSDT"]); n != 0 {
+		t.Fatalf("Expected no filled level without a trade, got %d", n)
+	}
+	buy = grid.Analyze(gridBar(99.8, 0))
+	if buy == nil || buy.Action != "BUY" {
+		t.Fatalf("Expected the armed level to buy again, got %+v", buy)
+	}
+
+	/* The bot clamped it to half */
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "BUY", Quantity: 0.5})
+	if level := store["BTCUSDT"][2]; !level.Filled || level.Quantity != 0.5 {
+		t.Fatalf("Expected the 100 level filled with 0.5, got %+v", level)
+	}
+
+	/* At the next level up it sells what filled, and re-arms once sold */
+	sell := grid.Analyze(gridBar(105.2, 0.5))
+	if sell == nil || sell.Action != "SELL" || sell.Quantity != 0.5 {
+		t.Fatalf("Expected a sell of 0.5, got %+v", sell)
+	}
+	if !store["BTCUSDT"][2].Filled {
+		t.Errorf("Expected the level to stay filled until the sell is traded")
+	}
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "SELL", Quantity: 0.5})
+	if n := countFilled(store["BTCUSDT"]); n != 0 {
+		t.Errorf("Expected every level armed after the sell, got %d filled", n)
+	}
+}
+
+func TestGridRearmsWhenThePositionIsGone(t *testing.T) {
+	grid, store := newTestGrid(t)
+	grid.Analyze(gridBar(102, 0))
+	grid.Analyze(gridBar(99.5, 0))
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "BUY", Quantity: 1})
+	grid.Analyze(gridBar(94, 1))
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "BUY", Quantity: 100 / 95.0})
+	if n := countFilled(store["BTCUSDT"]); n != 2 {
+		t.Fatalf("Expected 2 filled levels, got %d", n)
+	}
+
+	/* The bot's stop sold everything */
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "SELL", Quantity: 2, Reason: "stop-loss 89.10 hit"})
+	if n := countFilled(store["BTCUSDT"]); n != 0 {
+		t.Fatalf("Expected the grid re-armed after the bot's exit, got %d filled", n)
+	}
+
+	/* A stop-loss order filled on the exchange: the position is just gone */
+	grid.Analyze(gridBar(96, 0))
+	grid.Analyze(gridBar(94, 0))
+	grid.Filled(models.Trade{Symbol: "BTCUSDT", Side: "BUY", Quantity: 100 / 95.0})
+	if signal := grid.Analyze(gridBar(88, 0)); signal != nil {
+		t.Errorf("Unexpected signal below the grid: %+v", signal)
+	}
+	if n := countFilled(store["BTCUSDT"]); n != 0 {
+		t.Errorf("Expected the grid re-armed without a position, got %d filled", n)
+	}
+}
@@ -0,0 +1,307 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/indicator"
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/timeframe"
+)
+
+/*
+	Guard
+
+*  vetoes signals in market conditions a strategy shouldn't trade in,
+*  e.g. an illiquid market or a flash crash. Check returns why a
+*  signal must not go through, "" to let it pass.
+*
+*  Guards read closed candles from MarketData.Frames and the book from
+*  MarketData.Book, so they behave the same live and in backtests.
+*/
+type Guard interface {
+	Name() string
+	Check(data *models.MarketData) string
+}
+
+/*
+*  VolumeGuard blocks signals while the quote volume (volume * close)
+*  traded over the last 24 hours is below MinVolume
+ */
+type VolumeGuard struct {
+	interval  string
+	bars      int
+	minVolume float64
+}
+
+func NewVolumeGuard(interval string, minVolume float64) (*VolumeGuard, error) {
+	d, err := timeframe.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if d > 24*time.Hour || (24*time.Hour)%d != 0 {
+		return nil, fmt.Errorf("volume interval %s must divide 24h", interval)
+	}
+	return &VolumeGuard{interval: interval, bars: int(24 * time.Hour / d), minVolume: minVolume}, nil
+}
+
+func (g *VolumeGuard) Name() string { return "volume" }
+
+func (g *VolumeGuard) Timeframes() []string { return []string{g.interval} }
+
+func (g *VolumeGuard) Check(data *models.MarketData) string {
+	candles := data.Frame(g.interval)
+	if len(candles) < g.bars {
+		return fmt.Sprintf("warming up, %d of %d %s candles for 24h volume", len(candles), g.bars, g.interval)
+	}
+	volume := 0.0
+	for _, c := range candles[len(candles)-g.bars:] {
+		volume += c.Volume * c.Close
+	}
+	if volume < g.minVolume {
+		return fmt.Sprintf("24h volume %.0f below %.0f", volume, g.minVolume)
+	}
+	return ""
+}
+
+/*
+*  ATRGuard blocks signals while ATR as % of price is outside a band:
+*  below MinPct the market is too quiet to pay for fees, above MaxPct
+*  it is crashing or spiking. A zero bound is not checked.
+ */
+type ATRGuard struct {
+	interval string
+	period   int
+	minPct   float64
+	maxPct   float64
+}
+
+func NewATRGuard(interval string, period int, minPct, maxPct float64) (*ATRGuard, error) {
+	if _, err := timeframe.ParseInterval(interval); err != nil {
+		return nil, err
+	}
+	if maxPct > 0 && minPct >= maxPct {
+		return nil, fmt.Errorf("min ATR %% (%.2f) must be below max ATR %% (%.2f)", minPct, maxPct)
+	}
+	return &ATRGuard{interval: interval, period: period, minPct: minPct, maxPct: maxPct}, nil
+}
+
+func (g *ATRGuard) Name() string { return "atr" }
+
+func (g *ATRGuard) Timeframes() []string { return []string{g.interval} }
+
+func (g *ATRGuard) Check(data *models.MarketData) string {
+	candles := data.Frame(g.interval)
+	atr := indicator.NewATR(g.period)
+	for _, c := range candles {
+		atr.Update(c.High, c.Low, c.Close)
+	}
+	if !atr.Ready() {
+		return fmt.Sprintf("warming up, %d %s candles for ATR(%d)", len(candles), g.interval, g.period)
+	}
+	pct := atr.Value() / candles[len(candles)-1].Close * 100
+	switch {
+	case g.minPct > 0 && pct < g.minPct:
+		return fmt.Sprintf("ATR %.2f%% below %.2f%%", pct, g.minPct)
+	case g.maxPct > 0 && pct > g.maxPct:
+		return fmt.Sprintf("ATR %.2f%% above %.2f%%", pct, g.maxPct)
+	}
+	return ""
+}
+
+/*
+*  SpreadGuard blocks signals while the bid-ask spread is wider than
+*  MaxPct of the price. Without a book it can't tell and lets them pass.
+ */
+type SpreadGuard struct {
+	maxPct float64
+}
+
+func NewSpreadGuard(maxPct float64) *SpreadGuard {
+	return &SpreadGuard{maxPct: maxPct}
+}
+
+func (g *SpreadGuard) Name() string { return "spread" }
+
+func (g *SpreadGuard) BookLevels() int { return 1 }
+
+func (g *SpreadGuard) Check(data *models.MarketData) string {
+	if data.Book == nil || data.Book.Mid() == 0 {
+		return ""
+	}
+	if spread := data.Book.SpreadPct(); spread > g.maxPct {
+		return fmt.Sprintf("spread %.3f%% above %.3f%%", spread, g.maxPct)
+	}
+	return ""
+}
+
+/*
+	GuardedStrategy
+
+*  What is a Guarded Strategy?
+*
+*  A wrapper that runs another strategy and passes its signals through
+*  a list of guards. The first guard that objects suppresses the
+*  signal, and the reason is logged. Only entries are guarded unless
+*  exits is set: being stuck in a position because volume dried up is
+*  worse than the exit.
+*
+*  The wrapped strategy isn't told its buy was suppressed, its later
+*  sell finds no position and is ignored.
+*/
+type GuardedStrategy struct {
+	strategy   Strategy
+	guards     []Guard
+	exits      bool
+	suppressed map[string]int
+}
+
+/*
+*  SuppressionReporter is implemented by strategies that count the
+*  signals their guards suppressed, keyed by guard name
+ */
+type SuppressionReporter interface {
+	Suppressed() map[string]int
+}
+
+/* Suppressed sums the suppression counts of every guard in the tree */
+func Suppressed(s Strategy) map[string]int {
+	counts := make(map[string]int)
+	Walk(s, func(s Strategy) {
+		if r, ok := s.(SuppressionReporter); ok {
+			for name, n := range r.Suppressed() {
+				counts[name] += n
+			}
+		}
+	})
+	return counts
+}
+
+func NewGuardedStrategy(strategy Strategy, exits bool, guards ...Guard) *GuardedStrategy {
+	return &GuardedStrategy{
+		strategy:   strategy,
+		guards:     guards,
+		exits:      exits,
+		suppressed: make(map[string]int),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "guard",
+		Description: "Suppresses another strategy's signals on low 24h volume, an ATR % outside a band or a wide spread",
+		Params: []ParamSpec{
+			{Name: "strategy", Type: ParamString, Default: "mean_reversion", Description: "strategy spec to guard"},
+			{Name: "min_volume", Type: ParamFloat, Default: 0.0, Min: 0, Max: 1e15, Description: "min 24h quote volume, 0 = off"},
+			{Name: "volume_interval", Type: ParamString, Default: "1h", Description: "candles the 24h volume is summed from"},
+			{Name: "min_atr_pct", Type: ParamFloat, Default: 0.0, Min: 0, Max: 100, Description: "min ATR as % of price, 0 = off"},
+			{Name: "max_atr_pct", Type: ParamFloat, Default: 0.0, Min: 0, Max: 100, Description: "max ATR as % of price, 0 = off"},
+			{Name: "atr_period", Type: ParamInt, Default: 14, Min: 2, Max: timeframe.DefaultLimit - 1},
+			{Name: "atr_interval", Type: ParamString, Default: "1h", Description: "candles the ATR is measured on"},
+			{Name: "max_spread_pct", Type: ParamFloat, Default: 0.0, Min: 0, Max: 100, Description: "max bid-ask spread as % of price, 0 = off"},
+			{Name: "exits", Type: ParamBool, Default: false, Description: "guard sells too"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			child, err := NewFromSpec(p.String("strategy"))
+			if err != nil {
+				return nil, fmt.Errorf("strategy: %v", err)
+			}
+
+			var guards []Guard
+			if p.Float("min_volume") > 0 {
+				g, err := NewVolumeGuard(p.String("volume_interval"), p.Float("min_volume"))
+				if err != nil {
+					return nil, fmt.Errorf("volume_interval: %v", err)
+				}
+				guards = append(guards, g)
+			}
+			if p.Float("min_atr_pct") > 0 || p.Float("max_atr_pct") > 0 {
+				g, err := NewATRGuard(p.String("atr_interval"), p.Int("atr_period"), p.Float("min_atr_pct"), p.Float("max_atr_pct"))
+				if err != nil {
+					return nil, err
+				}
+				guards = append(guards, g)
+			}
+			if p.Float("max_spread_pct") > 0 {
+				guards = append(guards, NewSpreadGuard(p.Float("max_spread_pct")))
+			}
+			if len(guards) == 0 {
+				return nil, fmt.Errorf("no guard set: use min_volume, min_atr_pct / max_atr_pct or max_spread_pct")
+			}
+			return NewGuardedStrategy(child, p.Bool("exits"), guards...), nil
+		},
+	})
+}
+
+/*
+* Analyze market data
+ */
+func (g *GuardedStrategy) Analyze(data *models.MarketData) *models.Signal {
+	signal := Analyze(g.strategy, data)
+	if signal == nil || (signal.Action == "SELL" && !g.exits) {
+		return signal
+	}
+	for _, guard := range g.guards {
+		if reason := guard.Check(data); reason != "" {
+			g.suppressed[guard.Name()]++
+			log.Infof("%s %s suppressed by %s guard: %s (%s)", data.Symbol, signal.Action, guard.Name(), reason, signal.Reason)
+			return nil
+		}
+	}
+	return signal
+}
+
+/* Children returns the guarded strategy */
+func (g *GuardedStrategy) Children() []Strategy {
+	return []Strategy{g.strategy}
+}
+
+/* Timeframes returns the candle intervals the guards read */
+func (g *GuardedStrategy) Timeframes() []string {
+	var intervals []string
+	for _, guard := range g.guards {
+		if m, ok := guard.(MultiTimeframe); ok {
+			intervals = append(intervals, m.Timeframes()...)
+		}
+	}
+	return intervals
+}
+
+/* BookLevels returns 1 when a guard reads the book, 0 otherwise */
+func (g *GuardedStrategy) BookLevels() int {
+	levels := 0
+	for _, guard := range g.guards {
+		if w, ok := guard.(OrderBookWatcher); ok && w.BookLevels() > levels {
+			levels = w.BookLevels()
+		}
+	}
+	return levels
+}
+
+/* Suppressed returns how many signals each guard suppressed */
+func (g *GuardedStrategy) Suppressed() map[string]int {
+	counts := make(map[string]int, len(g.suppressed))
+	for name, n := range g.suppressed {
+		counts[name] = n
+	}
+	return counts
+}
+
+/* MarshalState snapshots the guarded strategy, guards keep no state */
+func (g *GuardedStrategy) MarshalState() ([]byte, error) {
+	members, err := marshalChildren(g.Children())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (g *GuardedStrategy) UnmarshalState(data []byte) error {
+	var members []json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	return unmarshalChildren(g.Children(), members)
+}
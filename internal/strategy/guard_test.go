@@ -0,0 +1,87 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* signalStub gives the same signal on every bar */
+type signalStub struct{ action string }
+
+func (s signalStub) Analyze(data *models.MarketData) *models.Signal {
+	return &models.Signal{Symbol: data.Symbol, Action: s.action, Price: data.Price}
+}
+
+func TestGuards(t *testing.T) {
+	volume, err := NewVolumeGuard("1h", 1e6)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	atr, err := NewATRGuard("1h", 14, 0.2, 1.5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* 24 hourly candles of 100 units at 100 = 240k quote volume, 1% range */
+	candles := make([]models.Kline, 24)
+	for i := range candles {
+		candles[i] = models.Kline{Open: 100, High: 100.5, Low: 99.5, Close: 100, Volume: 100}
+	}
+	data := &models.MarketData{
+		Symbol: "DOGEUSDT",
+		Price:  100,
+		Frames: map[string][]models.Kline{"1h": candles},
+		Book: &models.OrderBook{
+			Bids: []models.BookLevel{{Price: 99, Quantity: 1}},
+			Asks: []models.BookLevel{{Price: 101, Quantity: 1}},
+		},
+	}
+
+	buys := NewGuardedStrategy(signalStub{"BUY"}, false, atr, NewSpreadGuard(1), volume)
+	if buys.Analyze(data) != nil {
+		t.Fatalf("Expected the 2%% spread to suppress the buy")
+	}
+	data.Book.Bids[0].Price, data.Book.Asks[0].Price = 99.95, 100.05
+	if buys.Analyze(data) != nil {
+		t.Fatalf("Expected the low volume to suppress the buy")
+	}
+	for i := range candles {
+		candles[i].Volume = 1000
+	}
+	if buys.Analyze(data) == nil {
+		t.Fatalf("Expected the buy to pass every guard")
+	}
+
+	/* A flash crash blows the ATR band, sells still go out */
+	candles[23].Low = 80
+	if buys.Analyze(data) != nil {
+		t.Errorf("Expected the ATR spike to suppress the buy")
+	}
+	if NewGuardedStrategy(signalStub{"SELL"}, false, atr).Analyze(data) == nil {
+		t.Errorf("Expected sells to pass when exits are not guarded")
+	}
+
+	want := map[string]int{"spread": 1, "volume": 1, "atr": 1}
+	for name, n := range Suppressed(buys) {
+		if want[name] != n {
+			t.Errorf("Expected %d suppressed by %s, got %d", want[name], name, n)
+		}
+	}
+}
+
+func TestGuardSpec(t *testing.T) {
+	s, err := NewFromSpec("guard{strategy: ema_cross, min_volume: 5000000, atr_interval: 4h, max_spread_pct: 0.1}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := Timeframes(s); len(got) == 0 {
+		t.Errorf("Expected the guard intervals to be subscribed")
+	}
+	if BookLevels(s) < 1 {
+		t.Errorf("Expected the spread guard to watch the book")
+	}
+	if _, err := NewFromSpec("guard{strategy: ema_cross}"); err == nil {
+		t.Errorf("Expected an error without any guard set")
+	}
+}
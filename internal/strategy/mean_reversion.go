@@ -1,12 +1,24 @@
 package strategy
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/marwanbukhori/player-cryptobot/internal/models"
 	"github.com/sirupsen/logrus"
 )
 
 var log = logrus.New()
 
+/*
+*  SetLogOutput redirects the strategies' logging, e.g. to io.Discard
+*  for sweeps that run thousands of backtests
+ */
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
 /*
 	MeanReversionStrategy
 
@@ -17,6 +29,7 @@ var log = logrus.New()
 */
 
 type MeanReversionStrategy struct {
+	config      MeanReversionConfig
 	rsi         *RSICalculator
 	lastPrices  map[string][]float64 // Track price history per symbol
 	maxPrices   map[string]float64   // Track local highs
@@ -24,9 +37,48 @@ type MeanReversionStrategy struct {
 	entryPrices map[string]float64
 }
 
+/*
+*  MeanReversionConfig holds the tunable thresholds
+*  - RSIPeriod: number of price changes averaged by the RSI
+*  - Oversold / Overbought: RSI levels for buy / sell
+*  - BuyBand / SellBand: position in the local range (0-100%)
+*  - History: number of prices kept per symbol
+*  - StopPct / TakeProfitPct: exit levels suggested with each buy,
+*    without a take-profit the bot's tiered profit targets apply
+ */
+type MeanReversionConfig struct {
+	RSIPeriod     int
+	Oversold      float64
+	Overbought    float64
+	BuyBand       float64
+	SellBand      float64
+	History       int
+	StopPct       float64
+	TakeProfitPct float64
+}
+
+func DefaultMeanReversionConfig() MeanReversionConfig {
+	return MeanReversionConfig{
+		RSIPeriod:  5,
+		Oversold:   40,
+		Overbought: 60,
+		BuyBand:    20,
+		SellBand:   80,
+		History:    30,
+
+		StopPct:       0.5,
+		TakeProfitPct: 0,
+	}
+}
+
 func NewMeanReversionStrategy() *MeanReversionStrategy {
+	return NewMeanReversionStrategyWithConfig(DefaultMeanReversionConfig())
+}
+
+func NewMeanReversionStrategyWithConfig(config MeanReversionConfig) *MeanReversionStrategy {
 	return &MeanReversionStrategy{
-		rsi:         NewRSICalculator(5),
+		config:      config,
+		rsi:         NewRSICalculator(config.RSIPeriod),
 		lastPrices:  make(map[string][]float64),
 		maxPrices:   make(map[string]float64),
 		minPrices:   make(map[string]float64),
@@ -34,6 +86,44 @@ func NewMeanReversionStrategy() *MeanReversionStrategy {
 	}
 }
 
+func init() {
+	defaults := DefaultMeanReversionConfig()
+	Register(Definition{
+		Name:        "mean_reversion",
+		Description: "Buys near the local low with an oversold RSI, sells near the local high when profitable",
+		Params: []ParamSpec{
+			{Name: "rsi_period", Type: ParamInt, Default: defaults.RSIPeriod, Min: 2, Max: 200},
+			{Name: "oversold", Type: ParamFloat, Default: defaults.Oversold, Min: 0, Max: 100},
+			{Name: "overbought", Type: ParamFloat, Default: defaults.Overbought, Min: 0, Max: 100},
+			{Name: "buy_band", Type: ParamFloat, Default: defaults.BuyBand, Min: 0, Max: 100},
+			{Name: "sell_band", Type: ParamFloat, Default: defaults.SellBand, Min: 0, Max: 100},
+			{Name: "history", Type: ParamInt, Default: defaults.History, Min: 2, Max: 10000},
+			{Name: "stop_pct", Type: ParamFloat, Default: defaults.StopPct, Min: 0, Max: 50},
+			{Name: "take_profit_pct", Type: ParamFloat, Default: defaults.TakeProfitPct, Min: 0, Max: 1000},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			config := MeanReversionConfig{
+				RSIPeriod:  p.Int("rsi_period"),
+				Oversold:   p.Float("oversold"),
+				Overbought: p.Float("overbought"),
+				BuyBand:    p.Float("buy_band"),
+				SellBand:   p.Float("sell_band"),
+				History:    p.Int("history"),
+
+				StopPct:       p.Float("stop_pct"),
+				TakeProfitPct: p.Float("take_profit_pct"),
+			}
+			if config.Oversold >= config.Overbought {
+				return nil, fmt.Errorf("oversold (%.2f) must be below overbought (%.2f)", config.Oversold, config.Overbought)
+			}
+			if config.BuyBand >= config.SellBand {
+				return nil, fmt.Errorf("buy_band (%.2f) must be below sell_band (%.2f)", config.BuyBand, config.SellBand)
+			}
+			return NewMeanReversionStrategyWithConfig(config), nil
+		},
+	})
+}
+
 /**
 *
 * All the Mean Reversion Strategy Functions
@@ -51,7 +141,7 @@ func (s *MeanReversionStrategy) Analyze(data *models.MarketData) *models.Signal
 	/* Track prices */
 	prices := s.lastPrices[data.Symbol]
 	prices = append(prices, data.Price)
-	if len(prices) > 30 { // Keep last 30 minutes
+	if len(prices) > s.config.History { // Keep last N prices
 		prices = prices[1:]
 	}
 	s.lastPrices[data.Symbol] = prices
@@ -80,12 +170,37 @@ func (s *MeanReversionStrategy) Analyze(data *models.MarketData) *models.Signal
 	log.Infof("Symbol: %s, Price: %.2f, RSI: %.2f, Range Position: %.2f%%",
 		data.Symbol, data.Price, rsi, positionInRange)
 
+	indicators := map[string]float64{
+		"rsi":            rsi,
+		"range_position": positionInRange,
+		"local_high":     localHigh,
+		"local_low":      localLow,
+	}
+
 	/* Trading logic */
-	if positionInRange < 20 && rsi < 40 { // Price near bottom + oversold
+	if positionInRange < s.config.BuyBand && rsi < s.config.Oversold { // Price near bottom + oversold
 		log.Infof("BUY SIGNAL - %s: Price near low (%.2f%%) and RSI oversold (%.2f)",
 			data.Symbol, positionInRange, rsi)
 		s.entryPrices[data.Symbol] = data.Price
-		return &models.Signal{Symbol: data.Symbol, Action: "BUY"}
+
+		/* Confidence grows the deeper price sits in the oversold zone */
+		confidence := (depth(rsi, s.config.Oversold, 0) + depth(positionInRange, s.config.BuyBand, 0)) / 2
+		signal := &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "BUY",
+			Price:      data.Price,
+			Timestamp:  data.Time,
+			Confidence: confidence,
+			Reason:     fmt.Sprintf("price near low (%.2f%% of range) and RSI oversold (%.2f)", positionInRange, rsi),
+			Indicators: indicators,
+		}
+		if s.config.StopPct > 0 {
+			signal.StopLoss = data.Price * (1 - s.config.StopPct/100)
+		}
+		if s.config.TakeProfitPct > 0 {
+			signal.TakeProfit = data.Price * (1 + s.config.TakeProfitPct/100)
+		}
+		return signal
 	}
 
 	/* Only sell when profitable */
@@ -93,15 +208,85 @@ func (s *MeanReversionStrategy) Analyze(data *models.MarketData) *models.Signal
 	if entryPrice, exists := s.entryPrices[data.Symbol]; exists {
 		currentProfit = ((data.Price - entryPrice) / entryPrice) * 100
 	}
-	if positionInRange > 80 && rsi > 60 && currentProfit > 0 {
+	if positionInRange > s.config.SellBand && rsi > s.config.Overbought && currentProfit > 0 {
 		log.Infof("SELL SIGNAL - %s: Price near high (%.2f%%) and RSI overbought (%.2f)",
 			data.Symbol, positionInRange, rsi)
-		return &models.Signal{Symbol: data.Symbol, Action: "SELL"}
+		indicators["profit_pct"] = currentProfit
+		return &models.Signal{
+			Symbol:     data.Symbol,
+			Action:     "SELL",
+			Price:      data.Price,
+			Timestamp:  data.Time,
+			Confidence: (depth(rsi, s.config.Overbought, 100) + depth(positionInRange, s.config.SellBand, 100)) / 2,
+			Reason:     fmt.Sprintf("price near high (%.2f%% of range) and RSI overbought (%.2f), +%.2f%%", positionInRange, rsi, currentProfit),
+			Indicators: indicators,
+		}
 	}
 
 	return nil
 }
 
+/*
+*  meanReversionState is the persisted form of the strategy's memory,
+*  without it a restart forgets entry prices and the
+*  "only sell when profitable" check no longer holds
+ */
+type meanReversionState struct {
+	RSIPrevPrice float64              `json:"rsi_prev_price"`
+	RSIGains     []float64            `json:"rsi_gains"`
+	RSILosses    []float64            `json:"rsi_losses"`
+	LastPrices   map[string][]float64 `json:"last_prices"`
+	MaxPrices    map[string]float64   `json:"max_prices"`
+	MinPrices    map[string]float64   `json:"min_prices"`
+	EntryPrices  map[string]float64   `json:"entry_prices"`
+}
+
+/* MarshalState snapshots price history, RSI buffers and entry prices */
+func (s *MeanReversionStrategy) MarshalState() ([]byte, error) {
+	return json.Marshal(meanReversionState{
+		RSIPrevPrice: s.rsi.prevPrice,
+		RSIGains:     s.rsi.gains,
+		RSILosses:    s.rsi.losses,
+		LastPrices:   s.lastPrices,
+		MaxPrices:    s.maxPrices,
+		MinPrices:    s.minPrices,
+		EntryPrices:  s.entryPrices,
+	})
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *MeanReversionStrategy) UnmarshalState(data []byte) error {
+	var state meanReversionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if len(state.RSIGains) != len(state.RSILosses) || len(state.RSIGains) > s.config.RSIPeriod {
+		return fmt.Errorf("RSI buffers don't match period %d", s.config.RSIPeriod)
+	}
+
+	s.rsi.prevPrice = state.RSIPrevPrice
+	s.rsi.gains = append(s.rsi.gains[:0], state.RSIGains...)
+	s.rsi.losses = append(s.rsi.losses[:0], state.RSILosses...)
+	s.lastPrices = make(map[string][]float64)
+	for symbol, prices := range state.LastPrices {
+		if len(prices) > s.config.History {
+			prices = prices[len(prices)-s.config.History:]
+		}
+		s.lastPrices[symbol] = prices
+	}
+	s.maxPrices = orEmpty(state.MaxPrices)
+	s.minPrices = orEmpty(state.MinPrices)
+	s.entryPrices = orEmpty(state.EntryPrices)
+	return nil
+}
+
+func orEmpty(m map[string]float64) map[string]float64 {
+	if m == nil {
+		return make(map[string]float64)
+	}
+	return m
+}
+
 /*
 *  RSI means Relative Strength Index
 *  It is a technical indicator that measures the speed and change of price movements
@@ -168,6 +353,24 @@ func (r *RSICalculator) Calculate(price float64) float64 {
 	return 100 - (100 / (1 + rs))
 }
 
+/*
+*  depth returns how far value has moved past threshold towards limit,
+*  0 at the threshold and 1 at the limit
+ */
+func depth(value, threshold, limit float64) float64 {
+	if threshold == limit {
+		return 1
+	}
+	d := (value - threshold) / (limit - threshold)
+	if d < 0 {
+		return 0
+	}
+	if d > 1 {
+		return 1
+	}
+	return d
+}
+
 func average(values []float64) float64 {
 	if len(values) == 0 {
 		return 0
@@ -2,6 +2,8 @@ package strategy
 
 import (
 	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
 )
 
 func TestRSICalculator(t *testing.T) {
@@ -21,3 +23,32 @@ func TestRSICalculator(t *testing.T) {
 		}
 	}
 }
+
+func TestMeanReversionStateRoundTrip(t *testing.T) {
+	before := NewMeanReversionStrategy()
+	prices := []float64{100, 99, 98, 96, 95, 93, 92, 94, 97, 99, 101, 103}
+	for _, price := range prices {
+		before.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: price})
+	}
+	if _, ok := before.entryPrices["BTCUSDT"]; !ok {
+		t.Fatal("expected an entry price after the dip")
+	}
+
+	state, err := before.MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := NewMeanReversionStrategy()
+	if err := after.UnmarshalState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	/* Both copies must make the same decisions from here on */
+	for _, price := range []float64{104, 106, 105, 108, 90} {
+		a := before.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: price})
+		b := after.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: price})
+		if (a == nil) != (b == nil) || (a != nil && a.Action != b.Action) {
+			t.Fatalf("at %.2f restored strategy signalled %v, original %v", price, b, a)
+		}
+	}
+}
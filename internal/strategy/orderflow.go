@@ -0,0 +1,184 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/orderbook"
+)
+
+/*
+	OrderFlowStrategy
+
+*  What is an Order Flow Strategy?
+*
+*  A short-horizon strategy that times entries from market
+*  microstructure instead of candles:
+*  - depth imbalance: resting bids against asks over the top levels
+*  - top-of-book imbalance: which side of the best prices is thinner
+*  - trade flow: the share of aggressive volume that bought
+*
+*  It buys when bids outweigh asks and buyers are crossing the spread,
+*  and sells when the pressure flips or the small stop / target is hit.
+*  It needs the order book: live from the depth stream, in backtests
+*  from a recording. Without a book it does nothing.
+*/
+type OrderFlowStrategy struct {
+	levels        int
+	entryBook     float64
+	minTop        float64
+	minBuyRatio   float64
+	minTrades     int
+	exitBook      float64
+	takeProfitPct float64
+	stopPct       float64
+	maxHold       int
+	trades        map[string]*orderFlowTrade
+}
+
+type orderFlowTrade struct {
+	EntryPrice float64 `json:"entry_price"`
+	Held       int     `json:"held"`
+}
+
+func NewOrderFlowStrategy(levels int, entryBook, minTop, minBuyRatio float64, minTrades int, exitBook, takeProfitPct, stopPct float64, maxHold int) *OrderFlowStrategy {
+	return &OrderFlowStrategy{
+		levels:        levels,
+		entryBook:     entryBook,
+		minTop:        minTop,
+		minBuyRatio:   minBuyRatio,
+		minTrades:     minTrades,
+		exitBook:      exitBook,
+		takeProfitPct: takeProfitPct,
+		stopPct:       stopPct,
+		maxHold:       maxHold,
+		trades:        make(map[string]*orderFlowTrade),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "orderflow",
+		Description: "Short-horizon entries from order book imbalance and aggressive trade flow",
+		Params: []ParamSpec{
+			{Name: "levels", Type: ParamInt, Default: 10, Min: 1, Max: 20, Description: "book levels of the depth imbalance"},
+			{Name: "entry_imbalance", Type: ParamFloat, Default: 0.3, Min: 0, Max: 1, Description: "depth imbalance to buy at"},
+			{Name: "top_imbalance", Type: ParamFloat, Default: 0.0, Min: -1, Max: 1, Description: "min top-of-book imbalance to buy"},
+			{Name: "buy_ratio", Type: ParamFloat, Default: 0.6, Min: 0.5, Max: 1, Description: "min share of aggressive volume buying"},
+			{Name: "min_trades", Type: ParamInt, Default: 10, Min: 0, Max: 100000, Description: "trades in the flow window for a reading"},
+			{Name: "exit_imbalance", Type: ParamFloat, Default: -0.2, Min: -1, Max: 1, Description: "sell when depth imbalance drops to this with sellers in control"},
+			{Name: "take_profit_pct", Type: ParamFloat, Default: 0.3, Min: 0, Max: 100},
+			{Name: "stop_pct", Type: ParamFloat, Default: 0.2, Min: 0, Max: 100},
+			{Name: "max_hold", Type: ParamInt, Default: 30, Min: 0, Max: 100000, Description: "observations to hold at most, 0 = no limit"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			if p.Float("exit_imbalance") >= p.Float("entry_imbalance") {
+				return nil, fmt.Errorf("exit_imbalance (%.2f) must be below entry_imbalance (%.2f)",
+					p.Float("exit_imbalance"), p.Float("entry_imbalance"))
+			}
+			return NewOrderFlowStrategy(
+				p.Int("levels"),
+				p.Float("entry_imbalance"),
+				p.Float("top_imbalance"),
+				p.Float("buy_ratio"),
+				p.Int("min_trades"),
+				p.Float("exit_imbalance"),
+				p.Float("take_profit_pct"),
+				p.Float("stop_pct"),
+				p.Int("max_hold"),
+			), nil
+		},
+	})
+}
+
+/* ManagesExits is true, a flip of the book exits at any price */
+func (s *OrderFlowStrategy) ManagesExits() bool {
+	return true
+}
+
+/* BookLevels returns the depth the strategy reads */
+func (s *OrderFlowStrategy) BookLevels() int {
+	return s.levels
+}
+
+/*
+* Analyze market data
+ */
+func (s *OrderFlowStrategy) Analyze(data *models.MarketData) *models.Signal {
+	if data.Book == nil || data.Flow == nil || len(data.Book.Bids) == 0 || len(data.Book.Asks) == 0 {
+		return nil
+	}
+
+	book := orderbook.Imbalance(data.Book, s.levels)
+	top := orderbook.Imbalance(data.Book, 1)
+	buyRatio := data.Flow.BuyRatio()
+	flowReady := data.Flow.Trades >= s.minTrades
+
+	signal := &models.Signal{
+		Symbol:    data.Symbol,
+		Price:     data.Price,
+		Timestamp: data.Time,
+		Indicators: map[string]float64{
+			"book_imbalance": book,
+			"top_imbalance":  top,
+			"buy_ratio":      buyRatio,
+			"spread_pct":     data.Book.SpreadPct(),
+		},
+	}
+
+	if trade, ok := s.trades[data.Symbol]; ok {
+		trade.Held++
+		change := (data.Price - trade.EntryPrice) / trade.EntryPrice * 100
+		reason := ""
+		switch {
+		case s.takeProfitPct > 0 && change >= s.takeProfitPct:
+			reason = fmt.Sprintf("take profit %.2f%%", change)
+		case s.stopPct > 0 && change <= -s.stopPct:
+			reason = fmt.Sprintf("stop %.2f%%", change)
+		case flowReady && book <= s.exitBook && buyRatio < 0.5:
+			reason = fmt.Sprintf("pressure flipped: imbalance %.2f, buy ratio %.2f", book, buyRatio)
+		case s.maxHold > 0 && trade.Held >= s.maxHold:
+			reason = fmt.Sprintf("held %d observations", trade.Held)
+		default:
+			return nil
+		}
+		delete(s.trades, data.Symbol)
+		signal.Action = "SELL"
+		signal.Reason = "orderflow " + reason
+		log.Infof("SELL SIGNAL - %s: %s", data.Symbol, signal.Reason)
+		return signal
+	}
+
+	if !flowReady || book < s.entryBook || top < s.minTop || buyRatio < s.minBuyRatio {
+		return nil
+	}
+
+	s.trades[data.Symbol] = &orderFlowTrade{EntryPrice: data.Price}
+	signal.Action = "BUY"
+	signal.Confidence = (book + (buyRatio-0.5)*2) / 2
+	signal.Reason = fmt.Sprintf("orderflow bids %.2f over %d levels, %.0f%% of flow buying", book, s.levels, buyRatio*100)
+	if s.stopPct > 0 {
+		signal.StopLoss = data.Price * (1 - s.stopPct/100)
+	}
+	if s.takeProfitPct > 0 {
+		signal.TakeProfit = data.Price * (1 + s.takeProfitPct/100)
+	}
+	log.Infof("BUY SIGNAL - %s: %s", data.Symbol, signal.Reason)
+	return signal
+}
+
+/* MarshalState snapshots the open trades */
+func (s *OrderFlowStrategy) MarshalState() ([]byte, error) {
+	return json.Marshal(s.trades)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *OrderFlowStrategy) UnmarshalState(data []byte) error {
+	trades := make(map[string]*orderFlowTrade)
+	if err := json.Unmarshal(data, &trades); err != nil {
+		return err
+	}
+	s.trades = trades
+	return nil
+}
@@ -0,0 +1,72 @@
+package strategy
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+*  flowBar is a bar at price with 10 levels of bids and asks of the
+*  given sizes and trades of aggressive buy and sell volume
+ */
+func flowBar(price, bidSize, askSize, bought, sold float64, trades int) *models.MarketData {
+	book := &models.OrderBook{Symbol: "BTCUSDT"}
+	for i := 0; i < 10; i++ {
+		book.Bids = append(book.Bids, models.BookLevel{Price: price - 0.01*float64(i+1), Quantity: bidSize})
+		book.Asks = append(book.Asks, models.BookLevel{Price: price + 0.01*float64(i+1), Quantity: askSize})
+	}
+	return &models.MarketData{
+		Symbol: "BTCUSDT",
+		Price:  price,
+		Book:   book,
+		Flow:   &models.TradeFlow{BuyVolume: bought, SellVolume: sold, Trades: trades},
+	}
+}
+
+func TestOrderFlowEntriesAndExits(t *testing.T) {
+	s, err := NewFromSpec("orderflow")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* Nothing without a book, a balanced book or too few trades */
+	if signal := s.Analyze(&models.MarketData{Symbol: "BTCUSDT", Price: 100}); signal != nil {
+		t.Fatalf("Unexpected signal without a book: %+v", signal)
+	}
+	if signal := s.Analyze(flowBar(100, 1, 1, 7, 3, 20)); signal != nil {
+		t.Fatalf("Unexpected signal on a balanced book: %+v", signal)
+	}
+	if signal := s.Analyze(flowBar(100, 3, 1, 7, 3, 5)); signal != nil {
+		t.Fatalf("Unexpected signal from 5 trades: %+v", signal)
+	}
+
+	/* Bids 0.5 over asks and 70% of the flow buying */
+	buy := s.Analyze(flowBar(100, 3, 1, 7, 3, 20))
+	if buy == nil || buy.Action != "BUY" {
+		t.Fatalf("Expected a BUY on bid imbalance and buying flow, got %+v", buy)
+	}
+	if math.Abs(buy.StopLoss-99.8) > 1e-9 || math.Abs(buy.TakeProfit-100.3) > 1e-9 {
+		t.Errorf("Expected the stop at 99.8 and the target at 100.3, got %.4f and %.4f", buy.StopLoss, buy.TakeProfit)
+	}
+	if signal := s.Analyze(flowBar(100.1, 1, 1, 5, 5, 20)); signal != nil {
+		t.Fatalf("Unexpected signal while holding: %+v", signal)
+	}
+
+	/* Asks 0.5 over bids with sellers in control */
+	sell := s.Analyze(flowBar(100.1, 1, 3, 3, 7, 20))
+	if sell == nil || sell.Action != "SELL" || !strings.Contains(sell.Reason, "pressure flipped") {
+		t.Fatalf("Expected a SELL when the pressure flips, got %+v", sell)
+	}
+
+	/* A new entry exits at its target */
+	if buy := s.Analyze(flowBar(100, 3, 1, 7, 3, 20)); buy == nil || buy.Action != "BUY" {
+		t.Fatalf("Expected a new BUY, got %+v", buy)
+	}
+	sell = s.Analyze(flowBar(100.4, 3, 1, 7, 3, 20))
+	if sell == nil || sell.Action != "SELL" || !strings.Contains(sell.Reason, "take profit") {
+		t.Fatalf("Expected a take-profit SELL, got %+v", sell)
+	}
+}
@@ -0,0 +1,323 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	PairsStrategy
+
+*  What is a Pairs Strategy?
+*
+*  Statistical arbitrage between two symbols that move together,
+*  e.g. BTCUSDT / ETHUSDT. Over a rolling window it regresses the
+*  log price of A on the log price of B:
+*
+*    log(A) = alpha + beta * log(B) + spread
+*
+*  beta is the hedge ratio. The z-score is the latest spread in
+*  standard deviations of the window's spread. A large positive z
+*  means A is rich against B, a large negative z means A is cheap.
+*
+*  Modes:
+*  - rotation (spot): hold the cheap leg. Buy A when z < -entry_z,
+*    buy B when z > entry_z, rotating out of the other leg first.
+*    Back to cash when |z| drops below exit_z.
+*  - hedge: long the cheap leg and short the rich leg, closing both
+*    when |z| drops below exit_z. Shorts use the SHORT / COVER
+*    actions, which need a runner that can sell short.
+*
+*  Either mode gives up on a spread that keeps widening past stop_z,
+*  and waits for it to come back inside entry_z before trading again.
+*/
+type PairsStrategy struct {
+	a, b    string
+	mode    string
+	window  int
+	entryZ  float64
+	exitZ   float64
+	stopZ   float64
+	pricesA []float64
+	pricesB []float64
+	held    string // rotation: leg held, "" in cash
+	hedged  int    // hedge: 1 long A / short B, -1 short A / long B, 0 flat
+	cooling bool   // stopped out, no entries until |z| is back below entry_z
+}
+
+const (
+	PairsRotation = "rotation"
+	PairsHedge    = "hedge"
+)
+
+func NewPairsStrategy(a, b, mode string, window int, entryZ, exitZ, stopZ float64) (*PairsStrategy, error) {
+	if a == "" || b == "" || a == b {
+		return nil, fmt.Errorf("need two different symbols, got %q and %q", a, b)
+	}
+	if mode != PairsRotation && mode != PairsHedge {
+		return nil, fmt.Errorf("mode must be rotation or hedge, got %q", mode)
+	}
+	if exitZ >= entryZ {
+		return nil, fmt.Errorf("exit_z (%.2f) must be below entry_z (%.2f)", exitZ, entryZ)
+	}
+	if stopZ != 0 && stopZ <= entryZ {
+		return nil, fmt.Errorf("stop_z (%.2f) must be above entry_z (%.2f), or 0 to disable", stopZ, entryZ)
+	}
+	return &PairsStrategy{
+		a:      a,
+		b:      b,
+		mode:   mode,
+		window: window,
+		entryZ: entryZ,
+		exitZ:  exitZ,
+		stopZ:  stopZ,
+	}, nil
+}
+
+func init() {
+	Register(Definition{
+		Name:        "pairs",
+		Description: "Trades the spread between two correlated symbols on its rolling z-score",
+		Params: []ParamSpec{
+			{Name: "a", Type: ParamString, Default: "", Description: "first symbol, e.g. BTCUSDT"},
+			{Name: "b", Type: ParamString, Default: "", Description: "second symbol, e.g. ETHUSDT"},
+			{Name: "mode", Type: ParamString, Default: PairsRotation, Description: "rotation (spot, long only) or hedge (long / short)"},
+			{Name: "window", Type: ParamInt, Default: 100, Min: 10, Max: 10000, Description: "bars of the hedge ratio regression"},
+			{Name: "entry_z", Type: ParamFloat, Default: 2.0, Min: 0.1, Max: 10},
+			{Name: "exit_z", Type: ParamFloat, Default: 0.5, Min: 0, Max: 10},
+			{Name: "stop_z", Type: ParamFloat, Default: 4.0, Min: 0, Max: 20, Description: "close when the spread widens past this, 0 = off"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			return NewPairsStrategy(
+				strings.ToUpper(p.String("a")),
+				strings.ToUpper(p.String("b")),
+				p.String("mode"),
+				p.Int("window"),
+				p.Float("entry_z"),
+				p.Float("exit_z"),
+				p.Float("stop_z"),
+			)
+		},
+	})
+}
+
+/* Symbols returns the two legs, A first */
+func (s *PairsStrategy) Symbols() []string {
+	return []string{s.a, s.b}
+}
+
+/* ManagesExits is true, rotations and spread stops exit at any price */
+func (s *PairsStrategy) ManagesExits() bool {
+	return true
+}
+
+/* Shorts reports whether the strategy sells short (hedge mode) */
+func (s *PairsStrategy) Shorts() bool {
+	return s.mode == PairsHedge
+}
+
+/*
+*  Analyze can't trade a pair from a single symbol's data,
+*  the strategy runs through AnalyzeAll
+ */
+func (s *PairsStrategy) Analyze(data *models.MarketData) *models.Signal {
+	return nil
+}
+
+/*
+	AnalyzeAll
+
+*  takes one bar of both legs for the same time. Exits come before
+*  entries in the returned signals, so the cash they free can be
+*  spent by the entries of the same bar.
+*/
+func (s *PairsStrategy) AnalyzeAll(data map[string]*models.MarketData) []*models.Signal {
+	barA, barB := data[s.a], data[s.b]
+	if barA == nil || barB == nil || barA.Price <= 0 || barB.Price <= 0 {
+		return nil
+	}
+	s.pricesA = appendWindow(s.pricesA, math.Log(barA.Price), s.window)
+	s.pricesB = appendWindow(s.pricesB, math.Log(barB.Price), s.window)
+	if len(s.pricesA) < s.window {
+		return nil
+	}
+
+	beta, z, ok := hedgeRatio(s.pricesA, s.pricesB)
+	if !ok {
+		return nil
+	}
+	indicators := map[string]float64{"hedge_ratio": beta, "zscore": z}
+	signal := func(bar *models.MarketData, action, reason string) *models.Signal {
+		return &models.Signal{
+			Symbol:     bar.Symbol,
+			Action:     action,
+			Price:      bar.Price,
+			Timestamp:  bar.Time,
+			Confidence: math.Min(math.Abs(z)/s.stopOrDouble(), 1),
+			Reason:     fmt.Sprintf("pairs %s/%s: %s (z %.2f, beta %.2f)", s.a, s.b, reason, z, beta),
+			Indicators: indicators,
+		}
+	}
+
+	stopped := s.stopZ > 0 && math.Abs(z) >= s.stopZ
+	reverted := math.Abs(z) <= s.exitZ
+	if math.Abs(z) < s.entryZ {
+		s.cooling = false
+	}
+	canEnter := !stopped && !s.cooling
+
+	if s.mode == PairsHedge {
+		switch {
+		case s.hedged != 0 && (stopped || reverted):
+			reason := "spread reverted"
+			if stopped {
+				reason = "spread stop"
+			}
+			long, short := barA, barB
+			if s.hedged < 0 {
+				long, short = barB, barA
+			}
+			s.hedged = 0
+			s.cooling = stopped
+			log.Infof("PAIRS EXIT - %s/%s: %s (z %.2f)", s.a, s.b, reason, z)
+			return []*models.Signal{signal(long, "SELL", reason), signal(short, "COVER", reason)}
+		case s.hedged == 0 && canEnter && z >= s.entryZ:
+			s.hedged = -1
+			log.Infof("PAIRS ENTRY - short %s / long %s (z %.2f, beta %.2f)", s.a, s.b, z, beta)
+			return []*models.Signal{signal(barA, "SHORT", s.a+" rich"), signal(barB, "BUY", s.a+" rich")}
+		case s.hedged == 0 && canEnter && z <= -s.entryZ:
+			s.hedged = 1
+			log.Infof("PAIRS ENTRY - long %s / short %s (z %.2f, beta %.2f)", s.a, s.b, z, beta)
+			return []*models.Signal{signal(barA, "BUY", s.a+" cheap"), signal(barB, "SHORT", s.a+" cheap")}
+		}
+		return nil
+	}
+
+	/* Rotation: which leg should be held right now, "" for cash */
+	want := s.held
+	reason := ""
+	switch {
+	case stopped:
+		want, reason = "", "spread stop"
+		s.cooling = s.held != ""
+	case canEnter && z <= -s.entryZ:
+		want, reason = s.a, s.a+" cheap"
+	case canEnter && z >= s.entryZ:
+		want, reason = s.b, s.a+" rich"
+	case reverted:
+		want, reason = "", "spread reverted"
+	}
+	if want == s.held {
+		return nil
+	}
+
+	var signals []*models.Signal
+	if s.held != "" {
+		signals = append(signals, signal(data[s.held], "SELL", reason))
+	}
+	if want != "" {
+		signals = append(signals, signal(data[want], "BUY", reason))
+	}
+	log.Infof("PAIRS ROTATION - %s/%s: %s -> %s, %s (z %.2f)", s.a, s.b, legName(s.held), legName(want), reason, z)
+	s.held = want
+	return signals
+}
+
+/* stopOrDouble scales confidence, reaching 1 at the stop */
+func (s *PairsStrategy) stopOrDouble() float64 {
+	if s.stopZ > 0 {
+		return s.stopZ
+	}
+	return 2 * s.entryZ
+}
+
+func legName(symbol string) string {
+	if symbol == "" {
+		return "cash"
+	}
+	return symbol
+}
+
+func appendWindow(values []float64, v float64, size int) []float64 {
+	values = append(values, v)
+	if len(values) > size {
+		values = values[len(values)-size:]
+	}
+	return values
+}
+
+/*
+	hedgeRatio
+
+*  regresses y on x by least squares and returns the slope and the
+*  z-score of the last residual. ok is false for a flat series.
+*/
+func hedgeRatio(y, x []float64) (beta, z float64, ok bool) {
+	n := float64(len(y))
+	var meanX, meanY float64
+	for i := range y {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var cov, varX float64
+	for i := range y {
+		cov += (x[i] - meanX) * (y[i] - meanY)
+		varX += (x[i] - meanX) * (x[i] - meanX)
+	}
+	if varX == 0 {
+		return 0, 0, false
+	}
+	beta = cov / varX
+	alpha := meanY - beta*meanX
+
+	/* Residuals have mean 0 by construction */
+	var ss float64
+	for i := range y {
+		r := y[i] - alpha - beta*x[i]
+		ss += r * r
+	}
+	std := math.Sqrt(ss / n)
+	if std == 0 {
+		return beta, 0, false
+	}
+	last := len(y) - 1
+	return beta, (y[last] - alpha - beta*x[last]) / std, true
+}
+
+/* pairsState is the persisted window and position */
+type pairsState struct {
+	LogA    []float64 `json:"log_a"`
+	LogB    []float64 `json:"log_b"`
+	Held    string    `json:"held,omitempty"`
+	Hedged  int       `json:"hedged,omitempty"`
+	Cooling bool      `json:"cooling,omitempty"`
+}
+
+/* MarshalState snapshots the price window and the legs held */
+func (s *PairsStrategy) MarshalState() ([]byte, error) {
+	return json.Marshal(pairsState{LogA: s.pricesA, LogB: s.pricesB, Held: s.held, Hedged: s.hedged, Cooling: s.cooling})
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *PairsStrategy) UnmarshalState(data []byte) error {
+	var state pairsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if len(state.LogA) != len(state.LogB) {
+		return fmt.Errorf("pairs state has %d and %d prices", len(state.LogA), len(state.LogB))
+	}
+	if state.Held != "" && state.Held != s.a && state.Held != s.b {
+		return fmt.Errorf("pairs state holds %s, not a leg of %s/%s", state.Held, s.a, s.b)
+	}
+	s.pricesA, s.pricesB = state.LogA, state.LogB
+	s.held, s.hedged, s.cooling = state.Held, state.Hedged, state.Cooling
+	return nil
+}
@@ -0,0 +1,69 @@
+package strategy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func TestHedgeRatio(t *testing.T) {
+	var x, y []float64
+	for i := 0; i < 200; i++ {
+		xi := math.Log(100 + 10*math.Sin(float64(i)/7))
+		x = append(x, xi)
+		y = append(y, 0.5+1.5*xi+0.001*math.Sin(float64(i)*1.3))
+	}
+	beta, _, ok := hedgeRatio(y, x)
+	if !ok || math.Abs(beta-1.5) > 0.01 {
+		t.Errorf("Expected hedge ratio near 1.5, got %.4f (ok %v)", beta, ok)
+	}
+
+	/* Push the last y far above the fit */
+	y[len(y)-1] += 0.05
+	if _, z, _ := hedgeRatio(y, x); z < 3 {
+		t.Errorf("Expected a large positive z-score, got %.2f", z)
+	}
+}
+
+func TestPairsRotation(t *testing.T) {
+	s, err := NewFromSpec("pairs{a: btcusdt, b: ETHUSDT, window: 50, entry_z: 2, exit_z: 0.5, stop_z: 0}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pairs := s.(MultiSymbol)
+
+	bar := func(i int, priceA, priceB float64) map[string]*models.MarketData {
+		now := time.Unix(int64(i)*60, 0)
+		return map[string]*models.MarketData{
+			"BTCUSDT": {Symbol: "BTCUSDT", Price: priceA, Time: now},
+			"ETHUSDT": {Symbol: "ETHUSDT", Price: priceB, Time: now},
+		}
+	}
+
+	/* A tracks B closely while the window fills */
+	i := 0
+	for ; i < 60; i++ {
+		b := 100 + 10*math.Sin(float64(i)/5)
+		if signals := pairs.AnalyzeAll(bar(i, 2*b*(1+0.002*math.Sin(float64(i)*1.7)), b)); len(signals) > 0 {
+			t.Fatalf("Unexpected signals while the spread is normal: %v", signals[0].Reason)
+		}
+	}
+
+	/* A drops against B: buy A */
+	signals := pairs.AnalyzeAll(bar(i, 2*100*0.95, 100))
+	if len(signals) != 1 || signals[0].Symbol != "BTCUSDT" || signals[0].Action != "BUY" {
+		t.Fatalf("Expected BUY BTCUSDT, got %+v", signals)
+	}
+	if signals[0].Indicators["zscore"] > -2 {
+		t.Errorf("Expected z-score below -2, got %.2f", signals[0].Indicators["zscore"])
+	}
+
+	/* A jumps above B: rotate out of A into B, exit first */
+	signals = pairs.AnalyzeAll(bar(i+1, 2*100*1.08, 100))
+	if len(signals) != 2 || signals[0].Action != "SELL" || signals[0].Symbol != "BTCUSDT" ||
+		signals[1].Action != "BUY" || signals[1].Symbol != "ETHUSDT" {
+		t.Fatalf("Expected SELL BTCUSDT then BUY ETHUSDT, got %+v", signals)
+	}
+}
@@ -0,0 +1,242 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
+)
+
+/*
+	RegimeSwitchStrategy
+
+*  What is a Regime Switch Strategy?
+*
+*  A composite strategy that classifies the market regime every bar
+*  and routes entries to the strategy made for it: mean reversion
+*  while ranging, trend following while trending. In high volatility
+*  it stays out unless a strategy is configured for it.
+*
+*  Every child sees every bar so its indicators stay warm. Only the
+*  active child may enter. The child that entered last owns the
+*  position and its exits go through even after the regime changed,
+*  exits from the other children are ignored.
+*/
+type RegimeSwitchStrategy struct {
+	config    regime.Config
+	ranging   Strategy
+	trending  Strategy
+	highVol   Strategy
+	detectors map[string]*regime.Detector
+	owners    map[string]int // Index into Children() of the child holding the position
+}
+
+/*
+*  RegimeReporter is implemented by strategies that classify the
+*  market regime themselves
+ */
+type RegimeReporter interface {
+	Regime(symbol string) regime.Snapshot
+}
+
+func NewRegimeSwitchStrategy(config regime.Config, ranging, trending, highVol Strategy) *RegimeSwitchStrategy {
+	return &RegimeSwitchStrategy{
+		config:    config,
+		ranging:   ranging,
+		trending:  trending,
+		highVol:   highVol,
+		detectors: make(map[string]*regime.Detector),
+		owners:    make(map[string]int),
+	}
+}
+
+func init() {
+	defaults := regime.DefaultConfig()
+	Register(Definition{
+		Name:        "regime_switch",
+		Description: "Classifies the market regime and trades mean reversion in ranges, a trend strategy in trends",
+		Params: []ParamSpec{
+			{Name: "ranging", Type: ParamString, Default: "mean_reversion", Description: "strategy spec for ranging markets"},
+			{Name: "trending", Type: ParamString, Default: "ema_cross", Description: "strategy spec for trending markets"},
+			{Name: "high_volatility", Type: ParamString, Default: "", Description: "strategy spec for high volatility, empty = no entries"},
+			{Name: "adx_period", Type: ParamInt, Default: defaults.ADXPeriod, Min: 2, Max: 200},
+			{Name: "adx_trend", Type: ParamFloat, Default: defaults.ADXTrend, Min: 0, Max: 100, Description: "ADX at or above this is a trend"},
+			{Name: "atr_period", Type: ParamInt, Default: defaults.ATRPeriod, Min: 2, Max: 200},
+			{Name: "atr_window", Type: ParamInt, Default: defaults.ATRWindow, Min: 10, Max: 10000, Description: "bars the ATR percentile is ranked over"},
+			{Name: "vol_percentile", Type: ParamFloat, Default: defaults.HighVolPercentile, Min: 50, Max: 100, Description: "ATR percentile that counts as high volatility"},
+			{Name: "ma_period", Type: ParamInt, Default: defaults.MAPeriod, Min: 2, Max: 1000},
+			{Name: "slope_bars", Type: ParamInt, Default: defaults.SlopeBars, Min: 1, Max: 1000},
+			{Name: "slope_min", Type: ParamFloat, Default: defaults.SlopeMin, Min: 0, Max: 100, Description: "min MA slope in % per bar for a trend"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			s := NewRegimeSwitchStrategy(regime.Config{
+				ADXPeriod:         p.Int("adx_period"),
+				ADXTrend:          p.Float("adx_trend"),
+				ATRPeriod:         p.Int("atr_period"),
+				ATRWindow:         p.Int("atr_window"),
+				HighVolPercentile: p.Float("vol_percentile"),
+				MAPeriod:          p.Int("ma_period"),
+				SlopeBars:         p.Int("slope_bars"),
+				SlopeMin:          p.Float("slope_min"),
+			}, nil, nil, nil)
+
+			for _, slot := range []struct {
+				param  string
+				target *Strategy
+			}{
+				{"ranging", &s.ranging},
+				{"trending", &s.trending},
+				{"high_volatility", &s.highVol},
+			} {
+				spec := p.String(slot.param)
+				if spec == "" {
+					if slot.param != "high_volatility" {
+						return nil, fmt.Errorf("%s: a strategy is required", slot.param)
+					}
+					continue
+				}
+				child, err := NewFromSpec(spec)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", slot.param, err)
+				}
+				*slot.target = child
+			}
+			return s, nil
+		},
+	})
+}
+
+/* Children returns the wrapped strategies: ranging, trending and high volatility if set */
+func (s *RegimeSwitchStrategy) Children() []Strategy {
+	children := []Strategy{s.ranging, s.trending}
+	if s.highVol != nil {
+		children = append(children, s.highVol)
+	}
+	return children
+}
+
+/* Regime returns the latest regime reading for a symbol */
+func (s *RegimeSwitchStrategy) Regime(symbol string) regime.Snapshot {
+	if d, ok := s.detectors[symbol]; ok {
+		return d.Current()
+	}
+	return regime.Snapshot{}
+}
+
+/* active returns the strategy allowed to enter in a regime, nil for none */
+func (s *RegimeSwitchStrategy) active(r regime.Regime) Strategy {
+	switch {
+	case r == regime.Ranging:
+		return s.ranging
+	case r.Trending():
+		return s.trending
+	case r == regime.HighVolatility:
+		return s.highVol
+	}
+	return nil
+}
+
+/*
+* Analyze market data
+ */
+func (s *RegimeSwitchStrategy) Analyze(data *models.MarketData) *models.Signal {
+	d, ok := s.detectors[data.Symbol]
+	if !ok {
+		d = regime.NewDetector(s.config)
+		s.detectors[data.Symbol] = d
+	}
+	previous := d.Current().Regime
+	high, low := data.HighLow()
+	current := d.Update(high, low, data.Price)
+	if current != previous {
+		log.Infof("%s regime changed: %s -> %s", data.Symbol, previous, current)
+	}
+	active := s.active(current)
+
+	var result *models.Signal
+	owner, owned := s.owners[data.Symbol]
+	for i, child := range s.Children() {
+		signal := Analyze(child, data)
+		if signal == nil || result != nil {
+			continue
+		}
+		switch signal.Action {
+		case "BUY":
+			if child != active {
+				continue
+			}
+			s.owners[data.Symbol] = i
+		case "SELL":
+			if owned && owner != i {
+				continue
+			}
+			/* A sized sell may only trim the position */
+			if signal.Quantity == 0 {
+				delete(s.owners, data.Symbol)
+			}
+		}
+		result = signal
+	}
+	if result == nil {
+		return nil
+	}
+
+	snapshot := d.Current()
+	if result.Indicators == nil {
+		result.Indicators = make(map[string]float64)
+	}
+	result.Indicators["regime_adx"] = snapshot.ADX
+	result.Indicators["regime_atr_percentile"] = snapshot.ATRPercentile
+	result.Indicators["regime_ma_slope"] = snapshot.Slope
+	result.Reason = fmt.Sprintf("[%s] %s", current, result.Reason)
+	return result
+}
+
+/* regimeSwitchSnapshot holds the children's state and position owners, detectors warm up again */
+type regimeSwitchSnapshot struct {
+	Members []json.RawMessage `json:"members"`
+	Owners  map[string]int    `json:"owners"`
+}
+
+/* MarshalState snapshots every stateful child */
+func (s *RegimeSwitchStrategy) MarshalState() ([]byte, error) {
+	members, err := marshalChildren(s.Children())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(regimeSwitchSnapshot{Members: members, Owners: s.owners})
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *RegimeSwitchStrategy) UnmarshalState(data []byte) error {
+	var snapshot regimeSwitchSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if err := unmarshalChildren(s.Children(), snapshot.Members); err != nil {
+		return err
+	}
+	s.owners = make(map[string]int)
+	for symbol, owner := range snapshot.Owners {
+		if owner >= 0 && owner < len(s.Children()) {
+			s.owners[symbol] = owner
+		}
+	}
+	return nil
+}
+
+/*
+	FindRegimeReporter
+
+*  returns the first strategy inside s that classifies the regime
+*/
+func FindRegimeReporter(s Strategy) RegimeReporter {
+	var reporter RegimeReporter
+	Walk(s, func(child Strategy) {
+		if r, ok := child.(RegimeReporter); ok && reporter == nil {
+			reporter = r
+		}
+	})
+	return reporter
+}
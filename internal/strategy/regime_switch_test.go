@@ -0,0 +1,47 @@
+package strategy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
+)
+
+func TestRegimeSwitchRouting(t *testing.T) {
+	/* Children signal by bar, 1 based */
+	ranging := &scriptedStub{actions: map[int]string{5: "BUY", 16: "BUY", 33: "SELL", 37: "BUY"}}
+	trending := &scriptedStub{actions: map[int]string{21: "BUY", 31: "SELL", 36: "BUY"}}
+	s := NewRegimeSwitchStrategy(regime.Config{
+		ADXPeriod: 3, ADXTrend: 25, ATRPeriod: 3, ATRWindow: 10, HighVolPercentile: 100,
+		MAPeriod: 5, SlopeBars: 2, SlopeMin: 0.1,
+	}, ranging, trending, nil)
+
+	/* 30 flat bars range, then a climb of 1.5% a bar trends */
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 100+0.05*float64(i%2))
+	}
+	for i := 1; i <= 15; i++ {
+		closes = append(closes, 100+1.5*float64(i))
+	}
+	signals := signalsOver(s, candleBars(closes...))
+
+	/*
+	* Dropped: the BUY before the detector is ready, the trend BUY while
+	* ranging, the trend SELL of the ranging child's position and the
+	* ranging BUY in the trend. The owner's SELL goes through in the trend.
+	 */
+	want := map[int]string{15: "[ranging] BUY", 32: "[trending_up] SELL", 35: "[trending_up] BUY"}
+	if len(signals) != len(want) {
+		t.Errorf("Expected %d signals, got %v", len(want), signals)
+	}
+	for bar, expected := range want {
+		signal := signals[bar]
+		if signal == nil || !strings.HasPrefix(signal.Reason, strings.Fields(expected)[0]) || signal.Action != strings.Fields(expected)[1] {
+			t.Errorf("Bar %d: expected %s, got %+v", bar, expected, signal)
+		}
+	}
+	if s.Regime("BTCUSDT").Regime != regime.TrendingUp {
+		t.Errorf("Expected the climb to end trending up, got %s", s.Regime("BTCUSDT").Regime)
+	}
+}
@@ -0,0 +1,310 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	Strategy Registry
+
+*  Strategies register themselves by name together with a typed
+*  parameter schema. The bot and the backtester build strategies
+*  from a spec string such as `mean_reversion{rsi_period: 14}`,
+*  so an unknown name or a bad parameter fails at startup instead
+*  of in the middle of a trading loop.
+*/
+
+/* ParamType is the type of a strategy parameter */
+type ParamType int
+
+const (
+	ParamInt ParamType = iota
+	ParamFloat
+	ParamBool
+	ParamString
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamInt:
+		return "int"
+	case ParamFloat:
+		return "float"
+	case ParamBool:
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+/*
+	ParamSpec
+
+*  describes a single strategy parameter. Min and Max are only
+*  checked for numeric parameters and only when they differ.
+*/
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Default     interface{}
+	Min         float64
+	Max         float64
+	Description string
+}
+
+/* Params holds validated parameter values keyed by name */
+type Params map[string]interface{}
+
+func (p Params) Int(name string) int {
+	v, _ := p[name].(int)
+	return v
+}
+
+func (p Params) Float(name string) float64 {
+	v, _ := p[name].(float64)
+	return v
+}
+
+func (p Params) Bool(name string) bool {
+	v, _ := p[name].(bool)
+	return v
+}
+
+func (p Params) String(name string) string {
+	v, _ := p[name].(string)
+	return v
+}
+
+/* Factory builds a strategy from validated parameters */
+type Factory func(params Params) (Strategy, error)
+
+/* Definition is a registered strategy */
+type Definition struct {
+	Name        string
+	Description string
+	Params      []ParamSpec
+	Factory     Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Definition)
+)
+
+/*
+	Register
+
+*  adds a strategy definition to the registry.
+*  Meant to be called from init(), so it panics on programmer errors
+*  such as duplicate names or defaults that don't match their type.
+*/
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.Name == "" || def.Factory == nil {
+		panic("strategy: Register requires a name and a factory")
+	}
+	if _, exists := registry[def.Name]; exists {
+		panic(fmt.Sprintf("strategy: %q registered twice", def.Name))
+	}
+	for _, spec := range def.Params {
+		if _, err := spec.coerce(spec.Default); err != nil {
+			panic(fmt.Sprintf("strategy: %q default for %q: %v", def.Name, spec.Name, err))
+		}
+	}
+	registry[def.Name] = def
+}
+
+/*
+	Lookup
+
+*  returns the definition registered under name
+*/
+func Lookup(name string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+/*
+	Names
+
+*  returns the sorted names of all registered strategies
+*/
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+	New
+
+*  builds a registered strategy from raw string parameters
+*/
+func New(name string, raw map[string]string) (Strategy, error) {
+	def, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	params, err := def.Validate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %s: %v", name, err)
+	}
+	s, err := def.Factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %s: %v", name, err)
+	}
+	return s, nil
+}
+
+/*
+	NewFromSpec
+
+*  parses a spec string like `mean_reversion{rsi_period: 14}`
+*  and builds the strategy it describes
+*/
+func NewFromSpec(spec string) (Strategy, error) {
+	parsed, err := ParseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return New(parsed.Name, parsed.Params)
+}
+
+/*
+	Validate
+
+*  checks raw parameters against the schema and fills in defaults
+*/
+func (d Definition) Validate(raw map[string]string) (Params, error) {
+	known := make(map[string]ParamSpec, len(d.Params))
+	for _, spec := range d.Params {
+		known[spec.Name] = spec
+	}
+	for key := range raw {
+		if _, ok := known[key]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+
+	params := make(Params, len(d.Params))
+	for _, spec := range d.Params {
+		value := spec.Default
+		if s, ok := raw[spec.Name]; ok {
+			parsed, err := spec.parse(s)
+			if err != nil {
+				return nil, err
+			}
+			value = parsed
+		}
+		value, err := spec.coerce(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := spec.checkRange(value); err != nil {
+			return nil, err
+		}
+		params[spec.Name] = value
+	}
+	return params, nil
+}
+
+func (s ParamSpec) parse(raw string) (interface{}, error) {
+	switch s.Type {
+	case ParamInt:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: expected int, got %q", s.Name, raw)
+		}
+		return v, nil
+	case ParamFloat:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: expected float, got %q", s.Name, raw)
+		}
+		return v, nil
+	case ParamBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: expected bool, got %q", s.Name, raw)
+		}
+		return v, nil
+	default:
+		return raw, nil
+	}
+}
+
+/* coerce normalises Go literal defaults (e.g. 14 for a float param) */
+func (s ParamSpec) coerce(value interface{}) (interface{}, error) {
+	switch s.Type {
+	case ParamInt:
+		if v, ok := value.(int); ok {
+			return v, nil
+		}
+	case ParamFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		}
+	case ParamBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case ParamString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("parameter %q: expected %s, got %T", s.Name, s.Type, value)
+}
+
+func (s ParamSpec) checkRange(value interface{}) error {
+	if s.Min == s.Max {
+		return nil
+	}
+	var v float64
+	switch n := value.(type) {
+	case int:
+		v = float64(n)
+	case float64:
+		v = n
+	default:
+		return nil
+	}
+	if v < s.Min || v > s.Max {
+		return fmt.Errorf("parameter %q: %v out of range [%v, %v]", s.Name, value, s.Min, s.Max)
+	}
+	return nil
+}
+
+/*
+	NewForPairs
+
+*  builds one strategy instance per trading pair,
+*  specFor returns the spec configured for a pair
+*/
+func NewForPairs(pairs []string, specFor func(pair string) string) (map[string]Strategy, error) {
+	strategies := make(map[string]Strategy, len(pairs))
+	for _, pair := range pairs {
+		s, err := NewFromSpec(specFor(pair))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pair, err)
+		}
+		strategies[pair] = s
+	}
+	return strategies, nil
+}
@@ -0,0 +1,51 @@
+package strategy
+
+import (
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec("mean_reversion{rsi_period: 14, oversold: 35}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.Name != "mean_reversion" {
+		t.Errorf("Expected name mean_reversion, got %q", spec.Name)
+	}
+	if spec.Params["rsi_period"] != "14" || spec.Params["oversold"] != "35" {
+		t.Errorf("Unexpected params %v", spec.Params)
+	}
+
+	nested, err := ParseSpec("outer{members: [a{x: 1, y: 2}, b], mode: majority}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nested.Params["members"] != "[a{x: 1, y: 2}, b]" {
+		t.Errorf("Nested value not kept intact: %q", nested.Params["members"])
+	}
+
+	for _, bad := range []string{"", "mean reversion", "x{a 1}", "x{a: 1", "x{a: 1, a: 2}"} {
+		if _, err := ParseSpec(bad); err == nil {
+			t.Errorf("Expected error for spec %q", bad)
+		}
+	}
+}
+
+func TestNewFromSpecValidation(t *testing.T) {
+	if _, err := NewFromSpec("mean_reversion{rsi_period: 14}"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	bad := []string{
+		"does_not_exist",
+		"mean_reversion{unknown: 1}",
+		"mean_reversion{rsi_period: fourteen}",
+		"mean_reversion{rsi_period: 1}",
+		"mean_reversion{oversold: 70, overbought: 30}",
+	}
+	for _, spec := range bad {
+		if _, err := NewFromSpec(spec); err == nil {
+			t.Errorf("Expected error for spec %q", spec)
+		}
+	}
+}
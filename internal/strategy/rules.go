@@ -0,0 +1,196 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+	"github.com/marwanbukhori/player-cryptobot/internal/rules"
+)
+
+/*
+	RulesStrategy
+
+*  What is a Rules Strategy?
+*
+*  A strategy written as entry / exit rules instead of Go code, e.g.
+*
+*    entry: rsi(14) < 30 and close < bb_lower(20, 2)
+*    exit:  rsi(14) > 70 or profit_pct > 3
+*
+*  Rules come from a YAML or expression file (see internal/rules)
+*  or inline params, and are validated when the strategy is built.
+*  It buys when the entry rule holds while flat and sells when the
+*  exit rule holds while in a trade. Optional stop_loss and
+*  take_profit rules set the exit levels of each buy.
+*/
+type RulesStrategy struct {
+	set    *rules.RuleSet
+	states map[string]*rulesState
+}
+
+type rulesState struct {
+	eval        *rules.Evaluator
+	entryPrice  float64
+	barsInTrade int
+}
+
+func NewRulesStrategy(set *rules.RuleSet) *RulesStrategy {
+	return &RulesStrategy{
+		set:    set,
+		states: make(map[string]*rulesState),
+	}
+}
+
+func init() {
+	Register(Definition{
+		Name:        "rules",
+		Description: "Trades entry / exit rules loaded from a YAML or expression file",
+		Params: []ParamSpec{
+			{Name: "file", Type: ParamString, Default: "", Description: "rule file (.yaml, .yml or expression file)"},
+			{Name: "entry", Type: ParamString, Default: "", Description: "inline entry rule, instead of a file"},
+			{Name: "exit", Type: ParamString, Default: "", Description: "inline exit rule"},
+			{Name: "stop_loss", Type: ParamString, Default: "", Description: "inline stop-loss price rule"},
+			{Name: "take_profit", Type: ParamString, Default: "", Description: "inline take-profit price rule"},
+		},
+		Factory: func(p Params) (Strategy, error) {
+			inline := rules.Source{
+				Entry:      p.String("entry"),
+				Exit:       p.String("exit"),
+				StopLoss:   p.String("stop_loss"),
+				TakeProfit: p.String("take_profit"),
+			}
+			hasInline := inline.Entry != "" || inline.Exit != "" || inline.StopLoss != "" || inline.TakeProfit != ""
+
+			var set *rules.RuleSet
+			var err error
+			switch {
+			case p.String("file") != "" && hasInline:
+				return nil, fmt.Errorf("set either file or inline rules, not both")
+			case p.String("file") != "":
+				set, err = rules.Load(p.String("file"))
+			default:
+				inline.Name = "inline"
+				set, err = inline.Compile()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return NewRulesStrategy(set), nil
+		},
+	})
+}
+
+/* ManagesExits is true, the exit rule fires at any price */
+func (s *RulesStrategy) ManagesExits() bool {
+	return true
+}
+
+func (s *RulesStrategy) state(symbol string) *rulesState {
+	st, ok := s.states[symbol]
+	if !ok {
+		st = &rulesState{eval: rules.NewEvaluator(s.set.Entry, s.set.Exit, s.set.StopLoss, s.set.TakeProfit)}
+		s.states[symbol] = st
+	}
+	return st
+}
+
+/*
+* Analyze market data
+ */
+func (s *RulesStrategy) Analyze(data *models.MarketData) *models.Signal {
+	st := s.state(data.Symbol)
+	high, low := data.HighLow()
+	open := data.Open
+	if open == 0 {
+		open = data.Price
+	}
+
+	/* The open position decides whether it is in a trade: a skipped buy
+	*  never opens one, the bot's stop-loss or take-profit closes it
+	 */
+	switch {
+	case data.Position == nil:
+		st.entryPrice, st.barsInTrade = 0, 0
+	case st.entryPrice == 0:
+		st.entryPrice = data.Position.AverageCost
+		fallthrough
+	default:
+		st.barsInTrade++
+	}
+	st.eval.Update(rules.Bar{Open: open, High: high, Low: low, Close: data.Price, Volume: data.Volume},
+		rules.Position{EntryPrice: st.entryPrice, BarsInTrade: st.barsInTrade})
+
+	/* Evaluate both conditions every bar so crosses see the previous bar */
+	entry := st.eval.Condition(s.set.Entry)
+	exit := s.set.Exit != nil && st.eval.Condition(s.set.Exit)
+
+	signal := &models.Signal{
+		Symbol:     data.Symbol,
+		Price:      data.Price,
+		Timestamp:  data.Time,
+		Confidence: 1,
+		Indicators: st.eval.Values(),
+	}
+
+	if st.entryPrice > 0 {
+		if !exit {
+			return nil
+		}
+		signal.Action = "SELL"
+		signal.Reason = fmt.Sprintf("%s exit: %s", s.set.Name, s.set.Source.Exit)
+		signal.Indicators["profit_pct"] = (data.Price - st.entryPrice) / st.entryPrice * 100
+		st.entryPrice, st.barsInTrade = 0, 0
+		log.Infof("SELL SIGNAL - %s: %s", data.Symbol, signal.Reason)
+		return signal
+	}
+
+	if !entry {
+		return nil
+	}
+	signal.Action = "BUY"
+	signal.Reason = fmt.Sprintf("%s entry: %s", s.set.Name, s.set.Source.Entry)
+	if s.set.StopLoss != nil {
+		if level := st.eval.Level(s.set.StopLoss); !math.IsNaN(level) && level > 0 && level < data.Price {
+			signal.StopLoss = level
+		}
+	}
+	if s.set.TakeProfit != nil {
+		if level := st.eval.Level(s.set.TakeProfit); !math.IsNaN(level) && level > data.Price {
+			signal.TakeProfit = level
+		}
+	}
+	log.Infof("BUY SIGNAL - %s: %s (stop %.2f, target %.2f)", data.Symbol, signal.Reason, signal.StopLoss, signal.TakeProfit)
+	return signal
+}
+
+/* rulesPosition is the persisted trade of one symbol */
+type rulesPosition struct {
+	EntryPrice  float64 `json:"entry_price"`
+	BarsInTrade int     `json:"bars_in_trade"`
+}
+
+/* MarshalState snapshots open trades, the indicators warm up again */
+func (s *RulesStrategy) MarshalState() ([]byte, error) {
+	positions := make(map[string]rulesPosition)
+	for symbol, st := range s.states {
+		if st.entryPrice > 0 {
+			positions[symbol] = rulesPosition{EntryPrice: st.entryPrice, BarsInTrade: st.barsInTrade}
+		}
+	}
+	return json.Marshal(positions)
+}
+
+/* UnmarshalState restores a snapshot taken by MarshalState */
+func (s *RulesStrategy) UnmarshalState(data []byte) error {
+	var positions map[string]rulesPosition
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return err
+	}
+	for symbol, position := range positions {
+		st := s.state(symbol)
+		st.entryPrice, st.barsInTrade = position.EntryPrice, position.BarsInTrade
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+	Spec
+
+*  a strategy name plus raw parameters, parsed from text like
+*  `mean_reversion{rsi_period: 14, oversold: 35}`.
+*  Values may contain nested braces or brackets, which lets
+*  composite strategies carry child specs as a single parameter.
+*/
+type Spec struct {
+	Name   string
+	Params map[string]string
+}
+
+func (s Spec) String() string {
+	if len(s.Params) == 0 {
+		return s.Name
+	}
+	keys := make([]string, 0, len(s.Params))
+	for k := range s.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + ": " + s.Params[k]
+	}
+	return s.Name + "{" + strings.Join(parts, ", ") + "}"
+}
+
+/*
+	ParseSpec
+
+*  parses a single strategy spec
+*/
+func ParseSpec(text string) (Spec, error) {
+	text = strings.TrimSpace(text)
+	spec := Spec{Params: make(map[string]string)}
+
+	open := strings.IndexByte(text, '{')
+	if open < 0 {
+		spec.Name = text
+		if !validName(spec.Name) {
+			return Spec{}, fmt.Errorf("invalid strategy spec %q", text)
+		}
+		return spec, nil
+	}
+
+	spec.Name = strings.TrimSpace(text[:open])
+	if !validName(spec.Name) {
+		return Spec{}, fmt.Errorf("invalid strategy name in spec %q", text)
+	}
+	if !strings.HasSuffix(text, "}") {
+		return Spec{}, fmt.Errorf("unterminated parameters in spec %q", text)
+	}
+
+	body := text[open+1 : len(text)-1]
+	parts, err := splitTopLevel(body, ',')
+	if err != nil {
+		return Spec{}, fmt.Errorf("spec %q: %v", text, err)
+	}
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		colon := strings.IndexByte(part, ':')
+		if colon < 0 {
+			return Spec{}, fmt.Errorf("spec %q: expected key: value, got %q", text, part)
+		}
+		key := strings.TrimSpace(part[:colon])
+		value := unquote(strings.TrimSpace(part[colon+1:]))
+		if !validName(key) {
+			return Spec{}, fmt.Errorf("spec %q: invalid parameter name %q", text, key)
+		}
+		if _, dup := spec.Params[key]; dup {
+			return Spec{}, fmt.Errorf("spec %q: parameter %q given twice", text, key)
+		}
+		spec.Params[key] = value
+	}
+	return spec, nil
+}
+
+/*
+	ParseSpecList
+
+*  parses a comma separated list of specs, optionally wrapped in [ ]
+*/
+func ParseSpecList(text string) ([]Spec, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+		text = text[1 : len(text)-1]
+	}
+	parts, err := splitTopLevel(text, ',')
+	if err != nil {
+		return nil, err
+	}
+	var specs []Spec
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		spec, err := ParseSpec(part)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+/* splitTopLevel splits on sep, ignoring separators nested in {}, [] or quotes */
+func splitTopLevel(text string, sep byte) ([]string, error) {
+	var parts []string
+	depth := 0
+	inQuote := false
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %q", c)
+			}
+		case c == sep && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	if depth != 0 || inQuote {
+		return nil, fmt.Errorf("unbalanced brackets or quotes")
+	}
+	return append(parts, text[start:]), nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
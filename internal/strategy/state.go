@@ -0,0 +1,132 @@
+package strategy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+	StatefulStrategy
+
+*  is implemented by strategies whose memory matters across
+*  restarts, e.g. entry prices and indicator buffers. The state
+*  is an opaque blob, strategies use JSON.
+*/
+type StatefulStrategy interface {
+	MarshalState() ([]byte, error)
+	UnmarshalState(data []byte) error
+}
+
+/*
+*  StateStore persists strategy state per trading pair. The spec the
+*  state was produced by is stored with it, so a reconfigured
+*  strategy never resumes from state that isn't its own.
+ */
+type StateStore interface {
+	LoadStrategyState(symbol string, spec string) ([]byte, error) // nil when nothing matching is stored
+	SaveStrategyState(symbol string, spec string, state []byte) error
+}
+
+/*
+	SaveStates
+
+*  stores the state of every stateful strategy, specFor returns
+*  the spec each pair's strategy was built from
+*/
+func SaveStates(strategies map[string]Strategy, specFor func(string) string, store StateStore) error {
+	for pair, s := range strategies {
+		stateful, ok := s.(StatefulStrategy)
+		if !ok {
+			continue
+		}
+		state, err := stateful.MarshalState()
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s strategy state: %v", pair, err)
+		}
+		if err := store.SaveStrategyState(pair, specFor(pair), state); err != nil {
+			return fmt.Errorf("failed to save %s strategy state: %v", pair, err)
+		}
+	}
+	return nil
+}
+
+/*
+	RestoreStates
+
+*  loads stored state into every stateful strategy and returns
+*  the pairs that resumed. Strategies without stored state start fresh.
+*  A pair whose state fails to load or restore is skipped and starts
+*  fresh, the others still resume. The error combines every failure
+*  for the caller to log.
+*/
+func RestoreStates(strategies map[string]Strategy, specFor func(string) string, store StateStore) ([]string, error) {
+	pairs := make([]string, 0, len(strategies))
+	for pair := range strategies {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	var restored []string
+	var errs []error
+	for _, pair := range pairs {
+		stateful, ok := strategies[pair].(StatefulStrategy)
+		if !ok {
+			continue
+		}
+		state, err := store.LoadStrategyState(pair, specFor(pair))
+		if err == nil && state == nil {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to load %s strategy state: %v", pair, err)
+		} else if err = stateful.UnmarshalState(state); err != nil {
+			err = fmt.Errorf("failed to restore %s strategy state: %v", pair, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		restored = append(restored, pair)
+	}
+	return restored, errors.Join(errs...)
+}
+
+/*
+	marshalChildren / unmarshalChildren
+
+*  helpers for composites, the state of child i is stored at index i
+*  and is null for children that keep no state
+*/
+func marshalChildren(children []Strategy) ([]json.RawMessage, error) {
+	states := make([]json.RawMessage, len(children))
+	for i, child := range children {
+		stateful, ok := child.(StatefulStrategy)
+		if !ok {
+			continue
+		}
+		state, err := stateful.MarshalState()
+		if err != nil {
+			return nil, fmt.Errorf("member %d: %v", i+1, err)
+		}
+		states[i] = state
+	}
+	return states, nil
+}
+
+func unmarshalChildren(children []Strategy, states []json.RawMessage) error {
+	if len(states) != len(children) {
+		return fmt.Errorf("state has %d members, strategy has %d", len(states), len(children))
+	}
+	for i, child := range children {
+		stateful, ok := child.(StatefulStrategy)
+		if !ok || len(states[i]) == 0 || string(states[i]) == "null" {
+			continue
+		}
+		if err := stateful.UnmarshalState(states[i]); err != nil {
+			return fmt.Errorf("member %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
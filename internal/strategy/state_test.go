@@ -0,0 +1,54 @@
+package strategy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* memoryStateStore keeps states in memory, failing the loads of broken pairs */
+type memoryStateStore struct {
+	states map[string][]byte
+	broken map[string]bool
+}
+
+func (m *memoryStateStore) LoadStrategyState(symbol string, spec string) ([]byte, error) {
+	if m.broken[symbol] {
+		return nil, fmt.Errorf("disk on fire")
+	}
+	return m.states[symbol], nil
+}
+
+func (m *memoryStateStore) SaveStrategyState(symbol string, spec string, state []byte) error {
+	m.states[symbol] = state
+	return nil
+}
+
+func TestRestoreStatesContinuesPastFailures(t *testing.T) {
+	saved := NewMeanReversionStrategy()
+	for _, price := range []float64{100, 99, 98, 96, 95, 93, 92, 94, 97, 99} {
+		saved.Analyze(&models.MarketData{Symbol: "ETHUSDT", Price: price})
+	}
+	store := &memoryStateStore{states: make(map[string][]byte), broken: map[string]bool{"BTCUSDT": true}}
+	specFor := func(string) string { return "mean_reversion" }
+	if err := SaveStates(map[string]Strategy{"ETHUSDT": saved, "XRPUSDT": saved}, specFor, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.states["DOGEUSDT"] = []byte("{not json")
+
+	strategies := map[string]Strategy{
+		"BTCUSDT":  NewMeanReversionStrategy(),
+		"DOGEUSDT": NewMeanReversionStrategy(),
+		"ETHUSDT":  NewMeanReversionStrategy(),
+		"XRPUSDT":  NewMeanReversionStrategy(),
+	}
+	restored, err := RestoreStates(strategies, specFor, store)
+	if strings.Join(restored, ",") != "ETHUSDT,XRPUSDT" {
+		t.Errorf("Expected ETHUSDT and XRPUSDT restored past the failures, got %v", restored)
+	}
+	if err == nil || !strings.Contains(err.Error(), "failed to load BTCUSDT") || !strings.Contains(err.Error(), "failed to restore DOGEUSDT") {
+		t.Errorf("Expected both failures in the error, got %v", err)
+	}
+}
@@ -8,3 +8,155 @@ import (
 type Strategy interface {
 	Analyze(data *models.MarketData) *models.Signal
 }
+
+// Composite is implemented by strategies that wrap other strategies
+type Composite interface {
+	Children() []Strategy
+}
+
+// MultiTimeframe is implemented by strategies that need candles of
+// other intervals, they receive them in MarketData.Frames
+type MultiTimeframe interface {
+	Timeframes() []string
+}
+
+// MultiSymbol is implemented by strategies that trade several symbols
+// together, e.g. pairs trading. AnalyzeAll gets one bar per symbol,
+// all for the same time, and may return signals for any of them.
+// Signals are executed in the order returned.
+type MultiSymbol interface {
+	Strategy
+	Symbols() []string
+	AnalyzeAll(data map[string]*models.MarketData) []*models.Signal
+}
+
+// ShortSeller is implemented by strategies that may sell short,
+// they return SHORT and COVER signals when Shorts is true
+type ShortSeller interface {
+	Shorts() bool
+}
+
+// ExitManager is implemented by strategies that track their own
+// position and sell it at any price when they exit. The bot doesn't
+// hold back their SELLs at a loss, nor take its tiered profits.
+type ExitManager interface {
+	ManagesExits() bool
+}
+
+// Analyze runs s on data and marks the signal ManagesExits when s is
+// an ExitManager. Composites analyze their children through it, so the
+// mark stays with the strategy that gave the signal and not the tree.
+func Analyze(s Strategy, data *models.MarketData) *models.Signal {
+	signal := s.Analyze(data)
+	if signal != nil && managesExits(s) {
+		signal.ManagesExits = true
+	}
+	return signal
+}
+
+// AnalyzeAll is Analyze for a multi-symbol strategy
+func AnalyzeAll(s MultiSymbol, data map[string]*models.MarketData) []*models.Signal {
+	signals := s.AnalyzeAll(data)
+	for _, signal := range signals {
+		if signal != nil && managesExits(s) {
+			signal.ManagesExits = true
+		}
+	}
+	return signals
+}
+
+func managesExits(s Strategy) bool {
+	m, ok := s.(ExitManager)
+	return ok && m.ManagesExits()
+}
+
+// Accumulator is implemented by strategies that build one position
+// out of many sized buys and sell it off themselves (grid, DCA). The
+// bot adds their buys to the open position instead of opening a new
+// one, prices it at the average cost and leaves out its emergency sells.
+type Accumulator interface {
+	Accumulates() bool
+}
+
+// Accumulates reports whether s or a strategy nested inside it accumulates a position
+func Accumulates(s Strategy) bool {
+	accumulates := false
+	Walk(s, func(child Strategy) {
+		if a, ok := child.(Accumulator); ok && a.Accumulates() {
+			accumulates = true
+		}
+	})
+	return accumulates
+}
+
+// FillObserver is implemented by strategies that follow what their
+// signals actually traded. The bot hands them every trade it saves
+// for the pair, a signal it skipped or couldn't fill never gets one.
+type FillObserver interface {
+	Filled(trade models.Trade)
+}
+
+// NotifyFilled hands a trade to s and every strategy nested inside it that observes fills
+func NotifyFilled(s Strategy, trade models.Trade) {
+	Walk(s, func(child Strategy) {
+		if o, ok := child.(FillObserver); ok {
+			o.Filled(trade)
+		}
+	})
+}
+
+// Shorts reports whether s or a strategy nested inside it sells short
+func Shorts(s Strategy) bool {
+	shorts := false
+	Walk(s, func(child Strategy) {
+		if seller, ok := child.(ShortSeller); ok && seller.Shorts() {
+			shorts = true
+		}
+	})
+	return shorts
+}
+
+// OrderBookWatcher is implemented by strategies that read the order
+// book and trade flow, they receive them in MarketData.Book / Flow
+type OrderBookWatcher interface {
+	BookLevels() int // Depth levels the strategy looks at
+}
+
+// BookLevels returns the most book levels s or a strategy nested
+// inside it watches, 0 when none watches the book
+func BookLevels(s Strategy) int {
+	levels := 0
+	Walk(s, func(child Strategy) {
+		if w, ok := child.(OrderBookWatcher); ok && w.BookLevels() > levels {
+			levels = w.BookLevels()
+		}
+	})
+	return levels
+}
+
+// Timeframes returns every interval s or a strategy nested inside it subscribes to
+func Timeframes(s Strategy) []string {
+	seen := make(map[string]bool)
+	var intervals []string
+	Walk(s, func(child Strategy) {
+		if m, ok := child.(MultiTimeframe); ok {
+			for _, interval := range m.Timeframes() {
+				if !seen[interval] {
+					seen[interval] = true
+					intervals = append(intervals, interval)
+				}
+			}
+		}
+	})
+	return intervals
+}
+
+// Walk calls fn for s and every strategy nested inside it
+func Walk(s Strategy, fn func(Strategy)) {
+	fn(s)
+	if c, ok := s.(Composite); ok {
+		for _, child := range c.Children() {
+			Walk(child, fn)
+		}
+	}
+}
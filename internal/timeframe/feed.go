@@ -0,0 +1,87 @@
+package timeframe
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/* Fetcher loads the most recent candles, e.g. Exchange.GetHistoricalData */
+type Fetcher func(symbol string, interval string, limit int) ([]models.Kline, error)
+
+/*
+	Feed
+
+*  keeps live candle series per symbol and interval. A series is
+*  only downloaded again once its next candle should have closed,
+*  so polling every few seconds doesn't hammer the exchange.
+*/
+type Feed struct {
+	fetch  Fetcher
+	limit  int
+	series map[string]*liveSeries
+}
+
+type liveSeries struct {
+	candles   []models.Kline
+	nextClose time.Time
+}
+
+func NewFeed(fetch Fetcher, limit int) *Feed {
+	return &Feed{
+		fetch:  fetch,
+		limit:  limit,
+		series: make(map[string]*liveSeries),
+	}
+}
+
+/*
+	Frames
+
+*  returns the closed candles of every interval for a symbol as of now
+*/
+func (f *Feed) Frames(symbol string, intervals []string, now time.Time) (map[string][]models.Kline, error) {
+	frames := make(map[string][]models.Kline, len(intervals))
+	for _, interval := range intervals {
+		candles, err := f.candles(symbol, interval, now)
+		if err != nil {
+			return nil, err
+		}
+		frames[interval] = candles
+	}
+	return frames, nil
+}
+
+func (f *Feed) candles(symbol string, interval string, now time.Time) ([]models.Kline, error) {
+	key := symbol + "/" + interval
+	s, ok := f.series[key]
+	if ok && now.Before(s.nextClose) {
+		return s.candles, nil
+	}
+
+	d, err := ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	/* One extra candle, the newest one is usually still open */
+	klines, err := f.fetch(symbol, interval, f.limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s %s candles: %v", symbol, interval, err)
+	}
+
+	nowMs := now.UnixMilli()
+	closed := make([]models.Kline, 0, len(klines))
+	for _, k := range klines {
+		if k.CloseTime < nowMs {
+			closed = append(closed, k)
+		}
+	}
+	if len(closed) > f.limit {
+		closed = closed[len(closed)-f.limit:]
+	}
+
+	next := time.UnixMilli(bucketStart(nowMs, d)).Add(d)
+	f.series[key] = &liveSeries{candles: closed, nextClose: next}
+	return closed, nil
+}
@@ -0,0 +1,188 @@
+package timeframe
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+/*
+	Timeframe
+
+*  Candle series for several intervals at once, e.g. 1m entries
+*  filtered by the 1h trend.
+*
+*  Only closed candles are ever handed out. A higher timeframe
+*  candle becomes visible once the base candle that completes it
+*  has closed, so replaying base candles through a Set never
+*  leaks the rest of an unfinished hour into the past.
+*/
+
+/* DefaultLimit is the number of closed candles kept per interval */
+const DefaultLimit = 500
+
+/* Binance weeks start on Monday, the unix epoch was a Thursday */
+const weekOffset = 4 * 24 * time.Hour
+
+var units = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+/*
+	ParseInterval
+
+*  converts a Binance interval ("1m", "15m", "4h", "1d", "1w")
+*  to a duration. Months are not supported since they vary in length.
+*/
+func ParseInterval(interval string) (time.Duration, error) {
+	if len(interval) < 2 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	unit, ok := units[interval[len(interval)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid interval %q: unit must be m, h, d or w", interval)
+	}
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+/* bucketStart returns the open time (ms) of the interval containing t (ms) */
+func bucketStart(t int64, d time.Duration) int64 {
+	size := d.Milliseconds()
+	offset := int64(0)
+	if d%(7*24*time.Hour) == 0 {
+		offset = weekOffset.Milliseconds()
+	}
+	return t - ((t-offset)%size+size)%size
+}
+
+/*
+	Resampler
+
+*  builds candles of one interval from finer base candles
+*/
+type Resampler struct {
+	interval time.Duration
+	limit    int
+	current  *models.Kline
+	closed   []models.Kline
+}
+
+func NewResampler(interval time.Duration, limit int) *Resampler {
+	return &Resampler{interval: interval, limit: limit}
+}
+
+/*
+	Add
+
+*  merges a closed base candle into the series
+*/
+func (r *Resampler) Add(k models.Kline) {
+	start := bucketStart(k.OpenTime, r.interval)
+	end := start + r.interval.Milliseconds()
+
+	/* A gap in the base data finishes the previous bucket */
+	if r.current != nil && r.current.OpenTime != start {
+		r.close()
+	}
+
+	if r.current == nil {
+		r.current = &models.Kline{
+			OpenTime:  start,
+			Open:      k.Open,
+			High:      k.High,
+			Low:       k.Low,
+			Close:     k.Close,
+			Volume:    k.Volume,
+			CloseTime: end - 1,
+		}
+	} else {
+		if k.High > r.current.High {
+			r.current.High = k.High
+		}
+		if k.Low < r.current.Low {
+			r.current.Low = k.Low
+		}
+		r.current.Close = k.Close
+		r.current.Volume += k.Volume
+	}
+
+	if k.CloseTime+1 >= end {
+		r.close()
+	}
+}
+
+func (r *Resampler) close() {
+	r.closed = append(r.closed, *r.current)
+	r.current = nil
+	if r.limit > 0 && len(r.closed) > r.limit {
+		r.closed = r.closed[len(r.closed)-r.limit:]
+	}
+}
+
+/* Closed returns the closed candles, oldest first */
+func (r *Resampler) Closed() []models.Kline {
+	return r.closed
+}
+
+/*
+	Set
+
+*  keeps one aligned series per subscribed interval
+*/
+type Set struct {
+	series map[string]*Resampler
+}
+
+func NewSet(intervals []string, limit int) (*Set, error) {
+	set := &Set{series: make(map[string]*Resampler)}
+	for _, interval := range intervals {
+		d, err := ParseInterval(interval)
+		if err != nil {
+			return nil, err
+		}
+		set.series[interval] = NewResampler(d, limit)
+	}
+	return set, nil
+}
+
+/* Add feeds a closed base candle to every series */
+func (s *Set) Add(k models.Kline) {
+	for _, r := range s.series {
+		r.Add(k)
+	}
+}
+
+/*
+	Frames
+
+*  returns the closed candles of every interval. Closed candles are
+*  never modified, so strategies may keep the slices.
+*/
+func (s *Set) Frames() map[string][]models.Kline {
+	frames := make(map[string][]models.Kline, len(s.series))
+	for interval, r := range s.series {
+		closed := r.Closed()
+		frames[interval] = closed[:len(closed):len(closed)]
+	}
+	return frames
+}
+
+/* Intervals returns the subscribed intervals, sorted */
+func (s *Set) Intervals() []string {
+	intervals := make([]string, 0, len(s.series))
+	for interval := range s.series {
+		intervals = append(intervals, interval)
+	}
+	sort.Strings(intervals)
+	return intervals
+}
@@ -0,0 +1,77 @@
+package timeframe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marwanbukhori/player-cryptobot/internal/models"
+)
+
+func minuteCandle(start time.Time, i int, price float64) models.Kline {
+	open := start.Add(time.Duration(i) * time.Minute).UnixMilli()
+	return models.Kline{
+		OpenTime:  open,
+		Open:      price,
+		High:      price + 1,
+		Low:       price - 1,
+		Close:     price,
+		Volume:    1,
+		CloseTime: open + time.Minute.Milliseconds() - 1,
+	}
+}
+
+func TestResamplerNoLookahead(t *testing.T) {
+	set, err := NewSet([]string{"15m"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 30; i++ {
+		set.Add(minuteCandle(start, i, float64(100+i)))
+		closed := set.Frames()["15m"]
+
+		/* The first 15m candle only exists once minute 14 has closed */
+		want := (i + 1) / 15
+		if len(closed) != want {
+			t.Fatalf("after minute %d: expected %d closed candles, got %d", i, want, len(closed))
+		}
+	}
+
+	closed := set.Frames()["15m"]
+	first := closed[0]
+	if first.Open != 100 || first.Close != 114 || first.High != 115 || first.Low != 99 || first.Volume != 15 {
+		t.Errorf("unexpected first candle %+v", first)
+	}
+	if first.OpenTime != start.UnixMilli() || closed[1].OpenTime != start.Add(15*time.Minute).UnixMilli() {
+		t.Errorf("candles not aligned to the interval: %d, %d", first.OpenTime, closed[1].OpenTime)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1m":  time.Minute,
+		"15m": 15 * time.Minute,
+		"4h":  4 * time.Hour,
+		"1d":  24 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+	}
+	for in, want := range tests {
+		got, err := ParseInterval(in)
+		if err != nil || got != want {
+			t.Errorf("ParseInterval(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "m", "0h", "1M", "-1h", "1y"} {
+		if _, err := ParseInterval(in); err == nil {
+			t.Errorf("ParseInterval(%q): expected an error", in)
+		}
+	}
+
+	/* Weekly candles open on Monday like Binance's */
+	monday := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	wednesday := monday.Add(2*24*time.Hour + 5*time.Hour)
+	if got := bucketStart(wednesday.UnixMilli(), 7*24*time.Hour); got != monday.UnixMilli() {
+		t.Errorf("weekly bucket starts at %v, want %v", time.UnixMilli(got).UTC(), monday)
+	}
+}
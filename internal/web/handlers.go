@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/marwanbukhori/player-cryptobot/internal/models"
@@ -57,9 +58,12 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 			PnL:        t.PnL,
 			PnLPercent: t.PnLPercent,
 			Status:     t.Status,
+			Reason:     t.Reason,
 		}
 	}
 
+	data.Regimes = s.regimeData()
+
 	if err := s.tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
 		return
@@ -77,6 +81,31 @@ func (s *Server) handleTrades(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(trades)
 }
 
+func (s *Server) handleRegimes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.regimeData())
+}
+
+/* regimeData returns the latest regime per symbol, sorted by symbol */
+func (s *Server) regimeData() []RegimeData {
+	if s.regimes == nil {
+		return []RegimeData{}
+	}
+	snapshots := s.regimes.All()
+	data := make([]RegimeData, 0, len(snapshots))
+	for symbol, snapshot := range snapshots {
+		data = append(data, RegimeData{
+			Symbol:        symbol,
+			Regime:        snapshot.Regime.String(),
+			ADX:           snapshot.ADX,
+			ATRPercentile: snapshot.ATRPercentile,
+			Slope:         snapshot.Slope,
+		})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Symbol < data[j].Symbol })
+	return data
+}
+
 func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
 	summary, err := s.exchange.GetTradingSummary()
 	if err != nil {
@@ -100,7 +129,7 @@ func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
 
 	csvWriter := csv.NewWriter(w)
 	if err := csvWriter.Write([]string{
-		"Date", "Symbol", "Side", "Price", "Quantity", "Value", "Fee", "PnL", "PnL%", "Status",
+		"Date", "Symbol", "Side", "Price", "Quantity", "Value", "Fee", "PnL", "PnL%", "Status", "Reason",
 	}); err != nil {
 		http.Error(w, "Failed to write CSV header", http.StatusInternalServerError)
 		return
@@ -118,6 +147,7 @@ func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
 			fmt.Sprintf("%.8f", t.PnL),
 			fmt.Sprintf("%.2f", t.PnLPercent),
 			t.Status,
+			t.Reason,
 		}); err != nil {
 			http.Error(w, "Failed to write CSV data", http.StatusInternalServerError)
 			return
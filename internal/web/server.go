@@ -8,17 +8,28 @@ import (
 	"time"
 
 	"github.com/marwanbukhori/player-cryptobot/internal/exchange"
+	"github.com/marwanbukhori/player-cryptobot/internal/regime"
 )
 
 type Server struct {
 	exchange exchange.Exchange
 	port     string
 	tmpl     *template.Template
+	regimes  *regime.Board
 }
 
 type DashboardData struct {
 	Summary []TradingSummary `json:"summary"`
 	Trades  []TradeData      `json:"trades"`
+	Regimes []RegimeData     `json:"regimes"`
+}
+
+type RegimeData struct {
+	Symbol        string  `json:"symbol"`
+	Regime        string  `json:"regime"`
+	ADX           float64 `json:"adx"`
+	ATRPercentile float64 `json:"atr_percentile"`
+	Slope         float64 `json:"ma_slope"`
 }
 
 type TradingSummary struct {
@@ -45,12 +56,14 @@ type TradeData struct {
 	PnL        float64   `json:"pn_l"`
 	PnLPercent float64   `json:"pn_l_percent"`
 	Status     string    `json:"status"`
+	Reason     string    `json:"reason"`
 }
 
 /*
 *  NewServer is a function that creates a new server
+*  regimes may be nil when no market regime is tracked
  */
-func NewServer(exchange exchange.Exchange, port string) *Server {
+func NewServer(exchange exchange.Exchange, port string, regimes *regime.Board) *Server {
 	funcMap := template.FuncMap{
 		"lower": strings.ToLower,
 		"div": func(a, b int, scale float64) float64 {
@@ -66,6 +79,7 @@ func NewServer(exchange exchange.Exchange, port string) *Server {
 		exchange: exchange,
 		port:     port,
 		tmpl:     tmpl,
+		regimes:  regimes,
 	}
 }
 
@@ -86,6 +100,7 @@ func (s *Server) Start() error {
 	http.HandleFunc("/", s.handleDashboard)
 	http.HandleFunc("/api/trades", s.handleTrades)
 	http.HandleFunc("/api/summary", s.handleSummary)
+	http.HandleFunc("/api/regimes", s.handleRegimes)
 	http.HandleFunc("/export/csv", s.handleExportCSV)
 	http.HandleFunc("/export/json", s.handleExportJSON)
 
@@ -130,6 +145,37 @@ const dashboardTemplate = `
             {{end}}
         </div>
 
+        <!-- Market Regime -->
+        {{if .Regimes}}
+        <div class="card">
+            <div class="card-body">
+                <h5 class="card-title">Market Regime</h5>
+                <table class="table table-sm">
+                    <thead>
+                        <tr>
+                            <th>Symbol</th>
+                            <th>Regime</th>
+                            <th>ADX</th>
+                            <th>ATR Percentile</th>
+                            <th>MA Slope</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{range .Regimes}}
+                        <tr>
+                            <td>{{.Symbol}}</td>
+                            <td>{{.Regime}}</td>
+                            <td>{{printf "%.2f" .ADX}}</td>
+                            <td>{{printf "%.0f" .ATRPercentile}}%</td>
+                            <td>{{printf "%.4f" .Slope}}%/bar</td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
+            </div>
+        </div>
+        {{end}}
+
         <!-- Recent Trades -->
         <div class="card">
             <div class="card-body">
@@ -146,6 +192,7 @@ const dashboardTemplate = `
                                 <th>Value</th>
                                 <th>P&L</th>
                                 <th>Status</th>
+                                <th>Reason</th>
                             </tr>
                         </thead>
                         <tbody>
@@ -159,6 +206,7 @@ const dashboardTemplate = `
                                 <td>{{printf "%.2f" .Value}}</td>
                                 <td>{{if eq .Side "SELL"}}{{printf "%.2f" .PnL}}{{end}}</td>
                                 <td>{{.Status}}</td>
+                                <td>{{.Reason}}</td>
                             </tr>
                             {{end}}
                         </tbody>